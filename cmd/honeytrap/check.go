@@ -0,0 +1,133 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package honeytrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/honeytrap/honeytrap/server"
+	cli "gopkg.in/urfave/cli.v1"
+
+	logging "github.com/op/go-logging"
+)
+
+var checkConfigCommand = cli.Command{
+	Name:      "check-config",
+	Usage:     "Validate the configuration without starting the sensor",
+	ArgsUsage: "[FILE]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "json", Usage: "Output the problems as json"},
+		cli.BoolFlag{Name: "strict", Usage: "Fail on warnings as well"},
+	},
+	Action: checkConfig,
+}
+
+func checkConfig(c *cli.Context) error {
+	path := c.GlobalString("config")
+	if c.NArg() > 0 {
+		path = c.Args().First()
+	}
+
+	data, err := server.ReadConfig(path)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to read config file %s: %s", path, err.Error()), 2)
+	}
+
+	// the problems will be reported, the log messages of the components would only add noise
+	logging.SetBackend(logging.NewLogBackend(ioutil.Discard, "", 0))
+
+	// services store generated keys, which shouldn't end up in the data directory
+	dataDir, err := ioutil.TempDir("", "honeytrap-check")
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	defer os.RemoveAll(dataDir)
+
+	fn, err := server.WithDataDir(dataDir)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	problems := server.Check(path, data, fn)
+
+	errors, warnings := 0, 0
+	for _, p := range problems {
+		if p.Severity == server.SeverityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+
+	valid := errors == 0 && (warnings == 0 || !c.Bool("strict"))
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(struct {
+			File     string           `json:"file"`
+			Valid    bool             `json:"valid"`
+			Errors   int              `json:"errors"`
+			Warnings int              `json:"warnings"`
+			Problems []server.Problem `json:"problems"`
+		}{
+			File:     path,
+			Valid:    valid,
+			Errors:   errors,
+			Warnings: warnings,
+			Problems: problems,
+		}); err != nil {
+			return cli.NewExitError(err.Error(), 2)
+		}
+	} else {
+		for _, p := range problems {
+			if p.Severity == server.SeverityError {
+				fmt.Println(color.RedString(p.String()))
+			} else {
+				fmt.Println(color.YellowString(p.String()))
+			}
+		}
+
+		fmt.Printf("%s: %d error(s), %d warning(s)\n", path, errors, warnings)
+	}
+
+	if !valid {
+		return cli.NewExitError("", 1)
+	}
+
+	return nil
+}
@@ -211,10 +211,19 @@ func serve(c *cli.Context) error {
 		s := make(chan os.Signal, 1)
 		signal.Notify(s, os.Interrupt)
 		signal.Notify(s, syscall.SIGTERM)
+		signal.Notify(s, syscall.SIGHUP)
 
-		select {
-		case <-s:
-			cancel()
+		for sig := range s {
+			if sig != syscall.SIGHUP {
+				cancel()
+				return
+			}
+
+			log.Info("Received SIGHUP, reloading configuration")
+
+			if err := srvr.Reload(); err != nil {
+				log.Errorf("Error reloading configuration, keeping current configuration: %s", err.Error())
+			}
 		}
 	}()
 
@@ -239,7 +248,10 @@ Commit-ID: %s
 	app.Flags = globalFlags
 	app.Description = `honeytrap: The honeypot server.`
 	app.CustomAppHelpTemplate = helpTemplate
-	app.Commands = []cli.Command{}
+	app.Commands = []cli.Command{
+		checkConfigCommand,
+		replayCommand,
+	}
 	app.Before = func(c *cli.Context) error {
 		return nil
 	}
@@ -0,0 +1,178 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package honeytrap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/event/expr"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/replay"
+	"github.com/honeytrap/honeytrap/server"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var replayCommand = cli.Command{
+	Name:      "replay",
+	Usage:     "Push the events written by the file channel through a channel",
+	ArgsUsage: "FILE...",
+	Description: `Reads the events written by the file channel, including its rotated files,
+   and pushes these through a channel of the configuration. The sensor doesn't
+   need to be running, no ports will be opened.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "channel", Usage: "Push the events through channel `NAME` of the configuration"},
+		cli.StringFlag{Name: "from", Usage: "Replay events from `TIME`, a date, time or duration ago like 72h"},
+		cli.StringFlag{Name: "to", Usage: "Replay events before `TIME`, a date, time or duration ago like 24h"},
+		cli.StringFlag{Name: "filter", Usage: "Replay events matching `EXPRESSION`, like category == 'ssh'"},
+		cli.Float64Flag{Name: "rate", Usage: "Push at most `N` events per second"},
+	},
+	Action: replayEvents,
+}
+
+// channelEvents logs the events of the channel itself, like the state of its
+// connection. These aren't pushed through the channel, to keep them apart from
+// the replayed events.
+type channelEvents struct{}
+
+func (channelEvents) Send(e event.Event) {
+	if err := e.Get("error"); err != "" {
+		log.Errorf("Channel %s: %s", e.Get("type"), err)
+		return
+	}
+
+	log.Infof("Channel %s", e.Get("type"))
+}
+
+func replayEvents(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.NewExitError("No files to replay", 2)
+	}
+
+	if c.String("channel") == "" {
+		return cli.NewExitError("No channel set, use --channel", 2)
+	}
+
+	options := replay.Options{
+		Rate: c.Float64("rate"),
+	}
+
+	now := time.Now()
+
+	var err error
+
+	if s := c.String("from"); s == "" {
+	} else if options.From, err = replay.ParseTime(s, now); err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	if s := c.String("to"); s == "" {
+	} else if options.To, err = replay.ParseTime(s, now); err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	if s := c.String("filter"); s == "" {
+	} else if x, err := expr.Compile(s); err != nil {
+		return cli.NewExitError(fmt.Sprintf("Invalid filter: %s", err.Error()), 2)
+	} else {
+		options.Filter = x.Eval
+	}
+
+	files := []string{}
+	for _, path := range c.Args() {
+		matches, err := replay.Files(path)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("Failed to find files of %s: %s", path, err.Error()), 2)
+		}
+
+		files = append(files, matches...)
+	}
+
+	path := c.GlobalString("config")
+
+	data, err := server.ReadConfig(path)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to read config file %s: %s", path, err.Error()), 2)
+	}
+
+	conf := &config.Config{}
+	if err := conf.Load(bytes.NewReader(data)); err != nil {
+		return cli.NewExitError(fmt.Sprintf("Failed to load config file %s: %s", path, err.Error()), 2)
+	}
+
+	dataDir, err := server.DataDir(c.GlobalString("data"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	channel, err := server.NewChannel(conf, c.String("channel"),
+		pushers.WithEvents(channelEvents{}),
+		pushers.WithDataDir(dataDir),
+	)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		s := make(chan os.Signal, 1)
+		signal.Notify(s, os.Interrupt, syscall.SIGTERM)
+
+		<-s
+		cancel()
+	}()
+
+	stats, err := replay.Replay(ctx, channel, files, options)
+
+	// deliver the events queued by the channel
+	if serr := pushers.Shutdown(channel); serr != nil {
+		log.Errorf("Error shutting down channel: %s", serr.Error())
+	}
+
+	fmt.Printf("Replayed %d of %d events from %d file(s), %d skipped, %d invalid\n", stats.Sent, stats.Read, len(files), stats.Skipped, stats.Invalid)
+
+	if err == context.Canceled {
+		return cli.NewExitError("Replay interrupted", 1)
+	} else if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
@@ -57,6 +57,10 @@ type Config struct {
 
 	Web toml.Primitive `toml:"web"`
 
+	API toml.Primitive `toml:"api"`
+
+	Correlation toml.Primitive `toml:"correlation"`
+
 	Services  map[string]toml.Primitive `toml:"service"`
 	Ports     []toml.Primitive          `toml:"port"`
 	Directors map[string]toml.Primitive `toml:"director"`
@@ -64,6 +68,16 @@ type Config struct {
 
 	Filters []toml.Primitive `toml:"filter"`
 
+	Enrichers []toml.Primitive `toml:"enrich"`
+
+	Rules []toml.Primitive `toml:"rule"`
+
+	Limits toml.Primitive `toml:"limits"`
+
+	// DrainTimeout defines how long active connections and channels get to
+	// finish when shutting down.
+	DrainTimeout Delay `toml:"drain-timeout"`
+
 	Logging []struct {
 		Output string `toml:"output"`
 		Level  string `toml:"level"`
@@ -73,14 +87,24 @@ type Config struct {
 // DefaultConfig defines the default Config to be used to set default values.
 var Default = Config{}
 
-// Load attempts to load the giving toml configuration file.
-func (c *Config) Load(r io.Reader) error {
+// Decode decodes the toml configuration, without configuring the logging
+// backends.
+func (c *Config) Decode(r io.Reader) error {
 	md, err := toml.DecodeReader(r, c)
 	if err != nil {
 		return err
 	}
 	c.MetaData = md
 
+	return nil
+}
+
+// Load attempts to load the giving toml configuration file.
+func (c *Config) Load(r io.Reader) error {
+	if err := c.Decode(r); err != nil {
+		return err
+	}
+
 	if len(c.Logging) == 0 {
 		fmt.Println("Warning: no logging backends configured. Add one to view log messages.")
 	}
@@ -100,7 +124,7 @@ func (c *Config) Load(r io.Reader) error {
 		}
 
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("error opening log output %s: %s", log.Output, err.Error())
 		}
 
 		backend := logging.NewLogBackend(output, "", 0)
@@ -109,7 +133,7 @@ func (c *Config) Load(r io.Reader) error {
 
 		level, err := logging.LogLevel(log.Level)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("error parsing log level %s: %s", log.Level, err.Error())
 		}
 
 		backendLeveled.SetLevel(level, "")
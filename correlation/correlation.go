@@ -0,0 +1,389 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package correlation keeps a profile of every source, correlating the events
+// of the different services. Services assign their own session ids, the
+// profile ties these together with the services and ports touched, the
+// credentials tried, the commands run and the fingerprints of the clients.
+//
+// Profiles are persisted in the profiles namespace of the storage, and are
+// exposed by the admin api. An event with category profile is sent when a
+// profile changes:
+//
+//    [correlation]
+//    enabled=true
+//    max-values=100
+package correlation
+
+import (
+	"container/list"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	logging "github.com/op/go-logging"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/rules"
+	"github.com/honeytrap/honeytrap/storage"
+)
+
+var log = logging.MustGetLogger("honeytrap:correlation")
+
+// Category is the category of the profile update events.
+const Category = "profile"
+
+// flushInterval is the interval the changed profiles are persisted.
+const flushInterval = 10 * time.Second
+
+// Store persists the profiles, namespaces of the storage implement it. Get
+// returns storage.ErrNotFound for unknown keys.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Set(key string, data []byte) error
+	Range(fn func(key string, data []byte) bool) error
+}
+
+// Correlator updates the profiles of the sources of the events it receives,
+// and sends the profile update events to the channel.
+type Correlator struct {
+	Enabled bool `toml:"enabled"`
+
+	// MaxValues limits the number of values of every list of a profile
+	MaxValues int `toml:"max-values"`
+
+	// CacheSize is the number of profiles kept in memory
+	CacheSize int `toml:"cache-size"`
+
+	store   Store
+	channel pushers.Channel
+
+	m sync.Mutex
+
+	// cache contains the recent profiles, lru the source ips from most to
+	// least recently seen
+	cache map[string]*entry
+	lru   *list.List
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+type entry struct {
+	profile *Profile
+	dirty   bool
+	elem    *list.Element
+}
+
+// New returns a new correlator.
+func New(options ...func(*Correlator) error) (*Correlator, error) {
+	c := &Correlator{
+		Enabled:   false,
+		MaxValues: 100,
+		CacheSize: 10000,
+
+		channel: pushers.MustDummy(),
+
+		cache:   map[string]*entry{},
+		lru:     list.New(),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MaxValues <= 0 {
+		c.MaxValues = 100
+	}
+
+	if c.CacheSize <= 0 {
+		c.CacheSize = 10000
+	}
+
+	go c.run()
+
+	return c, nil
+}
+
+// WithConfig decodes the [correlation] section of the configuration.
+func WithConfig(p toml.Primitive) func(*Correlator) error {
+	return func(c *Correlator) error {
+		return toml.PrimitiveDecode(p, c)
+	}
+}
+
+// WithStore sets the store the profiles are persisted in.
+func WithStore(store Store) func(*Correlator) error {
+	return func(c *Correlator) error {
+		c.store = store
+		return nil
+	}
+}
+
+// WithChannel sets the channel the profile update events are sent to.
+func WithChannel(channel pushers.Channel) func(*Correlator) error {
+	return func(c *Correlator) error {
+		c.channel = channel
+		return nil
+	}
+}
+
+// Send updates the profile of the source of the event. Profile update events
+// and alerts are ignored.
+func (c *Correlator) Send(e event.Event) {
+	switch e.Get("category") {
+	case Category, rules.Category, "heartbeat":
+		return
+	}
+
+	ip := e.Get("source-ip")
+	if ip == "" {
+		return
+	}
+
+	now := time.Now()
+	if v, ok := e.Value("date"); !ok {
+	} else if date, ok := v.(time.Time); ok {
+		now = date
+	}
+
+	c.m.Lock()
+
+	en := c.load(ip)
+
+	changes := en.profile.update(e, now, c.MaxValues)
+	en.dirty = true
+
+	var options []event.Option
+	if len(changes) > 0 {
+		options = en.profile.Options(changes)
+	}
+
+	c.evict()
+
+	c.m.Unlock()
+
+	if options != nil {
+		c.channel.Send(event.New(options...))
+	}
+}
+
+// load returns the cached profile of the ip, reading it from the store if it
+// isn't cached. The lock must be held.
+func (c *Correlator) load(ip string) *entry {
+	if en, ok := c.cache[ip]; ok {
+		c.lru.MoveToFront(en.elem)
+		return en
+	}
+
+	p, err := c.read(ip)
+	if err != nil {
+		log.Errorf("Error reading profile of %s: %s", ip, err.Error())
+	}
+
+	if p == nil {
+		p = newProfile(ip)
+	}
+
+	en := &entry{
+		profile: p,
+	}
+
+	en.elem = c.lru.PushFront(ip)
+	c.cache[ip] = en
+	return en
+}
+
+// read returns the persisted profile of the ip, or nil if it doesn't exist.
+func (c *Correlator) read(ip string) (*Profile, error) {
+	if c.store == nil {
+		return nil, nil
+	}
+
+	data, err := c.store.Get(ip)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	p := newProfile(ip)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// evict removes the least recently seen profiles exceeding the cache size,
+// persisting them if changed. The lock must be held.
+func (c *Correlator) evict() {
+	for c.lru.Len() > c.CacheSize {
+		elem := c.lru.Back()
+		ip := elem.Value.(string)
+
+		if en := c.cache[ip]; en.dirty {
+			if err := c.write(en.profile); err != nil {
+				log.Errorf("Error persisting profile of %s: %s", ip, err.Error())
+			}
+		}
+
+		c.lru.Remove(elem)
+		delete(c.cache, ip)
+	}
+}
+
+func (c *Correlator) write(p *Profile) error {
+	if c.store == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return c.store.Set(p.SourceIP, data)
+}
+
+func (c *Correlator) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				log.Errorf("Error persisting profiles: %s", err.Error())
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Flush persists the changed profiles.
+func (c *Correlator) Flush() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	var lastErr error
+
+	for ip, en := range c.cache {
+		if !en.dirty {
+			continue
+		}
+
+		if err := c.write(en.profile); err != nil {
+			log.Errorf("Error persisting profile of %s: %s", ip, err.Error())
+			lastErr = err
+			continue
+		}
+
+		en.dirty = false
+	}
+
+	return lastErr
+}
+
+// Close persists the changed profiles and stops persisting periodically.
+func (c *Correlator) Close() error {
+	close(c.done)
+	<-c.stopped
+
+	return c.Flush()
+}
+
+// Profile returns the profile of the ip, or nil if the ip hasn't been seen.
+func (c *Correlator) Profile(ip string) (*Profile, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if en, ok := c.cache[ip]; ok {
+		return en.profile.clone(), nil
+	}
+
+	return c.read(ip)
+}
+
+// Profiles returns all profiles, most recently seen first.
+func (c *Correlator) Profiles() ([]*Profile, error) {
+	// the store is ranged without the lock, which would block Send
+	c.m.Lock()
+
+	cached := map[string]*Profile{}
+	for ip, en := range c.cache {
+		cached[ip] = en.profile.clone()
+	}
+
+	c.m.Unlock()
+
+	profiles := []*Profile{}
+
+	for _, p := range cached {
+		profiles = append(profiles, p)
+	}
+
+	if c.store != nil {
+		err := c.store.Range(func(ip string, data []byte) bool {
+			// the cached profile is more recent
+			if _, ok := cached[ip]; ok {
+				return true
+			}
+
+			p := newProfile(ip)
+			if err := json.Unmarshal(data, p); err != nil {
+				log.Errorf("Error reading profile of %s: %s", ip, err.Error())
+				return true
+			}
+
+			profiles = append(profiles, p)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].LastSeen.After(profiles[j].LastSeen)
+	})
+
+	return profiles, nil
+}
@@ -0,0 +1,284 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package correlation
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/storage"
+)
+
+type memoryStore struct {
+	m    sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		data: map[string][]byte{},
+	}
+}
+
+func (ms *memoryStore) Get(key string) ([]byte, error) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	data, ok := ms.data[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return data, nil
+}
+
+func (ms *memoryStore) Set(key string, data []byte) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.data[key] = data
+	return nil
+}
+
+func (ms *memoryStore) Range(fn func(string, []byte) bool) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	for k, v := range ms.data {
+		if !fn(k, v) {
+			break
+		}
+	}
+
+	return nil
+}
+
+type captureChannel struct {
+	m      sync.Mutex
+	events []event.Event
+}
+
+func (cc *captureChannel) Send(e event.Event) {
+	cc.m.Lock()
+	defer cc.m.Unlock()
+
+	cc.events = append(cc.events, e)
+}
+
+func attack(c *Correlator, ip string) {
+	source := net.ParseIP(ip)
+
+	c.Send(event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.SourceIP(source),
+		event.DestinationPort(22),
+		event.Custom("binding", "tcp/22"),
+		event.Custom("service", "ssh"),
+		event.Custom("ssh.sessionid", "session-1"),
+		event.Custom("ssh.username", "root"),
+		event.Custom("ssh.password", "admin"),
+		event.Custom("ssh.hassh", "ec7378c1a92f5a8dde7e8b7a1ddf33d1"),
+	))
+
+	// the same credentials don't change the profile
+	c.Send(event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.SourceIP(source),
+		event.DestinationPort(22),
+		event.Custom("binding", "tcp/22"),
+		event.Custom("service", "ssh"),
+		event.Custom("ssh.sessionid", "session-1"),
+		event.Custom("ssh.username", "root"),
+		event.Custom("ssh.password", "admin"),
+	))
+
+	c.Send(event.New(
+		event.Category("redis"),
+		event.SourceIP(source),
+		event.DestinationPort(6379),
+		event.Custom("binding", "tcp/6379"),
+		event.Custom("service", "redis"),
+		event.Custom("redis.command", "CONFIG SET dir /tmp"),
+	))
+
+	c.Send(event.New(
+		event.Category("https"),
+		event.SourceIP(source),
+		event.DestinationPort(443),
+		event.Custom("service", "https"),
+		event.Custom("https.ja3-digest", "e7d705a3286e19ea42f587b344ee6865"),
+	))
+}
+
+func TestCorrelator(t *testing.T) {
+	store := newMemoryStore()
+	cc := &captureChannel{}
+
+	c, err := New(WithStore(store), WithChannel(cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attack(c, "192.0.2.1")
+
+	p, err := c.Profile("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p == nil {
+		t.Fatal("Expected profile")
+	}
+
+	if p.Events != 4 || p.FirstSeen.IsZero() || p.LastSeen.Before(p.FirstSeen) {
+		t.Errorf("Unexpected counters: %+v", p)
+	}
+
+	if expected := []string{"ssh", "redis", "https"}; !reflect.DeepEqual(p.Services, expected) {
+		t.Errorf("Expected services %v, got %v", expected, p.Services)
+	}
+
+	if expected := []string{"tcp/22", "tcp/6379", "tcp/443"}; !reflect.DeepEqual(p.Ports, expected) {
+		t.Errorf("Expected ports %v, got %v", expected, p.Ports)
+	}
+
+	if expected := []Credential{{"ssh", "root", "admin"}}; !reflect.DeepEqual(p.Credentials, expected) {
+		t.Errorf("Expected credentials %v, got %v", expected, p.Credentials)
+	}
+
+	if expected := []Command{{"redis", "CONFIG SET dir /tmp"}}; !reflect.DeepEqual(p.Commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, p.Commands)
+	}
+
+	if expected := []Session{{"ssh", "session-1"}}; !reflect.DeepEqual(p.Sessions, expected) {
+		t.Errorf("Expected sessions %v, got %v", expected, p.Sessions)
+	}
+
+	if len(p.JA3) != 1 || len(p.HASSH) != 1 {
+		t.Errorf("Expected fingerprints, got %v and %v", p.JA3, p.HASSH)
+	}
+
+	// the repeated credentials didn't change the profile
+	if len(cc.events) != 3 {
+		t.Fatalf("Expected 3 profile updates, got %d", len(cc.events))
+	}
+
+	update := cc.events[1]
+	if update.Get("category") != Category || update.Get("source-ip") != "192.0.2.1" {
+		t.Errorf("Unexpected update event: %+v", event.ToMap(update))
+	}
+
+	if v, _ := update.Value("profile.changes"); !reflect.DeepEqual(v, []string{"service redis", "port tcp/6379", "command redis"}) {
+		t.Errorf("Unexpected changes: %v", v)
+	}
+
+	// profile updates and events without source are ignored
+	c.Send(update)
+	c.Send(event.New(event.Category("heartbeat")))
+
+	if p, _ := c.Profile("192.0.2.1"); p.Events != 4 {
+		t.Errorf("Expected profile updates to be ignored, got %d events", p.Events)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the profile survives a restart
+	c, err = New(WithStore(store), WithChannel(cc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	attack(c, "192.0.2.1")
+
+	p, err = c.Profile("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Events != 8 || len(p.Services) != 3 {
+		t.Errorf("Expected persisted profile to be updated, got %+v", p)
+	}
+
+	if p, err := c.Profile("192.0.2.2"); err != nil || p != nil {
+		t.Errorf("Expected no profile for unknown source, got %+v (%v)", p, err)
+	}
+}
+
+func TestCorrelatorProfiles(t *testing.T) {
+	store := newMemoryStore()
+
+	c, err := New(WithStore(store), func(c *Correlator) error {
+		c.CacheSize = 1
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		c.Send(event.New(
+			event.SourceIP(net.ParseIP(ip)),
+			event.Custom("date", time.Now()),
+			event.Custom("service", "ssh"),
+		))
+	}
+
+	// the evicted profiles have been persisted
+	if len(store.data) != 2 {
+		t.Errorf("Expected 2 persisted profiles, got %d", len(store.data))
+	}
+
+	profiles, err := c.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips := []string{}
+	for _, p := range profiles {
+		ips = append(ips, p.SourceIP)
+	}
+
+	if expected := []string{"192.0.2.3", "192.0.2.2", "192.0.2.1"}; !reflect.DeepEqual(ips, expected) {
+		t.Errorf("Expected profiles %v, got %v", expected, ips)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package correlation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Credential is a username and password tried on a service.
+type Credential struct {
+	Service  string `json:"service"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+}
+
+// Command is a command run on a service.
+type Command struct {
+	Service string `json:"service"`
+	Command string `json:"command"`
+}
+
+// Session is the session id a service assigned to a connection of the source.
+type Session struct {
+	Service string `json:"service"`
+	ID      string `json:"id"`
+}
+
+// Profile contains everything a source has done on the sensor, across
+// services. The lists are limited to the maximum number of values of the
+// correlator, values exceeding the limit are ignored.
+type Profile struct {
+	SourceIP string `json:"source-ip"`
+
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+
+	// Events is the number of events of the source
+	Events uint64 `json:"events"`
+
+	Services    []string     `json:"services"`
+	Ports       []string     `json:"ports"`
+	Sessions    []Session    `json:"sessions"`
+	Credentials []Credential `json:"credentials"`
+	Commands    []Command    `json:"commands"`
+
+	// JA3 and HASSH contain the fingerprints of the tls and ssh clients
+	JA3   []string `json:"ja3"`
+	HASSH []string `json:"hassh"`
+}
+
+func newProfile(ip string) *Profile {
+	return &Profile{
+		SourceIP:    ip,
+		Services:    []string{},
+		Ports:       []string{},
+		Sessions:    []Session{},
+		Credentials: []Credential{},
+		Commands:    []Command{},
+		JA3:         []string{},
+		HASSH:       []string{},
+	}
+}
+
+// clone returns a copy of the profile.
+func (p *Profile) clone() *Profile {
+	c := *p
+
+	c.Services = append([]string{}, p.Services...)
+	c.Ports = append([]string{}, p.Ports...)
+	c.Sessions = append([]Session{}, p.Sessions...)
+	c.Credentials = append([]Credential{}, p.Credentials...)
+	c.Commands = append([]Command{}, p.Commands...)
+	c.JA3 = append([]string{}, p.JA3...)
+	c.HASSH = append([]string{}, p.HASSH...)
+
+	return &c
+}
+
+// port returns the port the event has been received on, like tcp/22. The
+// network is taken from the binding, ports of ranges are reported separately.
+func port(e event.Event) string {
+	binding := e.Get("binding")
+
+	v, ok := e.Value("destination-port")
+	if !ok {
+		return binding
+	}
+
+	network := "tcp"
+	if i := strings.Index(binding, "/"); i > 0 {
+		network = binding[:i]
+	}
+
+	return fmt.Sprintf("%s/%v", network, v)
+}
+
+// update adds the event to the profile, it returns the changes besides the
+// counters and times.
+func (p *Profile) update(e event.Event, now time.Time, maxValues int) []string {
+	changes := []string{}
+
+	if p.FirstSeen.IsZero() {
+		p.FirstSeen = now
+		changes = append(changes, "first-seen")
+	}
+
+	p.LastSeen = now
+	p.Events++
+
+	addString := func(values *[]string, v string, change string) {
+		if v == "" || len(*values) >= maxValues {
+			return
+		}
+
+		for _, existing := range *values {
+			if existing == v {
+				return
+			}
+		}
+
+		*values = append(*values, v)
+		changes = append(changes, change+" "+v)
+	}
+
+	service := e.Get("service")
+	addString(&p.Services, service, "service")
+	addString(&p.Ports, port(e), "port")
+
+	e.Range(func(k, v interface{}) bool {
+		key, ok := k.(string)
+		if !ok {
+			return true
+		}
+
+		value, ok := v.(string)
+		if !ok || value == "" {
+			return true
+		}
+
+		prefix := key
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			prefix = key[:i]
+		}
+
+		switch {
+		case strings.HasSuffix(key, "ja3-digest"):
+			addString(&p.JA3, value, "ja3")
+		case strings.HasSuffix(key, ".hassh"):
+			addString(&p.HASSH, value, "hassh")
+		case strings.HasSuffix(key, ".sessionid"), strings.HasSuffix(key, ".session-id"):
+			p.addSession(Session{prefix, value}, maxValues)
+		case strings.HasSuffix(key, ".command"):
+			if p.addCommand(Command{prefix, value}, maxValues) {
+				changes = append(changes, "command "+prefix)
+			}
+		case strings.HasSuffix(key, ".username"):
+			c := Credential{
+				Service:  prefix,
+				Username: value,
+				Password: e.Get(prefix + ".password"),
+			}
+
+			if p.addCredential(c, maxValues) {
+				changes = append(changes, "credential "+prefix)
+			}
+		}
+
+		return true
+	})
+
+	return changes
+}
+
+func (p *Profile) addSession(s Session, maxValues int) {
+	if len(p.Sessions) >= maxValues {
+		return
+	}
+
+	for _, existing := range p.Sessions {
+		if existing == s {
+			return
+		}
+	}
+
+	p.Sessions = append(p.Sessions, s)
+}
+
+func (p *Profile) addCommand(c Command, maxValues int) bool {
+	if len(p.Commands) >= maxValues {
+		return false
+	}
+
+	for _, existing := range p.Commands {
+		if existing == c {
+			return false
+		}
+	}
+
+	p.Commands = append(p.Commands, c)
+	return true
+}
+
+func (p *Profile) addCredential(c Credential, maxValues int) bool {
+	if len(p.Credentials) >= maxValues {
+		return false
+	}
+
+	for _, existing := range p.Credentials {
+		if existing == c {
+			return false
+		}
+	}
+
+	p.Credentials = append(p.Credentials, c)
+	return true
+}
+
+// Options returns the options of the profile update event.
+func (p *Profile) Options(changes []string) []event.Option {
+	return []event.Option{
+		event.Sensor("correlation"),
+		event.Category(Category),
+		event.Type("update"),
+		event.Custom("source-ip", p.SourceIP),
+		event.Custom("profile.first-seen", p.FirstSeen),
+		event.Custom("profile.last-seen", p.LastSeen),
+		event.Custom("profile.events", p.Events),
+		event.Custom("profile.services", append([]string{}, p.Services...)),
+		event.Custom("profile.ports", append([]string{}, p.Ports...)),
+		event.Custom("profile.credentials", len(p.Credentials)),
+		event.Custom("profile.commands", len(p.Commands)),
+		event.Custom("profile.ja3", append([]string{}, p.JA3...)),
+		event.Custom("profile.hassh", append([]string{}, p.HASSH...)),
+		event.Custom("profile.changes", changes),
+	}
+}
@@ -0,0 +1,135 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package enricher contains the enrichers, which add fields to events before
+// they are delivered to the channels. Enrichers are configured in order:
+//
+//    [[enrich]]
+//    type="geoip"
+//    database="GeoLite2-City.mmdb"
+//
+//    [[enrich]]
+//    type="sensor"
+//    name="sensor-1"
+//    tags=["dmz"]
+package enricher
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Enricher defines an interface for adding fields to events. Enrichers are
+// called from a single goroutine.
+type Enricher interface {
+	Enrich(event.Event)
+}
+
+// EnricherFunc returns a new enricher, configured with the options.
+type EnricherFunc func(...func(Enricher) error) (Enricher, error)
+
+var (
+	enrichers = map[string]EnricherFunc{}
+)
+
+// Register registers the enricher for the type key.
+func Register(key string, fn EnricherFunc) EnricherFunc {
+	enrichers[key] = fn
+	return fn
+}
+
+// Get returns the enricher for the type key.
+func Get(key string) (EnricherFunc, bool) {
+	fn, ok := enrichers[key]
+	return fn, ok
+}
+
+// Range calls fn for the type of every registered enricher.
+func Range(fn func(string)) {
+	for k := range enrichers {
+		fn(k)
+	}
+}
+
+// WithConfig decodes the configuration into the enricher.
+func WithConfig(c toml.Primitive) func(Enricher) error {
+	return func(e Enricher) error {
+		return toml.PrimitiveDecode(c, e)
+	}
+}
+
+// SetDataDirer defines an interface for enrichers that use files in the
+// data directory.
+type SetDataDirer interface {
+	SetDataDir(string)
+}
+
+// WithDataDir sets the data directory of the enricher.
+func WithDataDir(dataDir string) func(Enricher) error {
+	return func(e Enricher) error {
+		if sd, ok := e.(SetDataDirer); ok {
+			sd.SetDataDir(dataDir)
+		}
+
+		return nil
+	}
+}
+
+// Path returns the path relative to the data directory, absolute paths are
+// returned as is.
+func Path(dataDir, path string) string {
+	if filepath.IsAbs(path) || dataDir == "" {
+		return path
+	}
+
+	return filepath.Join(dataDir, path)
+}
+
+// Pipeline calls the enrichers in order.
+type Pipeline []Enricher
+
+// Enrich adds the fields of all enrichers to the event.
+func (p Pipeline) Enrich(e event.Event) {
+	for _, en := range p {
+		en.Enrich(e)
+	}
+}
+
+// Close closes the enrichers that implement io.Closer.
+func Close(en Enricher) error {
+	if c, ok := en.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
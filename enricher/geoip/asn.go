@@ -0,0 +1,87 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package geoip
+
+import (
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var (
+	_ = enricher.Register("asn", NewASN)
+)
+
+// ASN adds the autonomous system number and organization from a GeoLite2 or
+// GeoIP2 ASN database.
+type ASN struct {
+	database
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// NewASN returns a new asn enricher.
+func NewASN(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	a := &ASN{
+		database: database{
+			Field: enricher.DefaultField,
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Enrich adds the autonomous system of the address.
+func (a *ASN) Enrich(e event.Event) {
+	var record asnRecord
+	if !a.lookup(e, &record) {
+		return
+	}
+
+	if record.Number == 0 {
+		return
+	}
+
+	e.Store(a.Name("as.number"), record.Number)
+	e.Store(a.Name("as.organization"), record.Organization)
+}
@@ -0,0 +1,185 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package geoip contains the enrichers using MaxMind databases, geoip adds
+// the country, city and location, asn the autonomous system of an address.
+package geoip
+
+import (
+	"fmt"
+	"sync"
+
+	logging "github.com/op/go-logging"
+	maxminddb "github.com/oschwald/maxminddb-golang"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var log = logging.MustGetLogger("honeytrap:enricher:geoip")
+
+var (
+	_ = enricher.Register("geoip", New)
+)
+
+// database is the MaxMind database shared by the enrichers.
+type database struct {
+	enricher.Field
+
+	Database string `toml:"database"`
+
+	dataDir string
+
+	m  sync.RWMutex
+	db *maxminddb.Reader
+}
+
+func (d *database) SetDataDir(dataDir string) {
+	d.dataDir = dataDir
+}
+
+func (d *database) open() error {
+	if d.Database == "" {
+		return fmt.Errorf("database not set")
+	}
+
+	db, err := maxminddb.Open(enricher.Path(d.dataDir, d.Database))
+	if err != nil {
+		return fmt.Errorf("could not open database %s: %s", d.Database, err.Error())
+	}
+
+	d.db = db
+	return nil
+}
+
+// lookup decodes the record of the address of the event into v, it returns
+// false if the event has no address or the database contains no record.
+func (d *database) lookup(e event.Event, v interface{}) bool {
+	ip := d.IP(e)
+	if ip == nil {
+		return false
+	}
+
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	if d.db == nil {
+		return false
+	}
+
+	if err := d.db.Lookup(ip, v); err != nil {
+		log.Errorf("Error looking up %s: %s", ip.String(), err.Error())
+		return false
+	}
+
+	return true
+}
+
+// Close closes the database, events will not be enriched anymore.
+func (d *database) Close() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.db == nil {
+		return nil
+	}
+
+	err := d.db.Close()
+	d.db = nil
+	return err
+}
+
+// GeoIP adds the country, city and location from a GeoLite2 or GeoIP2
+// country or city database.
+type GeoIP struct {
+	database
+}
+
+type cityRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// New returns a new geoip enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	g := &GeoIP{
+		database: database{
+			Field: enricher.DefaultField,
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(g); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.open(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Enrich adds the country, city and location of the address.
+func (g *GeoIP) Enrich(e event.Event) {
+	var record cityRecord
+	if !g.lookup(e, &record) {
+		return
+	}
+
+	if record.Country.ISOCode == "" {
+		return
+	}
+
+	e.Store(g.Name("country.isocode"), record.Country.ISOCode)
+
+	if name, ok := record.Country.Names["en"]; ok {
+		e.Store(g.Name("country.name"), name)
+	}
+
+	if name, ok := record.City.Names["en"]; ok {
+		e.Store(g.Name("city.name"), name)
+	}
+
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		e.Store(g.Name("location.latitude"), record.Location.Latitude)
+		e.Store(g.Name("location.longitude"), record.Location.Longitude)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// encode writes the value in the MaxMind DB data format.
+func encode(buf *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case string:
+		if len(x) < 29 {
+			buf.WriteByte(2<<5 | byte(len(x)))
+		} else {
+			buf.Write([]byte{2<<5 | 29, byte(len(x) - 29)})
+		}
+		buf.WriteString(x)
+	case float64:
+		buf.WriteByte(3<<5 | 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(x))
+	case uint16:
+		buf.WriteByte(5<<5 | 2)
+		binary.Write(buf, binary.BigEndian, x)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		binary.Write(buf, binary.BigEndian, x)
+	case map[string]interface{}:
+		buf.WriteByte(7<<5 | byte(len(x)))
+		for k, v := range x {
+			encode(buf, k)
+			encode(buf, v)
+		}
+	}
+}
+
+// writeDatabase writes an IPv4 database with a single record for 0.0.0.0/1.
+func writeDatabase(t *testing.T, record map[string]interface{}) string {
+	buf := &bytes.Buffer{}
+
+	// a single node, the left record points to the data, the right is empty
+	buf.Write([]byte{0, 0, 1 + 16, 0, 0, 1})
+	buf.Write(make([]byte, 16))
+
+	encode(buf, record)
+
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(buf, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"database_type":               "Test",
+		"ip_version":                  uint16(4),
+		"node_count":                  uint32(1),
+		"record_size":                 uint16(24),
+	})
+
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "test.mmdb")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+var testRecord = map[string]interface{}{
+	"country": map[string]interface{}{
+		"iso_code": "NL",
+		"names": map[string]interface{}{
+			"en": "Netherlands",
+		},
+	},
+	"city": map[string]interface{}{
+		"names": map[string]interface{}{
+			"en": "Amsterdam",
+		},
+	},
+	"location": map[string]interface{}{
+		"latitude":  52.37,
+		"longitude": 4.89,
+	},
+	"autonomous_system_number":       uint32(1136),
+	"autonomous_system_organization": "KPN B.V.",
+}
+
+func TestGeoIP(t *testing.T) {
+	path := writeDatabase(t, testRecord)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	en, err := New(
+		enricher.WithDataDir(filepath.Dir(path)),
+		func(en enricher.Enricher) error {
+			en.(*GeoIP).Database = "test.mmdb"
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer enricher.Close(en)
+
+	e := event.New(event.Custom("source-ip", "10.0.0.1"))
+	en.Enrich(e)
+
+	expected := map[string]string{
+		"source.country.isocode": "NL",
+		"source.country.name":    "Netherlands",
+		"source.city.name":       "Amsterdam",
+	}
+
+	for k, v := range expected {
+		if got := e.Get(k); got != v {
+			t.Errorf("Expected %s to be %s, got %q", k, v, got)
+		}
+	}
+
+	if v, _ := e.Value("source.location.latitude"); v != 52.37 {
+		t.Errorf("Expected latitude 52.37, got %v", v)
+	}
+
+	e = event.New(event.Custom("source-ip", "192.168.0.1"))
+	en.Enrich(e)
+
+	if e.Has("source.country.isocode") {
+		t.Errorf("Expected no country for address without record")
+	}
+}
+
+func TestASN(t *testing.T) {
+	path := writeDatabase(t, testRecord)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	en, err := NewASN(func(en enricher.Enricher) error {
+		en.(*ASN).Database = path
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer enricher.Close(en)
+
+	e := event.New(event.Custom("source-ip", "10.0.0.1"))
+	en.Enrich(e)
+
+	if v, _ := e.Value("source.as.number"); v != uint(1136) {
+		t.Errorf("Expected as number 1136, got %v", v)
+	}
+
+	if got := e.Get("source.as.organization"); got != "KPN B.V." {
+		t.Errorf("Expected as organization KPN B.V., got %q", got)
+	}
+}
+
+func TestMissingDatabase(t *testing.T) {
+	if _, err := New(); err == nil {
+		t.Errorf("Expected error without database")
+	}
+
+	_, err := New(func(en enricher.Enricher) error {
+		en.(*GeoIP).Database = "/nonexistent/GeoLite2-City.mmdb"
+		return nil
+	})
+	if err == nil {
+		t.Errorf("Expected error for missing database")
+	}
+}
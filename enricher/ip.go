@@ -0,0 +1,80 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package enricher
+
+import (
+	"net"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Field defines the address field of the event to look up, and the prefix of
+// the fields that will be added. It is embedded by the enrichers that look up
+// addresses.
+type Field struct {
+	Field  string `toml:"field"`
+	Prefix string `toml:"prefix"`
+}
+
+// DefaultField looks up the source address.
+var DefaultField = Field{
+	Field: "source-ip",
+}
+
+// IP returns the address of the event, or nil if the event doesn't contain
+// a valid address.
+func (f Field) IP(e event.Event) net.IP {
+	v, ok := e.Value(f.Field)
+	if !ok {
+		return nil
+	}
+
+	switch ip := v.(type) {
+	case net.IP:
+		return ip
+	case string:
+		return net.ParseIP(ip)
+	default:
+		return nil
+	}
+}
+
+// Name returns the name of the field with the prefix, the prefix defaults to
+// the address field without the -ip suffix, eg. source.country.isocode.
+func (f Field) Name(name string) string {
+	prefix := f.Prefix
+	if prefix == "" {
+		prefix = strings.TrimSuffix(f.Field, "-ip")
+	}
+
+	return prefix + "." + name
+}
@@ -0,0 +1,205 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package rdns contains the enricher adding the hostname of an address, using
+// reverse DNS lookups. Lookups are done in the background and their results
+// cached, the first events of an address are sent without its hostname. The
+// number of cached addresses and the time they are cached for are
+// configurable.
+package rdns
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var (
+	_ = enricher.Register("rdns", New)
+)
+
+const (
+	defaultTimeout   = 500 * time.Millisecond
+	defaultCacheSize = 10000
+	defaultCacheTTL  = time.Hour
+
+	// maxLookups is the number of lookups in progress, addresses seen while
+	// at the maximum will be looked up with a later event
+	maxLookups = 32
+)
+
+// RDNS adds the hostname of the address.
+type RDNS struct {
+	enricher.Field
+
+	// Timeout is the maximum duration of a lookup, the event won't contain
+	// a hostname when it expires.
+	Timeout   config.Delay `toml:"timeout"`
+	CacheSize int          `toml:"cache-size"`
+	CacheTTL  config.Delay `toml:"cache-ttl"`
+
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+
+	m       sync.Mutex
+	cache   map[string]*list.Element
+	lru     *list.List
+	pending map[string]struct{}
+
+	lookups chan struct{}
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	addr     string
+	hostname string
+	expires  time.Time
+}
+
+// New returns a new rdns enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	r := &RDNS{
+		Field:      enricher.DefaultField,
+		Timeout:    config.Delay(defaultTimeout),
+		CacheSize:  defaultCacheSize,
+		CacheTTL:   config.Delay(defaultCacheTTL),
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		cache:      map[string]*list.Element{},
+		lru:        list.New(),
+		pending:    map[string]struct{}{},
+		lookups:    make(chan struct{}, maxLookups),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(r); err != nil {
+			return nil, err
+		}
+	}
+
+	// the hostnames are only added from the cache
+	if r.CacheSize <= 0 {
+		return nil, fmt.Errorf("invalid cache-size %d, expected a positive size", r.CacheSize)
+	}
+
+	return r, nil
+}
+
+// Enrich adds the hostname of the address, if it has one and has been looked
+// up already.
+func (r *RDNS) Enrich(e event.Event) {
+	ip := r.IP(e)
+	if ip == nil {
+		return
+	}
+
+	if hostname := r.hostname(ip.String()); hostname != "" {
+		e.Store(r.Name("hostname"), hostname)
+	}
+}
+
+// hostname returns the hostname of the address from the cache, starting a
+// lookup if it isn't cached or has expired. Failed lookups are cached as well.
+func (r *RDNS) hostname(addr string) string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if elem, ok := r.cache[addr]; !ok {
+	} else if entry := elem.Value.(*entry); time.Now().Before(entry.expires) {
+		r.lru.MoveToFront(elem)
+		return entry.hostname
+	} else {
+		r.lru.Remove(elem)
+		delete(r.cache, addr)
+	}
+
+	if _, ok := r.pending[addr]; ok {
+		return ""
+	}
+
+	select {
+	case r.lookups <- struct{}{}:
+	default:
+		return ""
+	}
+
+	r.pending[addr] = struct{}{}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		hostname := r.lookup(addr)
+		<-r.lookups
+
+		r.store(addr, hostname)
+	}()
+
+	return ""
+}
+
+// store caches the hostname of the address, evicting the least recently used
+// addresses.
+func (r *RDNS) store(addr string, hostname string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	delete(r.pending, addr)
+
+	for r.lru.Len() >= r.CacheSize {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.cache, oldest.Value.(*entry).addr)
+	}
+
+	r.cache[addr] = r.lru.PushFront(&entry{
+		addr:     addr,
+		hostname: hostname,
+		expires:  time.Now().Add(r.CacheTTL.Duration()),
+	})
+}
+
+func (r *RDNS) lookup(addr string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout.Duration())
+	defer cancel()
+
+	names, err := r.lookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(names[0], ".")
+}
@@ -0,0 +1,170 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func newTestRDNS(t *testing.T, lookups *int) *RDNS {
+	en, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := en.(*RDNS)
+	r.CacheSize = 2
+	r.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		*lookups++
+
+		if addr == "192.0.2.1" {
+			return []string{"host1.example.com."}, nil
+		}
+
+		return nil, errors.New("no such host")
+	}
+
+	return r
+}
+
+// enrich enriches the event after the lookup of its address has been done.
+func enrich(r *RDNS, e event.Event) {
+	r.Enrich(e)
+	r.wg.Wait()
+	r.Enrich(e)
+}
+
+func TestEnrich(t *testing.T) {
+	lookups := 0
+	r := newTestRDNS(t, &lookups)
+
+	e := event.New(event.Custom("source-ip", "192.0.2.1"))
+	r.Enrich(e)
+
+	if e.Has("source.hostname") {
+		t.Errorf("Expected no hostname before the lookup, got %q", e.Get("source.hostname"))
+	}
+
+	r.wg.Wait()
+	r.Enrich(e)
+
+	if got := e.Get("source.hostname"); got != "host1.example.com" {
+		t.Errorf("Expected hostname host1.example.com, got %q", got)
+	}
+
+	e = event.New(event.Custom("source-ip", "192.0.2.2"))
+	enrich(r, e)
+
+	if e.Has("source.hostname") {
+		t.Errorf("Expected no hostname for failed lookup, got %q", e.Get("source.hostname"))
+	}
+
+	enrich(r, event.New(event.Custom("source-ip", "192.0.2.1")))
+	enrich(r, event.New(event.Custom("source-ip", "192.0.2.2")))
+
+	if lookups != 2 {
+		t.Errorf("Expected 2 lookups, got %d", lookups)
+	}
+
+	// evicts 192.0.2.1, the least recently used address
+	enrich(r, event.New(event.Custom("source-ip", "192.0.2.3")))
+	enrich(r, event.New(event.Custom("source-ip", "192.0.2.1")))
+
+	if lookups != 4 {
+		t.Errorf("Expected 4 lookups, got %d", lookups)
+	}
+}
+
+func TestPending(t *testing.T) {
+	lookups := 0
+	r := newTestRDNS(t, &lookups)
+
+	release := make(chan struct{})
+
+	lookupAddr := r.lookupAddr
+	r.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		<-release
+		return lookupAddr(ctx, addr)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.Enrich(event.New(event.Custom("source-ip", "192.0.2.1")))
+		r.Enrich(event.New(event.Custom("source-ip", "192.0.2.1")))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enrich blocked on the lookup")
+	}
+
+	close(release)
+	r.wg.Wait()
+
+	if lookups != 1 {
+		t.Errorf("Expected 1 lookup, got %d", lookups)
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	lookups := 0
+	r := newTestRDNS(t, &lookups)
+	r.CacheTTL = config.Delay(time.Millisecond)
+
+	enrich(r, event.New(event.Custom("source-ip", "192.0.2.1")))
+	time.Sleep(5 * time.Millisecond)
+	enrich(r, event.New(event.Custom("source-ip", "192.0.2.1")))
+
+	if lookups != 2 {
+		t.Errorf("Expected 2 lookups, got %d", lookups)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	lookups := 0
+	r := newTestRDNS(t, &lookups)
+	r.Field.Field = "destination-ip"
+
+	e := event.New(event.Custom("destination-ip", "192.0.2.1"))
+	enrich(r, e)
+
+	if got := e.Get("destination.hostname"); got != "host1.example.com" {
+		t.Errorf("Expected hostname host1.example.com, got %q", got)
+	}
+}
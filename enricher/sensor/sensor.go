@@ -0,0 +1,78 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package sensor contains the enricher adding the name and tags of the
+// sensor, to tell apart the events of multiple sensors.
+package sensor
+
+import (
+	"os"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var (
+	_ = enricher.Register("sensor", New)
+)
+
+// Sensor adds the name and tags of the sensor.
+type Sensor struct {
+	// Name defaults to the hostname
+	Name string   `toml:"name"`
+	Tags []string `toml:"tags"`
+}
+
+// New returns a new sensor enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	s := &Sensor{}
+
+	for _, optionFn := range options {
+		if err := optionFn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Name != "" {
+	} else if hostname, err := os.Hostname(); err == nil {
+		s.Name = hostname
+	}
+
+	return s, nil
+}
+
+// Enrich adds the name and tags of the sensor.
+func (s *Sensor) Enrich(e event.Event) {
+	e.Store("sensor-name", s.Name)
+
+	if len(s.Tags) > 0 {
+		e.Store("sensor-tags", s.Tags)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package ecs converts events to the Elastic Common Schema. The fields that
+// have an ECS equivalent are mapped, eg. source-ip becomes source.ip and
+// ssh.username becomes user.name. The original fields are kept within the
+// honeytrap namespace.
+package ecs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Version is the version of the Elastic Common Schema.
+const Version = "1.12.0"
+
+// Namespace contains the original fields of the event.
+const Namespace = "honeytrap"
+
+// fields maps the fields of honeytrap events to ECS fields.
+var fields = map[string]string{
+	"id":      "event.id",
+	"date":    "@timestamp",
+	"message": "message",
+
+	"category": "event.category",
+	"type":     "event.action",
+	"sensor":   "event.provider",
+	"error":    "error.message",
+
+	"source-ip":                 "source.ip",
+	"source-port":               "source.port",
+	"source-mac":                "source.mac",
+	"source.hostname":           "source.domain",
+	"source.country.isocode":    "source.geo.country_iso_code",
+	"source.country.name":       "source.geo.country_name",
+	"source.city.name":          "source.geo.city_name",
+	"source.location.latitude":  "source.geo.location.lat",
+	"source.location.longitude": "source.geo.location.lon",
+	"source.as.number":          "source.as.number",
+	"source.as.organization":    "source.as.organization.name",
+
+	"destination-ip":   "destination.ip",
+	"destination-port": "destination.port",
+	"destination-mac":  "destination.mac",
+
+	"bytes-in":  "source.bytes",
+	"bytes-out": "destination.bytes",
+
+	"service":      "service.name",
+	"service-type": "service.type",
+
+	"sensor-name": "observer.name",
+	"sensor-tags": "tags",
+
+	"http.url":        "url.original",
+	"http.host":       "url.domain",
+	"http.method":     "http.request.method",
+	"http.user-agent": "user_agent.original",
+	"url":             "url.original",
+	"user-agent":      "user_agent.original",
+
+	"https.server-name": "tls.client.server_name",
+	"https.ja3-digest":  "tls.client.ja3",
+
+	"ssh.command":    "process.command_line",
+	"telnet.command": "process.command_line",
+
+	"smtp.from": "email.from.address",
+	"smtp.to":   "email.to.address",
+}
+
+// Convert returns a new event with the ECS fields, and the original fields
+// within the honeytrap namespace. The ECS fields are nested objects, eg.
+// source contains ip and port.
+func Convert(e event.Event) event.Event {
+	doc := map[string]interface{}{}
+	original := map[string]interface{}{}
+
+	e.Range(func(k, v interface{}) bool {
+		key, ok := k.(string)
+		if !ok {
+			return true
+		}
+
+		original[key] = v
+
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+
+		if name, ok := fields[key]; ok {
+			set(doc, name, v)
+		} else if strings.HasSuffix(key, ".username") {
+			set(doc, "user.name", v)
+		}
+
+		return true
+	})
+
+	if d, ok := e.Value("duration"); !ok {
+	} else if seconds, ok := d.(float64); ok {
+		// ECS durations are in nanoseconds
+		set(doc, "event.duration", int64(seconds*float64(time.Second)))
+	}
+
+	if protocol := networkProtocol(e); protocol != "" {
+		set(doc, "network.protocol", protocol)
+	}
+
+	set(doc, "event.kind", "event")
+	set(doc, "event.module", Namespace)
+	set(doc, "ecs.version", Version)
+
+	doc[Namespace] = original
+
+	x := event.New()
+	x.Delete("id")
+	x.Delete("date")
+
+	for k, v := range doc {
+		x.Store(k, v)
+	}
+
+	return x
+}
+
+// networkProtocol returns the application protocol of the event, the category
+// of events sent by services is their protocol, eg. ssh or http.
+func networkProtocol(e event.Event) string {
+	if e.Get("sensor") != "services" {
+		return ""
+	}
+
+	return strings.ToLower(e.Get("category"))
+}
+
+// set stores the value at the dotted path, creating the nested objects. An
+// existing value isn't replaced.
+func set(doc map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := doc[part].(map[string]interface{})
+		if !ok {
+			if _, exists := doc[part]; exists {
+				return
+			}
+
+			child = map[string]interface{}{}
+			doc[part] = child
+		}
+
+		doc = child
+	}
+
+	if _, exists := doc[parts[len(parts)-1]]; exists {
+		return
+	}
+
+	doc[parts[len(parts)-1]] = v
+}
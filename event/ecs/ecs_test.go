@@ -0,0 +1,122 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ecs
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestConvert(t *testing.T) {
+	e := event.New(
+		event.Sensor("services"),
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.SourceAddr(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51234}),
+		event.DestinationAddr(&net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 22}),
+		event.Custom("ssh.username", "root"),
+		event.Custom("ssh.password", "admin"),
+		event.Custom("duration", 1.5),
+	)
+
+	data, err := json.Marshal(Convert(e))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"source":      map[string]interface{}{"ip": "192.0.2.1", "port": 51234.0},
+		"destination": map[string]interface{}{"ip": "198.51.100.1", "port": 22.0},
+		"user":        map[string]interface{}{"name": "root"},
+		"network":     map[string]interface{}{"protocol": "ssh"},
+		"ecs":         map[string]interface{}{"version": Version},
+	}
+
+	for k, v := range expected {
+		if !reflect.DeepEqual(doc[k], v) {
+			t.Errorf("Expected %s to be %v, got %v", k, v, doc[k])
+		}
+	}
+
+	ev := doc["event"].(map[string]interface{})
+	if ev["category"] != "ssh" || ev["action"] != "password-authentication" || ev["module"] != Namespace || ev["duration"] != 1.5e9 {
+		t.Errorf("Unexpected event fields: %v", ev)
+	}
+
+	if _, ok := doc["@timestamp"]; !ok {
+		t.Errorf("Expected @timestamp")
+	}
+
+	if _, ok := doc["date"]; ok {
+		t.Errorf("Expected date to be within the namespace only")
+	}
+
+	if _, ok := doc["id"]; ok || ev["id"] != e.ID() {
+		t.Errorf("Expected id %s as event.id, got %v", e.ID(), ev["id"])
+	}
+
+	original := doc[Namespace].(map[string]interface{})
+	if original["ssh.password"] != "admin" || original["source-ip"] != "192.0.2.1" {
+		t.Errorf("Expected original fields within namespace, got %v", original)
+	}
+}
+
+func TestConvertConnection(t *testing.T) {
+	e := event.New(
+		event.Sensor("CONNECTION"),
+		event.Category("connection"),
+		event.Custom("bytes-in", 10),
+		event.Custom("http.url", "/index.html"),
+	)
+
+	x := Convert(e)
+
+	if v, _ := x.Value("network"); v != nil {
+		t.Errorf("Expected no network protocol for connection events, got %v", v)
+	}
+
+	if v, _ := x.Value("source"); !reflect.DeepEqual(v, map[string]interface{}{"bytes": 10}) {
+		t.Errorf("Unexpected source: %v", v)
+	}
+
+	if v, _ := x.Value("url"); !reflect.DeepEqual(v, map[string]interface{}{"original": "/index.html"}) {
+		t.Errorf("Unexpected url: %v", v)
+	}
+}
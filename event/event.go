@@ -56,6 +56,7 @@ var (
 	ServiceStarted       = Type("SERVICE:STARTED")
 	ConnectionOpened     = Type("CONNECTION:OPENED")
 	ConnectionClosed     = Type("CONNECTION:CLOSED")
+	ConnectionThrottled  = Type("CONNECTION:THROTTLED")
 	UserSessionOpened    = Type("SESSION:USER:OPENED")
 	UserSessionClosed    = Type("SESSION:USER:CLOSED")
 	ConnectionReadError  = Type("CONNECTION:ERROR:READ")
@@ -125,6 +126,32 @@ func NewWith(opts ...Option) Option {
 	}
 }
 
+// ParentID links the event to the event it was derived from.
+func ParentID(id string) Option {
+	return func(m Event) {
+		m.Store("parent-id", id)
+	}
+}
+
+// SessionID sets the session the event is part of.
+func SessionID(id string) Option {
+	return func(m Event) {
+		m.Store("session-id", id)
+	}
+}
+
+// ChildOf derives the event from the parent event, the event will be linked
+// to the parent and is part of the same session as the parent.
+func ChildOf(parent Event) Option {
+	return func(m Event) {
+		m.Store("parent-id", parent.ID())
+
+		if id := parent.Get("session-id"); id != "" {
+			m.Store("session-id", id)
+		}
+	}
+}
+
 // Token adds the provided token into the giving Event.
 func Token(token string) Option {
 	return func(m Event) {
@@ -153,6 +180,13 @@ func Type(s string) Option {
 	}
 }
 
+// Severity returns an option for setting the severity value.
+func Severity(s string) Option {
+	return func(m Event) {
+		m.Store("severity", s)
+	}
+}
+
 // Sensor returns an option for setting the sensor value.
 func Sensor(s string) Option {
 	return func(m Event) {
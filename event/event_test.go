@@ -0,0 +1,69 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package event
+
+import (
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	a, b := New(), New()
+
+	if a.ID() == "" || a.ID() == b.ID() {
+		t.Fatalf("Expected unique ids, got %q and %q", a.ID(), b.ID())
+	}
+
+	if a.ID() >= b.ID() {
+		t.Errorf("Expected id %s to sort before %s", a.ID(), b.ID())
+	}
+
+	if !a.Has("date") {
+		t.Errorf("Expected date to be set at creation")
+	}
+}
+
+func TestChildOf(t *testing.T) {
+	session := New(SessionID("session"))
+
+	parent := New(ChildOf(session))
+	if parent.Get("parent-id") != session.ID() || parent.Get("session-id") != "session" {
+		t.Errorf("Expected parent %s within session, got %s %s", session.ID(), parent.Get("parent-id"), parent.Get("session-id"))
+	}
+
+	child := New(ChildOf(parent))
+	if child.Get("parent-id") != parent.ID() || child.Get("session-id") != "session" {
+		t.Errorf("Expected parent %s within session, got %s %s", parent.ID(), child.Get("parent-id"), child.Get("session-id"))
+	}
+
+	if orphan := New(ChildOf(New())); orphan.Has("session-id") {
+		t.Errorf("Expected no session for the child of an event without session")
+	}
+}
@@ -0,0 +1,550 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package expr implements boolean expressions on event fields, used to
+// filter events.
+//
+// Fields are referenced by their name, eg. source-ip or ssh.username, and can be
+// compared to strings, numbers and booleans using ==, !=, <, <=, > and >=,
+// matched against regular expressions using =~ and !~, or checked against a
+// list using in. A field on its own is true if the field exists. Expressions
+// can be combined using &&, || and !, and grouped using parentheses. The
+// functions exists(field) and cidr(field, "network"...) are available as well.
+// Double quoted strings support Go escapes, single quoted strings are taken
+// literally, which is convenient for regular expressions.
+//
+//    category == "ssh" && type == "password-authentication" && !cidr(source-ip, "10.0.0.0/8")
+//    destination-port in [22, 2222] && bytes-in > 1024
+package expr
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Error is a compile error of an expression.
+type Error struct {
+	Pos     int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos+1, e.Message)
+}
+
+// Expression is a compiled expression.
+type Expression struct {
+	src  string
+	root predicate
+}
+
+// predicate evaluates a boolean expression on the event.
+type predicate func(event.Event) bool
+
+// operand returns the value of a field or literal.
+type operand struct {
+	field   string
+	literal *value
+}
+
+func (o operand) value(e event.Event) (value, bool) {
+	if o.literal != nil {
+		return *o.literal, true
+	}
+
+	v, ok := e.Value(o.field)
+	if !ok {
+		return value{}, false
+	}
+
+	return newValue(v), true
+}
+
+// value is a field or literal value, with its numeric representation if it
+// has one.
+type value struct {
+	s       string
+	n       float64
+	numeric bool
+}
+
+func newValue(v interface{}) value {
+	switch x := v.(type) {
+	case string:
+		n, err := strconv.ParseFloat(x, 64)
+		return value{s: x, n: n, numeric: err == nil}
+	case int:
+		return value{s: strconv.Itoa(x), n: float64(x), numeric: true}
+	case int8, int16, int32, int64:
+		n, _ := strconv.ParseFloat(fmt.Sprint(x), 64)
+		return value{s: fmt.Sprint(x), n: n, numeric: true}
+	case uint, uint8, uint16, uint32, uint64:
+		n, _ := strconv.ParseFloat(fmt.Sprint(x), 64)
+		return value{s: fmt.Sprint(x), n: n, numeric: true}
+	case float32:
+		return value{s: fmt.Sprint(x), n: float64(x), numeric: true}
+	case float64:
+		return value{s: fmt.Sprint(x), n: x, numeric: true}
+	case fmt.Stringer:
+		return newValue(x.String())
+	default:
+		return value{s: fmt.Sprint(x)}
+	}
+}
+
+// compare returns -1, 0 or 1, numeric if both values are numeric.
+func compare(a, b value) int {
+	if a.numeric && b.numeric {
+		switch {
+		case a.n < b.n:
+			return -1
+		case a.n > b.n:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a.s, b.s)
+}
+
+// Compile parses the expression.
+func Compile(s string) (*Expression, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, &Error{t.pos, fmt.Sprintf("unexpected %s", t)}
+	}
+
+	return &Expression{
+		src:  s,
+		root: root,
+	}, nil
+}
+
+// MustCompile parses the expression and panics on errors.
+func MustCompile(s string) *Expression {
+	x, err := Compile(s)
+	if err != nil {
+		panic(fmt.Sprintf("expr: compiling %q: %s", s, err.Error()))
+	}
+
+	return x
+}
+
+// Eval returns if the event matches the expression.
+func (x *Expression) Eval(e event.Event) bool {
+	return x.root(e)
+}
+
+func (x *Expression) String() string {
+	return x.src
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) isOperator(op string) bool {
+	t := p.peek()
+	return t.typ == tokenOperator && t.value == op
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.typ != tokenOperator || t.value != op {
+		return &Error{t.pos, fmt.Sprintf("expected '%s', got %s", op, t)}
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("||") {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(e event.Event) bool {
+			return l(e) || right(e)
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("&&") {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(e event.Event) bool {
+			return l(e) && right(e)
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (predicate, error) {
+	if p.isOperator("!") {
+		p.next()
+
+		pred, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(e event.Event) bool {
+			return !pred(e)
+		}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (predicate, error) {
+	t := p.peek()
+
+	if p.isOperator("(") {
+		p.next()
+
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+
+		return pred, nil
+	}
+
+	if t.typ == tokenIdent && (t.value == "true" || t.value == "false") {
+		p.next()
+
+		result := t.value == "true"
+		return func(event.Event) bool {
+			return result
+		}, nil
+	}
+
+	if t.typ == tokenIdent && p.tokens[p.pos+1].typ == tokenOperator && p.tokens[p.pos+1].value == "(" {
+		return p.parseCall()
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+
+	if op.typ == tokenIdent && op.value == "in" {
+		p.next()
+		return p.parseIn(left)
+	}
+
+	switch {
+	case op.typ != tokenOperator:
+	case op.value == "=~" || op.value == "!~":
+		p.next()
+
+		rt := p.next()
+		if rt.typ != tokenString {
+			return nil, &Error{rt.pos, fmt.Sprintf("expected regular expression, got %s", rt)}
+		}
+
+		rx, err := regexp.Compile(rt.value)
+		if err != nil {
+			return nil, &Error{rt.pos, fmt.Sprintf("invalid regular expression: %s", err.Error())}
+		}
+
+		negate := op.value == "!~"
+		return func(e event.Event) bool {
+			v, ok := left.value(e)
+			if !ok {
+				return negate
+			}
+
+			return rx.MatchString(v.s) != negate
+		}, nil
+	case comparators[op.value] != nil:
+		p.next()
+
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		cmp := comparators[op.value]
+		return func(e event.Event) bool {
+			a, ok := left.value(e)
+			if !ok {
+				// a missing field is unequal to everything
+				return op.value == "!="
+			}
+
+			b, ok := right.value(e)
+			if !ok {
+				return op.value == "!="
+			}
+
+			return cmp(compare(a, b))
+		}, nil
+	}
+
+	if left.field == "" {
+		return nil, &Error{t.pos, fmt.Sprintf("expected comparison after %s", t)}
+	}
+
+	// a field on its own checks for existence
+	field := left.field
+	return func(e event.Event) bool {
+		return e.Has(field)
+	}, nil
+}
+
+var comparators = map[string]func(int) bool{
+	"==": func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+
+	switch t.typ {
+	case tokenIdent:
+		if t.value == "true" || t.value == "false" {
+			return operand{literal: &value{s: t.value}}, nil
+		}
+
+		return operand{field: t.value}, nil
+	case tokenString:
+		v := newValue(t.value)
+		return operand{literal: &v}, nil
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return operand{}, &Error{t.pos, fmt.Sprintf("invalid number %s", t.value)}
+		}
+
+		return operand{literal: &value{s: t.value, n: n, numeric: true}}, nil
+	default:
+		return operand{}, &Error{t.pos, fmt.Sprintf("expected field or value, got %s", t)}
+	}
+}
+
+// parseIn parses the list of the in operator.
+func (p *parser) parseIn(left operand) (predicate, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+
+	values := []value{}
+
+	for !p.isOperator("]") {
+		if len(values) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		o, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if o.literal == nil {
+			return nil, &Error{p.tokens[p.pos-1].pos, "expected value in list"}
+		}
+
+		values = append(values, *o.literal)
+	}
+
+	p.next()
+
+	return func(e event.Event) bool {
+		v, ok := left.value(e)
+		if !ok {
+			return false
+		}
+
+		for _, item := range values {
+			if compare(v, item) == 0 {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// parseArgs parses the arguments of a function call.
+func (p *parser) parseArgs() ([]operand, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	args := []operand{}
+
+	for !p.isOperator(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		o, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, o)
+	}
+
+	p.next()
+
+	return args, nil
+}
+
+func (p *parser) parseCall() (predicate, error) {
+	t := p.next()
+
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.value {
+	case "exists":
+		if len(args) != 1 || args[0].field == "" {
+			return nil, &Error{t.pos, "exists expects a single field"}
+		}
+
+		field := args[0].field
+		return func(e event.Event) bool {
+			return e.Has(field)
+		}, nil
+	case "cidr":
+		if len(args) < 2 || args[0].field == "" {
+			return nil, &Error{t.pos, "cidr expects a field and one or more networks"}
+		}
+
+		networks := []*net.IPNet{}
+		for _, arg := range args[1:] {
+			if arg.literal == nil {
+				return nil, &Error{t.pos, "cidr expects networks as strings"}
+			}
+
+			_, network, err := net.ParseCIDR(arg.literal.s)
+			if err != nil {
+				return nil, &Error{t.pos, fmt.Sprintf("invalid network %s", arg.literal.s)}
+			}
+
+			networks = append(networks, network)
+		}
+
+		field := args[0]
+		return func(e event.Event) bool {
+			v, ok := field.value(e)
+			if !ok {
+				return false
+			}
+
+			ip := net.ParseIP(v.s)
+			if ip == nil {
+				return false
+			}
+
+			for _, network := range networks {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+
+			return false
+		}, nil
+	default:
+		return nil, &Error{t.pos, fmt.Sprintf("unknown function %s", t.value)}
+	}
+}
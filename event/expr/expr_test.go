@@ -0,0 +1,128 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func testEvent() event.Event {
+	return event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.Custom("source-ip", "192.168.1.10"),
+		event.Custom("destination-port", 22),
+		event.Custom("ssh.username", "root"),
+		event.Custom("ssh.password", "admin123"),
+		event.Custom("ssh.authenticated", true),
+	)
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`category == "ssh" && type == "password-authentication" && !cidr(source-ip, "10.0.0.0/8")`, true},
+		{`category == "ssh" && cidr(source-ip, "10.0.0.0/8", "192.168.0.0/16")`, true},
+		{`category == "http" || ssh.username == "root"`, true},
+		{`!(category == "ssh")`, false},
+		{`destination-port == 22`, true},
+		{`destination-port > 1024`, false},
+		{`destination-port >= 22 && destination-port < 23`, true},
+		{`destination-port in [22, 2222]`, true},
+		{`ssh.username in ["admin", "test"]`, false},
+		{`ssh.password =~ '^admin\d+$'`, true},
+		{`ssh.password !~ "^root"`, true},
+		{`ssh.username`, true},
+		{`http.url`, false},
+		{`exists(ssh.password) && !exists(http.url)`, true},
+		{`http.url == ""`, false},
+		{`http.url != "/"`, true},
+		{`true && !false`, true},
+		{`ssh.authenticated == true`, true},
+		{`ssh.authenticated != false`, true},
+		{`category == 'ssh' && (type == "foo" || type == 'password-authentication')`, true},
+	}
+
+	e := testEvent()
+
+	for _, tc := range tests {
+		x, err := Compile(tc.expr)
+		if err != nil {
+			t.Errorf("Compile(%s): unexpected error: %s", tc.expr, err.Error())
+			continue
+		}
+
+		if got := x.Eval(e); got != tc.expected {
+			t.Errorf("Eval(%s): expected %t, got %t", tc.expr, tc.expected, got)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{`category == `, 12},
+		{`category == "ssh" &&`, 20},
+		{`(category == "ssh"`, 18},
+		{`category = "ssh"`, 9},
+		{`category == "ssh`, 12},
+		{`cidr(source-ip, "10.0.0.0/33")`, 0},
+		{`unknown(source-ip)`, 0},
+		{`ssh.password =~ "("`, 16},
+		{`port in [22, port]`, 13},
+		{`"ssh"`, 0},
+		{`category == "ssh" category`, 18},
+	}
+
+	for _, tc := range tests {
+		_, err := Compile(tc.expr)
+		if err == nil {
+			t.Errorf("Compile(%s): expected error", tc.expr)
+			continue
+		}
+
+		xerr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Compile(%s): expected *Error, got %T", tc.expr, err)
+			continue
+		}
+
+		if xerr.Pos != tc.pos {
+			t.Errorf("Compile(%s): expected error at %d, got %d (%s)", tc.expr, tc.pos, xerr.Pos, xerr.Error())
+		}
+	}
+}
@@ -0,0 +1,163 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	typ   tokenType
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.value)
+	default:
+		return fmt.Sprintf("'%s'", t.value)
+	}
+}
+
+// operators ordered by length, so the longest operator matches first
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "=~", "!~",
+	"(", ")", "[", "]", ",", "!", "<", ">",
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdent(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
+
+// lex splits the expression into tokens.
+func lex(s string) ([]token, error) {
+	tokens := []token{}
+
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case isIdentStart(r):
+			start := i
+			for i < len(runes) && isIdent(runes[i]) {
+				i++
+			}
+
+			tokens = append(tokens, token{tokenIdent, string(runes[start:i]), start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i]), start})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+
+			escaped := false
+			for ; i < len(runes); i++ {
+				if escaped {
+					escaped = false
+				} else if runes[i] == '\\' {
+					escaped = true
+				} else if runes[i] == r {
+					break
+				}
+			}
+
+			if i >= len(runes) {
+				return nil, &Error{start, "unterminated string"}
+			}
+
+			i++
+
+			value := string(runes[start+1 : i-1])
+			if r == '"' {
+				v, err := strconv.Unquote(string(runes[start:i]))
+				if err != nil {
+					return nil, &Error{start, fmt.Sprintf("invalid string: %s", err.Error())}
+				}
+
+				value = v
+			}
+
+			tokens = append(tokens, token{tokenString, value, start})
+		default:
+			found := false
+
+			for _, op := range operators {
+				if !strings.HasPrefix(string(runes[i:]), op) {
+					continue
+				}
+
+				tokens = append(tokens, token{tokenOperator, op, i})
+				i += len([]rune(op))
+
+				found = true
+				break
+			}
+
+			if !found {
+				return nil, &Error{i, fmt.Sprintf("unexpected character '%c'", r)}
+			}
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(runes)}), nil
+}
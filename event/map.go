@@ -34,6 +34,8 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/rs/xid"
 )
 
 // Event defines a object which adds key-value pairs into a map type for event data.
@@ -54,12 +56,14 @@ func (e Event) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
-// New returns a new Event with the options applied.
+// New returns a new Event with the options applied. Every event gets an unique
+// id, which sorts by the time the event was created, and the creation date.
 func New(opts ...Option) Event {
 	e := Event{
 		sm: new(sync.Map),
 	}
 
+	e.sm.Store("id", xid.New().String())
 	e.sm.Store("date", time.Now())
 
 	for _, opt := range opts {
@@ -73,6 +77,11 @@ func New(opts ...Option) Event {
 	return e
 }
 
+// ID returns the unique id of the event.
+func (e Event) ID() string {
+	return e.Get("id")
+}
+
 // Range defines a function which ranges the underline key-values with
 // the provided syncmap.
 func (e Event) Range(fx func(interface{}, interface{}) bool) {
@@ -84,12 +93,22 @@ func (e Event) Store(s string, v interface{}) {
 	e.sm.Store(s, v)
 }
 
+// Delete removes the key from the event.
+func (e Event) Delete(s string) {
+	e.sm.Delete(s)
+}
+
 // Has returns true/false if the giving key exists.
 func (e Event) Has(s string) bool {
 	_, ok := e.sm.Load(s)
 	return ok
 }
 
+// Value returns the value of the key, and if the key exists.
+func (e Event) Value(s string) (interface{}, bool) {
+	return e.sm.Load(s)
+}
+
 // Get retrieves a giving value for a key has string.
 func (e Event) Get(s string) string {
 	if v, ok := e.sm.Load(s); !ok {
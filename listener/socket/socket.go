@@ -33,11 +33,16 @@ package network
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/honeytrap/honeytrap/listener"
 	logging "github.com/op/go-logging"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 var log = logging.MustGetLogger("listeners/socket")
@@ -51,15 +56,58 @@ type socketListener struct {
 
 	ch chan net.Conn
 
-	net.Listener
+	m       sync.Mutex
+	started bool
+
+	// closers contains the active listeners by address
+	closers map[string]io.Closer
 }
 
 type socketConfig struct {
 	Addresses []net.Addr
 }
 
-func (sc *socketConfig) AddAddress(a net.Addr) {
-	sc.Addresses = append(sc.Addresses, a)
+func key(a net.Addr) string {
+	return a.Network() + "/" + a.String()
+}
+
+// AddAddress adds the address to the listener, if the listener has been
+// started already it will start listening immediately.
+func (sl *socketListener) AddAddress(a net.Addr) {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	sl.Addresses = append(sl.Addresses, a)
+
+	if !sl.started {
+		return
+	}
+
+	sl.listen(a)
+}
+
+// RemoveAddress will stop listening on the address.
+func (sl *socketListener) RemoveAddress(a net.Addr) {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	addresses := []net.Addr{}
+	for _, address := range sl.Addresses {
+		if key(address) == key(a) {
+			continue
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	sl.Addresses = addresses
+
+	if c, ok := sl.closers[key(a)]; ok {
+		c.Close()
+		delete(sl.closers, key(a))
+
+		log.Infof("Listener stopped: %s/%s", a.Network(), a)
+	}
 }
 
 func New(options ...func(listener.Listener) error) (listener.Listener, error) {
@@ -68,6 +116,7 @@ func New(options ...func(listener.Listener) error) (listener.Listener, error) {
 	l := socketListener{
 		socketConfig: socketConfig{},
 		ch:           ch,
+		closers:      map[string]io.Closer{},
 	}
 
 	for _, option := range options {
@@ -77,58 +126,131 @@ func New(options ...func(listener.Listener) error) (listener.Listener, error) {
 	return &l, nil
 }
 
-func (sl *socketListener) Start(ctx context.Context) error {
-	for _, address := range sl.Addresses {
-		if _, ok := address.(*net.TCPAddr); ok {
-			l, err := net.Listen(address.Network(), address.String())
-			if err != nil {
-				fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
-				continue
-			}
+func (sl *socketListener) listen(address net.Addr) {
+	if _, ok := address.(*net.TCPAddr); ok {
+		l, err := net.Listen(address.Network(), address.String())
+		if err != nil {
+			fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
+			return
+		}
 
-			log.Infof("Listener started: tcp/%s", address)
+		sl.closers[key(address)] = l
 
-			go func() {
-				for {
-					c, err := l.Accept()
-					if err != nil {
-						log.Errorf("Error accepting connection: %s", err.Error())
-						continue
-					}
+		log.Infof("Listener started: tcp/%s", address)
 
-					sl.ch <- c
+		go func() {
+			for {
+				c, err := l.Accept()
+				if isClosed(err) {
+					return
+				} else if err != nil {
+					log.Errorf("Error accepting connection: %s", err.Error())
+					continue
 				}
-			}()
-		} else if ua, ok := address.(*net.UDPAddr); ok {
-			l, err := net.ListenUDP(address.Network(), ua)
-			if err != nil {
-				fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
-				continue
+
+				sl.ch <- c
 			}
+		}()
+	} else if ua, ok := address.(*net.UDPAddr); ok {
+		l, err := net.ListenUDP(address.Network(), ua)
+		if err != nil {
+			fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
+			return
+		}
+
+		sl.closers[key(address)] = l
 
-			log.Infof("Listener started: udp/%s", address)
+		log.Infof("Listener started: udp/%s", address)
 
-			go func() {
-				for {
-					var buf [65535]byte
+		read := readUDP(l, ua)
 
-					n, raddr, err := l.ReadFromUDP(buf[:])
-					if err != nil {
-						log.Error("Error reading udp:", err.Error())
-						continue
-					}
+		go func() {
+			for {
+				var buf [65535]byte
 
-					sl.ch <- &listener.DummyUDPConn{
-						Buffer: buf[:n],
-						Laddr:  ua,
-						Raddr:  raddr,
-						Fn:     l.WriteToUDP,
-					}
+				n, laddr, raddr, err := read(buf[:])
+				if isClosed(err) {
+					return
+				} else if err != nil {
+					log.Error("Error reading udp:", err.Error())
+					continue
 				}
-			}()
+
+				sl.ch <- &listener.DummyUDPConn{
+					Buffer: buf[:n],
+					Laddr:  laddr,
+					Raddr:  raddr,
+					Fn:     l.WriteToUDP,
+				}
+			}
+		}()
+	}
+}
+
+// readUDP returns a function reading a packet and its destination address,
+// which is needed to route packets received on a wildcard address. The
+// destination is read from the packet information, if the platform doesn't
+// support it the address of the socket is used.
+func readUDP(l *net.UDPConn, ua *net.UDPAddr) func([]byte) (int, *net.UDPAddr, *net.UDPAddr, error) {
+	laddr := func(dst net.IP) *net.UDPAddr {
+		if dst == nil {
+			return ua
+		}
+
+		return &net.UDPAddr{IP: dst, Port: ua.Port}
+	}
+
+	raddr := func(addr net.Addr) *net.UDPAddr {
+		a, _ := addr.(*net.UDPAddr)
+		return a
+	}
+
+	if p := ipv6.NewPacketConn(l); p.SetControlMessage(ipv6.FlagDst, true) == nil {
+		return func(b []byte) (int, *net.UDPAddr, *net.UDPAddr, error) {
+			n, cm, addr, err := p.ReadFrom(b)
+			if cm == nil {
+				return n, ua, raddr(addr), err
+			}
+
+			return n, laddr(cm.Dst), raddr(addr), err
+		}
+	}
+
+	if p := ipv4.NewPacketConn(l); p.SetControlMessage(ipv4.FlagDst, true) == nil {
+		return func(b []byte) (int, *net.UDPAddr, *net.UDPAddr, error) {
+			n, cm, addr, err := p.ReadFrom(b)
+			if cm == nil {
+				return n, ua, raddr(addr), err
+			}
+
+			return n, laddr(cm.Dst), raddr(addr), err
 		}
 	}
 
+	return func(b []byte) (int, *net.UDPAddr, *net.UDPAddr, error) {
+		n, addr, err := l.ReadFromUDP(b)
+		return n, ua, addr, err
+	}
+}
+
+// isClosed returns true if the error is caused by closing the listener.
+func isClosed(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+func (sl *socketListener) Start(ctx context.Context) error {
+	sl.m.Lock()
+	defer sl.m.Unlock()
+
+	for _, address := range sl.Addresses {
+		sl.listen(address)
+	}
+
+	sl.started = true
 	return nil
 }
 
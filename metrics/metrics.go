@@ -0,0 +1,383 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package metrics implements counters and gauges, exposed in the Prometheus
+// text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Label is a single label of a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric family.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family contains the samples of a single metric.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector returns the metric families when being scraped.
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc is a function implementing Collector.
+type CollectorFunc func() []Family
+
+// Collect calls the function.
+func (fn CollectorFunc) Collect() []Family {
+	return fn()
+}
+
+// Registry contains the collectors to be exposed.
+type Registry struct {
+	m          sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry used by Register and Handler.
+var Default = NewRegistry()
+
+// Register adds the collectors to the default registry.
+func Register(collectors ...Collector) {
+	Default.Register(collectors...)
+}
+
+// Handler returns the http handler serving the default registry.
+func Handler() http.Handler {
+	return Default
+}
+
+// Register adds the collectors to the registry.
+func (r *Registry) Register(collectors ...Collector) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Gather collects all families, families with the same name will be merged.
+func (r *Registry) Gather() []Family {
+	r.m.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.m.Unlock()
+
+	families := map[string]*Family{}
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			if existing, ok := families[f.Name]; ok {
+				existing.Samples = append(existing.Samples, f.Samples...)
+				continue
+			}
+
+			f := f
+			families[f.Name] = &f
+		}
+	}
+
+	result := make([]Family, 0, len(families))
+	for _, f := range families {
+		result = append(result, *f)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Write writes all families in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range r.Gather() {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, helpEscaper.Replace(f.Help))
+		}
+
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+
+			if len(s.Labels) > 0 {
+				labels := make([]string, len(s.Labels))
+				for i, l := range s.Labels {
+					labels[i] = fmt.Sprintf("%s=\"%s\"", l.Name, valueEscaper.Replace(l.Value))
+				}
+
+				fmt.Fprintf(bw, "{%s}", strings.Join(labels, ","))
+			}
+
+			fmt.Fprintf(bw, " %s\n", formatValue(s.Value))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP serves the families in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := r.Write(w); err != nil {
+		log.Errorf("Error writing metrics: %s", err.Error())
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return fmt.Sprintf("%g", v)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v uint64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+// Add increments the counter by n.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds v to the gauge.
+func (g *Gauge) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		nv := math.Float64bits(math.Float64frombits(old) + v)
+
+		if atomic.CompareAndSwapUint64(&g.bits, old, nv) {
+			return
+		}
+	}
+}
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// vec contains the values of a metric, by label values.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	m      sync.Mutex
+	keys   map[string][]string
+	values map[string]interface{}
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		keys:   map[string][]string{},
+		values: map[string]interface{}{},
+	}
+}
+
+func (v *vec) with(values []string, fn func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	if val, ok := v.values[key]; ok {
+		return val
+	}
+
+	val := fn()
+
+	v.keys[key] = append([]string{}, values...)
+	v.values[key] = val
+
+	return val
+}
+
+func (v *vec) collect(typ string, fn func(interface{}) float64) []Family {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	keys := make([]string, 0, len(v.keys))
+	for key := range v.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	f := Family{
+		Name:    v.name,
+		Help:    v.help,
+		Type:    typ,
+		Samples: make([]Sample, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		s := Sample{
+			Value: fn(v.values[key]),
+		}
+
+		for i, value := range v.keys[key] {
+			s.Labels = append(s.Labels, Label{v.labels[i], value})
+		}
+
+		f.Samples = append(f.Samples, s)
+	}
+
+	return []Family{f}
+}
+
+// CounterVec contains counters partitioned by label values.
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec returns a new counter vector with the label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		vec: newVec(name, help, labels),
+	}
+}
+
+// With returns the counter for the label values, in order of the label names.
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values, func() interface{} {
+		return &Counter{}
+	}).(*Counter)
+}
+
+// Collect returns the counters.
+func (cv *CounterVec) Collect() []Family {
+	return cv.collect("counter", func(v interface{}) float64 {
+		return float64(v.(*Counter).Value())
+	})
+}
+
+// GaugeVec contains gauges partitioned by label values.
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec returns a new gauge vector with the label names.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{
+		vec: newVec(name, help, labels),
+	}
+}
+
+// With returns the gauge for the label values, in order of the label names.
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.with(values, func() interface{} {
+		return &Gauge{}
+	}).(*Gauge)
+}
+
+// Collect returns the gauges.
+func (gv *GaugeVec) Collect() []Family {
+	return gv.collect("gauge", func(v interface{}) float64 {
+		return v.(*Gauge).Value()
+	})
+}
@@ -0,0 +1,114 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+
+	cv := NewCounterVec("test_events_total", "Number of events.", "channel")
+	cv.With("file").Inc()
+	cv.With("file").Add(2)
+	cv.With(`say "hi"`).Inc()
+
+	gv := NewGaugeVec("test_sessions", "Number of\nsessions.", "service")
+	gv.With("ssh").Inc()
+	gv.With("ssh").Inc()
+	gv.With("ssh").Dec()
+
+	r.Register(gv, cv)
+
+	buf := &bytes.Buffer{}
+	if err := r.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_events_total Number of events.
+# TYPE test_events_total counter
+test_events_total{channel="file"} 3
+test_events_total{channel="say \"hi\""} 1
+# HELP test_sessions Number of\nsessions.
+# TYPE test_sessions gauge
+test_sessions{service="ssh"} 1
+`
+
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestRegistryMerge(t *testing.T) {
+	r := NewRegistry()
+
+	for _, name := range []string{"a", "b"} {
+		name := name
+
+		r.Register(CollectorFunc(func() []Family {
+			gv := NewGaugeVec("test_queue_depth", "Queue depth.", "channel")
+			gv.With(name).Set(1.5)
+			return gv.Collect()
+		}))
+	}
+
+	families := r.Gather()
+	if len(families) != 1 || len(families[0].Samples) != 2 {
+		t.Fatalf("Expected a single family with 2 samples, got %+v", families)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected content type: %s", w.Header().Get("Content-Type"))
+	}
+
+	if !strings.Contains(w.Body.String(), "\ngo_goroutines ") {
+		t.Errorf("Expected runtime metrics, got:\n%s", w.Body.String())
+	}
+}
+
+func TestVecLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic on wrong number of label values")
+		}
+	}()
+
+	NewCounterVec("test_total", "", "a", "b").With("a")
+}
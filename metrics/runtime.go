@@ -0,0 +1,85 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package metrics
+
+import (
+	"runtime"
+	"time"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("metrics")
+
+var start = time.Now()
+
+func gauge(name, help string, v float64) Family {
+	return Family{
+		Name:    name,
+		Help:    help,
+		Type:    "gauge",
+		Samples: []Sample{{Value: v}},
+	}
+}
+
+func counter(name, help string, v float64) Family {
+	return Family{
+		Name:    name,
+		Help:    help,
+		Type:    "counter",
+		Samples: []Sample{{Value: v}},
+	}
+}
+
+// RuntimeCollector collects the Go runtime statistics.
+var RuntimeCollector = CollectorFunc(func() []Family {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	return []Family{
+		gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())),
+		gauge("go_threads", "Number of OS threads created.", float64(threads)),
+		gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(ms.Alloc)),
+		counter("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(ms.TotalAlloc)),
+		gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(ms.Sys)),
+		gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(ms.HeapInuse)),
+		gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(ms.HeapObjects)),
+		counter("go_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC)),
+		gauge("go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", float64(ms.LastGC)/1e9),
+		gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(start.UnixNano())/1e9),
+	}
+})
+
+func init() {
+	Register(RuntimeCollector)
+}
@@ -0,0 +1,217 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// DefaultAggregateMaxValues is the maximum number of distinct values kept of
+// every field when not configured.
+const DefaultAggregateMaxValues = 100
+
+// AggregateConfig defines how events are grouped by the aggregating channel.
+type AggregateConfig struct {
+	// Key contains the fields of which the values form the key of the group,
+	// eg. source-ip, category and type
+	Key []string
+	// Window is the duration a group collects events, starting at the first event
+	Window time.Duration
+	// Fields contains the fields of which the distinct values are collected
+	Fields []string
+	// MaxValues limits the number of distinct values kept of every field
+	MaxValues int
+}
+
+// group contains the events with the same key within a window.
+type group struct {
+	key   string
+	first event.Event
+	count int
+
+	firstSeen time.Time
+	lastSeen  time.Time
+
+	values map[string][]string
+
+	timer *time.Timer
+}
+
+type aggregateChannel struct {
+	Channel
+
+	config AggregateConfig
+
+	m      sync.Mutex
+	groups map[string]*group
+	closed bool
+}
+
+// AggregateChannel returns a Channel which groups events with the same key
+// within the window, and delivers a single summary event per group when the
+// window ends. The summary contains the fields of the first event, and the
+// count, first and last seen times and distinct values of the fields within the
+// aggregate namespace.
+func AggregateChannel(channel Channel, config AggregateConfig) Channel {
+	if config.MaxValues <= 0 {
+		config.MaxValues = DefaultAggregateMaxValues
+	}
+
+	return &aggregateChannel{
+		Channel: channel,
+		config:  config,
+		groups:  map[string]*group{},
+	}
+}
+
+func (ac *aggregateChannel) key(e event.Event) string {
+	values := make([]string, len(ac.config.Key))
+	for i, field := range ac.config.Key {
+		if v, ok := e.Value(field); ok {
+			values[i] = fmt.Sprint(v)
+		}
+	}
+
+	return strings.Join(values, "+")
+}
+
+// Send adds the event to its group, starting a new group if there is none.
+func (ac *aggregateChannel) Send(e event.Event) {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	if ac.closed {
+		ac.Channel.Send(e)
+		return
+	}
+
+	key := ac.key(e)
+	now := time.Now()
+
+	g, ok := ac.groups[key]
+	if !ok {
+		g = &group{
+			key:       key,
+			first:     e,
+			firstSeen: now,
+			values:    map[string][]string{},
+		}
+
+		ac.groups[key] = g
+
+		g.timer = time.AfterFunc(ac.config.Window, func() {
+			ac.m.Lock()
+			defer ac.m.Unlock()
+
+			if ac.groups[key] != g {
+				return
+			}
+
+			ac.emit(g)
+		})
+	}
+
+	g.count++
+	g.lastSeen = now
+
+	for _, field := range ac.config.Fields {
+		v, ok := e.Value(field)
+		if !ok {
+			continue
+		}
+
+		s := fmt.Sprint(v)
+
+		values := g.values[field]
+		if len(values) >= ac.config.MaxValues || contains(values, s) {
+			continue
+		}
+
+		g.values[field] = append(values, s)
+	}
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// emit removes the group and delivers its summary, the lock must be held.
+func (ac *aggregateChannel) emit(g *group) {
+	delete(ac.groups, g.key)
+
+	// the summary is a new event, linked to the first event of the group
+	fields := event.ToMap(g.first)
+	delete(fields, "id")
+
+	options := []event.Option{
+		event.CopyFrom(fields),
+		event.ParentID(g.first.ID()),
+		event.Custom("aggregate.key", g.key),
+		event.Custom("aggregate.count", g.count),
+		event.Custom("aggregate.first-seen", g.firstSeen),
+		event.Custom("aggregate.last-seen", g.lastSeen),
+	}
+
+	for _, field := range ac.config.Fields {
+		if values, ok := g.values[field]; ok {
+			options = append(options, event.Custom("aggregate."+field, values))
+		}
+	}
+
+	ac.Channel.Send(event.New(options...))
+}
+
+// Close delivers the summaries of the groups, events sent afterwards are
+// delivered without aggregating. The channel itself isn't closed, as it
+// can be shared with other filters.
+func (ac *aggregateChannel) Close() error {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	for _, g := range ac.groups {
+		g.timer.Stop()
+		ac.emit(g)
+	}
+
+	ac.closed = true
+	return nil
+}
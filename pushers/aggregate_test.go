@@ -0,0 +1,153 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type captureChannel chan event.Event
+
+func (cc captureChannel) Send(e event.Event) {
+	cc <- e
+}
+
+func TestAggregateChannel(t *testing.T) {
+	cc := make(captureChannel, 10)
+
+	ac := AggregateChannel(cc, AggregateConfig{
+		Key:    []string{"source-ip", "type"},
+		Window: 50 * time.Millisecond,
+		Fields: []string{"ssh.username", "ssh.password"},
+	})
+
+	first := ""
+
+	for _, credentials := range [][2]string{{"root", "root"}, {"root", "admin"}, {"admin", "admin"}} {
+		e := event.New(
+			event.Type("password-authentication"),
+			event.Custom("source-ip", "192.0.2.1"),
+			event.Custom("ssh.username", credentials[0]),
+			event.Custom("ssh.password", credentials[1]),
+		)
+
+		if first == "" {
+			first = e.ID()
+		}
+
+		ac.Send(e)
+	}
+
+	ac.Send(event.New(
+		event.Type("password-authentication"),
+		event.Custom("source-ip", "192.0.2.2"),
+	))
+
+	summaries := map[string]event.Event{}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-cc:
+			summaries[e.Get("source-ip")] = e
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 2 summaries, got %d", i)
+		}
+	}
+
+	e := summaries["192.0.2.1"]
+
+	if v, _ := e.Value("aggregate.count"); v != 3 {
+		t.Errorf("Expected count 3, got %v", v)
+	}
+
+	if v, _ := e.Value("aggregate.ssh.username"); !reflect.DeepEqual(v, []string{"root", "admin"}) {
+		t.Errorf("Unexpected usernames: %v", v)
+	}
+
+	if v, _ := e.Value("aggregate.ssh.password"); !reflect.DeepEqual(v, []string{"root", "admin"}) {
+		t.Errorf("Unexpected passwords: %v", v)
+	}
+
+	if got := e.Get("ssh.username"); got != "root" {
+		t.Errorf("Expected fields of the first event, got username %q", got)
+	}
+
+	if e.ID() == first || e.Get("parent-id") != first {
+		t.Errorf("Expected a new event with parent %s, got id %s and parent %s", first, e.ID(), e.Get("parent-id"))
+	}
+
+	if v, _ := summaries["192.0.2.2"].Value("aggregate.count"); v != 1 {
+		t.Errorf("Expected count 1, got %v", v)
+	}
+}
+
+func TestAggregateChannelClose(t *testing.T) {
+	cc := make(captureChannel, 10)
+
+	ac := AggregateChannel(cc, AggregateConfig{
+		Key:       []string{"source-ip"},
+		Window:    time.Hour,
+		Fields:    []string{"ssh.username"},
+		MaxValues: 1,
+	})
+
+	ac.Send(event.New(event.Custom("source-ip", "192.0.2.1"), event.Custom("ssh.username", "root")))
+	ac.Send(event.New(event.Custom("source-ip", "192.0.2.1"), event.Custom("ssh.username", "admin")))
+
+	if err := Shutdown(ac); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-cc:
+		if v, _ := e.Value("aggregate.ssh.username"); !reflect.DeepEqual(v, []string{"root"}) {
+			t.Errorf("Expected values to be limited, got %v", v)
+		}
+	default:
+		t.Fatal("Expected summary when closing")
+	}
+
+	// events after closing are delivered as is
+	ac.Send(event.New(event.Custom("source-ip", "192.0.2.1")))
+
+	select {
+	case e := <-cc:
+		if e.Has("aggregate.count") {
+			t.Errorf("Expected event without aggregation")
+		}
+	default:
+		t.Fatal("Expected event to be delivered after closing")
+	}
+}
@@ -31,6 +31,8 @@
 package pushers
 
 import (
+	"sync/atomic"
+
 	"github.com/BurntSushi/toml"
 	"github.com/honeytrap/honeytrap/event"
 )
@@ -41,6 +43,135 @@ type Channel interface {
 	Send(event.Event)
 }
 
+// Flusher defines an interface for channels that buffer events, Flush blocks
+// until all buffered events have been delivered.
+type Flusher interface {
+	Flush() error
+}
+
+// Closer defines an interface for channels that need to deliver queued
+// events and release resources before shutting down.
+type Closer interface {
+	Close() error
+}
+
+// Stats contains the delivery statistics of a channel.
+type Stats struct {
+	// Queued is the number of events waiting to be delivered
+	Queued int
+	// Errors is the number of events that failed to be delivered
+	Errors uint64
+	// Dropped is the number of events that have been discarded
+	Dropped uint64
+}
+
+// Deliverer defines an interface for channels that deliver events
+// synchronously, Deliver returns when the events have been accepted by the
+// backend or the delivery failed.
+type Deliverer interface {
+	Deliver([]event.Event) error
+}
+
+// StatsReporter defines an interface for channels that report their
+// delivery statistics.
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// Counters keeps track of the errors and dropped events of a channel, it is
+// safe for concurrent use.
+type Counters struct {
+	errors  uint64
+	dropped uint64
+}
+
+// AddErrors adds n events that failed to be delivered.
+func (c *Counters) AddErrors(n int) {
+	atomic.AddUint64(&c.errors, uint64(n))
+}
+
+// AddDropped adds n events that have been discarded.
+func (c *Counters) AddDropped(n int) {
+	atomic.AddUint64(&c.dropped, uint64(n))
+}
+
+// Stats returns the statistics with the current counters.
+func (c *Counters) Stats(queued int) Stats {
+	return Stats{
+		Queued:  queued,
+		Errors:  atomic.LoadUint64(&c.errors),
+		Dropped: atomic.LoadUint64(&c.dropped),
+	}
+}
+
+// Shutdown flushes and closes the channel if it implements Flusher or Closer.
+// The channel is closed when flushing fails, the flush error is returned.
+func Shutdown(channel Channel) error {
+	var err error
+
+	if f, ok := channel.(Flusher); ok {
+		err = f.Flush()
+	}
+
+	if c, ok := channel.(Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// EventsSetter defines an interface for channels that send events of their
+// own, like changes of the connection state.
+type EventsSetter interface {
+	SetEvents(Channel)
+}
+
+// WithEvents sets the channel the events of the channel are sent to.
+func WithEvents(events Channel) func(Channel) error {
+	return func(c Channel) error {
+		if es, ok := c.(EventsSetter); ok {
+			es.SetEvents(events)
+		}
+
+		return nil
+	}
+}
+
+// DataDirSetter defines an interface for channels that store files in the
+// data directory.
+type DataDirSetter interface {
+	SetDataDir(string)
+}
+
+// WithDataDir sets the data directory of the channel.
+func WithDataDir(dataDir string) func(Channel) error {
+	return func(c Channel) error {
+		if sd, ok := c.(DataDirSetter); ok {
+			sd.SetDataDir(dataDir)
+		}
+
+		return nil
+	}
+}
+
+// EventID returns the unique id of the event document, which channels use as
+// document or message key. Events converted to ECS contain the id as event.id.
+func EventID(doc map[string]interface{}) string {
+	if id, ok := doc["id"].(string); ok {
+		return id
+	}
+
+	if e, ok := doc["event"].(map[string]interface{}); ok {
+		if id, ok := e["id"].(string); ok {
+			return id
+		}
+	}
+
+	return ""
+}
+
 type ChannelFunc func(...func(Channel) error) (Channel, error)
 
 var (
@@ -58,13 +58,19 @@ type Backend struct {
 
 	es *elastic.Client
 	ch chan map[string]interface{}
+
+	flush chan chan error
+
+	counters *pushers.Counters
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := Backend{
-		ch: ch,
+		ch:       ch,
+		flush:    make(chan chan error),
+		counters: &pushers.Counters{},
 	}
 
 	for _, optionFn := range options {
@@ -92,38 +98,124 @@ func (hc Backend) run() {
 	bulk := hc.es.Bulk()
 
 	count := 0
+
+	index := func() error {
+		if bulk.NumberOfActions() == 0 {
+			return nil
+		}
+
+		actions := bulk.NumberOfActions()
+
+		response, err := bulk.Do(context.Background())
+		if err != nil {
+			log.Errorf("Error indexing: %s", err.Error())
+			hc.counters.AddErrors(actions)
+			return err
+		}
+
+		indexed := response.Indexed()
+		count += len(indexed)
+
+		failed := response.Failed()
+		for _, item := range failed {
+			log.Errorf("Error indexing item: %s with error: %+v", item.Id, *item.Error)
+		}
+
+		hc.counters.AddErrors(len(failed))
+
+		log.Debugf("Bulk indexing: %d total %d", len(indexed), count)
+		return nil
+	}
+
+	add := func(doc map[string]interface{}) {
+		bulk = bulk.Add(elastic.NewBulkIndexRequest().
+			Index(hc.index).
+			Type("event").
+			Id(documentID(doc)).
+			Doc(doc),
+		)
+	}
+
 	for {
 		select {
 		case doc := <-hc.ch:
-			messageID := uuid.NewV4()
-
-			bulk = bulk.Add(elastic.NewBulkIndexRequest().
-				Index(hc.index).
-				Type("event").
-				Id(messageID.String()).
-				Doc(doc),
-			)
+			add(doc)
 
 			if bulk.NumberOfActions() < 10 {
 				continue
 			}
+		case errCh := <-hc.flush:
+			// add all queued documents before indexing
+		drain:
+			for {
+				select {
+				case doc := <-hc.ch:
+					add(doc)
+				default:
+					break drain
+				}
+			}
+
+			errCh <- index()
+			continue
 		case <-time.After(time.Second * 10):
 		}
 
-		if bulk.NumberOfActions() == 0 {
-		} else if response, err := bulk.Do(context.Background()); err != nil {
-			log.Errorf("Error indexing: %s", err.Error())
-		} else {
-			indexed := response.Indexed()
-			count += len(indexed)
+		index()
+	}
+}
 
-			for _, item := range response.Failed() {
-				log.Errorf("Error indexing item: %s with error: %+v", item.Id, *item.Error)
-			}
+// Flush indexes all queued events.
+func (hc Backend) Flush() error {
+	errCh := make(chan error)
+	hc.flush <- errCh
+	return <-errCh
+}
 
-			log.Debugf("Bulk indexing: %d total %d", len(indexed), count)
-		}
+// Stats returns the number of queued events and the indexing errors.
+func (hc Backend) Stats() pushers.Stats {
+	return hc.counters.Stats(len(hc.ch))
+}
+
+// Deliver indexes the events synchronously, it returns an error when the bulk
+// request fails. Items that are rejected by elasticsearch are counted as
+// errors, as indexing these again will fail as well.
+func (hc Backend) Deliver(events []event.Event) error {
+	bulk := hc.es.Bulk()
+
+	for _, e := range events {
+		doc := event.ToMap(e)
+
+		bulk = bulk.Add(elastic.NewBulkIndexRequest().
+			Index(hc.index).
+			Type("event").
+			Id(documentID(doc)).
+			Doc(doc),
+		)
 	}
+
+	response, err := bulk.Do(context.Background())
+	if err != nil {
+		return err
+	}
+
+	failed := response.Failed()
+	for _, item := range failed {
+		log.Errorf("Error indexing item: %s with error: %+v", item.Id, *item.Error)
+	}
+
+	hc.counters.AddErrors(len(failed))
+	return nil
+}
+
+// documentID returns the id of the event as document id, so indexing an event
+// again won't result in duplicates. Events without an id get a random id.
+func documentID(doc map[string]interface{}) string {
+	if id := pushers.EventID(doc); id != "" {
+		return id
+	}
+
+	return uuid.NewV4().String()
 }
 
 // Send delivers the giving push messages into the internal elastic search endpoint.
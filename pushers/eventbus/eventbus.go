@@ -31,30 +31,349 @@
 package eventbus
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	logging "github.com/op/go-logging"
+
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
+var log = logging.MustGetLogger("channels/eventbus")
+
+// Policy defines what happens when an event is sent to a subscriber with a
+// full queue.
+type Policy string
+
+// Overflow policies.
+const (
+	// Block waits until the queue has room for the event
+	Block Policy = "block"
+	// DropOldest discards the oldest queued event
+	DropOldest Policy = "drop-oldest"
+	// DropNewest discards the event being sent
+	DropNewest Policy = "drop-newest"
+)
+
+var (
+	// DefaultQueueSize is the queue size of subscribers without queue options.
+	DefaultQueueSize = 1024
+	// DefaultPolicy is the policy of subscribers without queue options, a
+	// subscriber that can't keep up shouldn't hold up the sender.
+	DefaultPolicy = DropNewest
+)
+
+// ParsePolicy returns the policy, the default policy for an empty string.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return DefaultPolicy, nil
+	case Block, DropOldest, DropNewest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %s, expected %s, %s or %s", s, Block, DropOldest, DropNewest)
+	}
+}
+
+// queued wraps a channel with the options of its queue.
+type queued struct {
+	pushers.Channel
+
+	name   string
+	size   int
+	policy Policy
+}
+
+// WithQueue returns the channel with the options of its queue, to be used when
+// subscribing. The name is used to report the statistics of the queue.
+func WithQueue(name string, channel pushers.Channel, size int, policy Policy) pushers.Channel {
+	return &queued{
+		Channel: channel,
+		name:    name,
+		size:    size,
+		policy:  policy,
+	}
+}
+
+// subscriber delivers the events in its queue to the channel.
+type subscriber struct {
+	// key is the channel as it has been subscribed
+	key pushers.Channel
+
+	channel pushers.Channel
+	name    string
+	policy  Policy
+
+	queue chan event.Event
+	done  chan struct{}
+
+	dropped *uint64
+}
+
+func (s *subscriber) run() {
+	defer close(s.done)
+
+	for e := range s.queue {
+		s.send(e)
+	}
+}
+
+func (s *subscriber) send(e event.Event) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("Error sending event to %s: %v", s.name, err)
+		}
+	}()
+
+	s.channel.Send(e)
+}
+
+// enqueue adds the event to the queue, applying the policy if the queue is full.
+// It returns false if blocking on a full queue has been interrupted.
+func (s *subscriber) enqueue(e event.Event, interrupt <-chan struct{}) bool {
+	switch s.policy {
+	case DropNewest:
+		select {
+		case s.queue <- e:
+		default:
+			atomic.AddUint64(s.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.queue <- e:
+				return true
+			default:
+			}
+
+			select {
+			case <-s.queue:
+				atomic.AddUint64(s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- e:
+		case <-interrupt:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Stats contains the statistics of the queue of a subscriber.
+type Stats struct {
+	Name    string
+	Queued  int
+	Dropped uint64
+}
+
 // EventBus defines a structure which provides a pubsub bus where message.Events
-// are sent along it's wires for delivery
+// are sent along it's wires for delivery. Every subscriber has its own queue
+// and worker, a slow subscriber won't delay the sender or the other subscribers.
 type EventBus struct {
-	subscribers []pushers.Channel
+	m sync.RWMutex
+
+	subscribers []*subscriber
+
+	// replacing is closed when the subscribers are about to be replaced,
+	// interrupting the senders blocked on a full queue
+	replacing chan struct{}
+	// rm serializes replacing the subscribers
+	rm sync.Mutex
+
+	// dropped contains the drop counters by name, kept when replacing subscribers
+	dm      sync.Mutex
+	dropped map[string]*uint64
 }
 
 // NewEventBus returns a new instance of a EventBus.
 func New() *EventBus {
-	return &EventBus{}
+	return &EventBus{
+		replacing: make(chan struct{}),
+		dropped:   map[string]*uint64{},
+	}
+}
+
+func (eb *EventBus) newSubscriber(channel pushers.Channel) *subscriber {
+	s := &subscriber{
+		key:     channel,
+		channel: channel,
+		name:    fmt.Sprintf("%T", channel),
+		policy:  DefaultPolicy,
+		done:    make(chan struct{}),
+	}
+
+	size := DefaultQueueSize
+
+	if q, ok := channel.(*queued); ok {
+		s.channel = q.Channel
+		s.name = q.name
+		s.policy = q.policy
+
+		if q.size > 0 {
+			size = q.size
+		}
+	}
+
+	s.queue = make(chan event.Event, size)
+
+	eb.dm.Lock()
+	if _, ok := eb.dropped[s.name]; !ok {
+		eb.dropped[s.name] = new(uint64)
+	}
+	s.dropped = eb.dropped[s.name]
+	eb.dm.Unlock()
+
+	go s.run()
+
+	return s
 }
 
 // Subscribe adds the giving channel to the list of subscribers for the giving bus.
 func (eb *EventBus) Subscribe(channel pushers.Channel) error {
-	eb.subscribers = append(eb.subscribers, channel)
+	return eb.Replace(nil, []pushers.Channel{channel})
+}
+
+// Unsubscribe removes the giving channel from the list of subscribers.
+func (eb *EventBus) Unsubscribe(channel pushers.Channel) error {
+	return eb.Replace([]pushers.Channel{channel}, nil)
+}
+
+// Replace removes the old channels and adds the new channels in a single step,
+// no events will be sent while the subscribers are being swapped. Channels are
+// compared by identity, so they need to be of a comparable type (eg. pointers).
+// Replace returns after the queued events of the old channels have been delivered.
+func (eb *EventBus) Replace(old []pushers.Channel, new []pushers.Channel) error {
+	eb.rm.Lock()
+
+	// the senders blocked on a full queue release the lock, and continue
+	// with the new subscribers
+	close(eb.replacing)
+
+	eb.m.Lock()
+
+	subscribers := []*subscriber{}
+	removed := []*subscriber{}
+
+	for _, subscriber := range eb.subscribers {
+		found := false
+
+		for _, channel := range old {
+			if subscriber.key != channel {
+				continue
+			}
+
+			found = true
+			break
+		}
+
+		if found {
+			// no events will be sent anymore, the worker will stop when the queue is empty
+			close(subscriber.queue)
+			removed = append(removed, subscriber)
+			continue
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	for _, channel := range new {
+		subscribers = append(subscribers, eb.newSubscriber(channel))
+	}
+
+	eb.subscribers = subscribers
+	eb.replacing = make(chan struct{})
+
+	eb.m.Unlock()
+	eb.rm.Unlock()
+
+	for _, subscriber := range removed {
+		<-subscriber.done
+	}
+
 	return nil
 }
 
-// Send deliverers the slice of messages to all subscribers.
-func (eb *EventBus) Send(e event.Event) {
+// Close stops all subscribers, after their queued events have been delivered.
+func (eb *EventBus) Close() error {
+	eb.m.RLock()
+
+	channels := make([]pushers.Channel, len(eb.subscribers))
+	for i, subscriber := range eb.subscribers {
+		channels[i] = subscriber.key
+	}
+
+	eb.m.RUnlock()
+
+	return eb.Replace(channels, nil)
+}
+
+// Stats returns the statistics of the queues of the subscribers, subscribers
+// with the same name are combined.
+func (eb *EventBus) Stats() []Stats {
+	eb.m.RLock()
+	defer eb.m.RUnlock()
+
+	stats := []Stats{}
+	index := map[string]int{}
+
 	for _, subscriber := range eb.subscribers {
-		subscriber.Send(e)
+		i, ok := index[subscriber.name]
+		if !ok {
+			i = len(stats)
+			index[subscriber.name] = i
+
+			stats = append(stats, Stats{
+				Name:    subscriber.name,
+				Dropped: atomic.LoadUint64(subscriber.dropped),
+			})
+		}
+
+		stats[i].Queued += len(subscriber.queue)
+	}
+
+	return stats
+}
+
+// Send queues the event for delivery to all subscribers. When the subscribers
+// are replaced while blocking on a full queue, the event will be sent to the
+// new subscribers that haven't received it yet.
+func (eb *EventBus) Send(e event.Event) {
+	var sent map[*subscriber]bool
+
+	for {
+		eb.m.RLock()
+
+		subscribers := eb.subscribers
+
+		i := 0
+		for ; i < len(subscribers); i++ {
+			if sent[subscribers[i]] {
+				continue
+			}
+
+			if !subscribers[i].enqueue(e, eb.replacing) {
+				break
+			}
+		}
+
+		eb.m.RUnlock()
+
+		if i == len(subscribers) {
+			return
+		}
+
+		if sent == nil {
+			sent = map[*subscriber]bool{}
+		}
+
+		for _, subscriber := range subscribers[:i] {
+			sent[subscriber] = true
+		}
 	}
 }
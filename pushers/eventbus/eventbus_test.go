@@ -0,0 +1,347 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package eventbus
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// slowChannel blocks every Send until released.
+type slowChannel struct {
+	m       sync.Mutex
+	release chan struct{}
+	events  []event.Event
+}
+
+func newSlowChannel() *slowChannel {
+	return &slowChannel{
+		release: make(chan struct{}),
+	}
+}
+
+func (sc *slowChannel) Send(e event.Event) {
+	<-sc.release
+
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	sc.events = append(sc.events, e)
+}
+
+func (sc *slowChannel) sequences() []string {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	s := []string{}
+	for _, e := range sc.events {
+		s = append(s, e.Get("sequence"))
+	}
+
+	return s
+}
+
+func sendEvents(eb *EventBus, from, to int) {
+	for i := from; i < to; i++ {
+		eb.Send(event.New(event.Custom("sequence", strconv.Itoa(i))))
+	}
+}
+
+func TestEventBusAsync(t *testing.T) {
+	eb := New()
+
+	sc := newSlowChannel()
+	eb.Subscribe(sc)
+
+	done := make(chan struct{})
+	go func() {
+		sendEvents(eb, 0, 10)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send blocked on slow subscriber")
+	}
+
+	close(sc.release)
+
+	if err := eb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.sequences()) != 10 {
+		t.Errorf("Expected 10 events after close, got %d", len(sc.sequences()))
+	}
+}
+
+// testOverflow blocks the worker on the first event, and fills the queue
+// of size 2 with 5 more events.
+func testOverflow(t *testing.T, policy Policy) (*slowChannel, Stats) {
+	eb := New()
+
+	sc := newSlowChannel()
+	eb.Subscribe(WithQueue("slow", sc, 2, policy))
+
+	sendEvents(eb, 0, 1)
+
+	// wait for the worker to take the first event
+	for i := 0; eb.Stats()[0].Queued != 0; i++ {
+		if i > 100 {
+			t.Fatal("Worker didn't take the first event")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sendEvents(eb, 1, 6)
+
+	stats := eb.Stats()[0]
+
+	close(sc.release)
+	eb.Close()
+
+	return sc, stats
+}
+
+func TestEventBusDropNewest(t *testing.T) {
+	sc, stats := testOverflow(t, DropNewest)
+
+	if stats.Name != "slow" || stats.Queued != 2 || stats.Dropped != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if s := sc.sequences(); len(s) != 3 || s[0] != "0" || s[1] != "1" || s[2] != "2" {
+		t.Errorf("Expected events 0, 1 and 2, got %v", s)
+	}
+}
+
+func TestEventBusDropOldest(t *testing.T) {
+	sc, stats := testOverflow(t, DropOldest)
+
+	if stats.Queued != 2 || stats.Dropped != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if s := sc.sequences(); len(s) != 3 || s[0] != "0" || s[1] != "4" || s[2] != "5" {
+		t.Errorf("Expected events 0, 4 and 5, got %v", s)
+	}
+}
+
+func TestEventBusBlock(t *testing.T) {
+	eb := New()
+
+	sc := newSlowChannel()
+	eb.Subscribe(WithQueue("slow", sc, 1, Block))
+
+	done := make(chan struct{})
+	go func() {
+		sendEvents(eb, 0, 5)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Expected Send to block on a full queue")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(sc.release)
+	<-done
+
+	eb.Close()
+
+	if s := sc.sequences(); len(s) != 5 {
+		t.Errorf("Expected 5 events, got %v", s)
+	}
+}
+
+func TestEventBusBlockedReplace(t *testing.T) {
+	eb := New()
+
+	sc := newSlowChannel()
+	eb.Subscribe(WithQueue("slow", sc, 1, Block))
+
+	done := make(chan struct{})
+	go func() {
+		sendEvents(eb, 0, 5)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	subscribed := make(chan struct{})
+	go func() {
+		eb.Subscribe(newSlowChannel())
+		close(subscribed)
+	}()
+
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe blocked on a blocked Send")
+	}
+
+	close(sc.release)
+	<-done
+}
+
+func TestEventBusBlockedSendReplaced(t *testing.T) {
+	eb := New()
+
+	old := newSlowChannel()
+
+	q := WithQueue("slow", old, 1, Block)
+	eb.Subscribe(q)
+
+	// the worker blocks on event 0, event 1 fills the queue
+	sendEvents(eb, 0, 2)
+
+	done := make(chan struct{})
+	go func() {
+		sendEvents(eb, 2, 3)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	current := newSlowChannel()
+	close(current.release)
+
+	replaced := make(chan struct{})
+	go func() {
+		eb.Replace([]pushers.Channel{q}, []pushers.Channel{current})
+		close(replaced)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the blocked Send to continue with the new subscriber")
+	}
+
+	close(old.release)
+	<-replaced
+
+	eb.Close()
+
+	if s := old.sequences(); len(s) != 2 {
+		t.Errorf("Expected events 0 and 1 for old channel, got %v", s)
+	}
+
+	if s := current.sequences(); len(s) != 1 || s[0] != "2" {
+		t.Errorf("Expected event 2 for current channel, got %v", s)
+	}
+}
+
+func TestEventBusReplace(t *testing.T) {
+	eb := New()
+
+	old := newSlowChannel()
+	eb.Subscribe(old)
+
+	sendEvents(eb, 0, 3)
+
+	current := newSlowChannel()
+	close(current.release)
+
+	replaced := make(chan struct{})
+	go func() {
+		eb.Replace([]pushers.Channel{old}, []pushers.Channel{current})
+		close(replaced)
+	}()
+
+	select {
+	case <-replaced:
+		t.Fatal("Expected Replace to wait for the queued events of the old channel")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(old.release)
+	<-replaced
+
+	sendEvents(eb, 3, 4)
+	eb.Close()
+
+	if s := old.sequences(); len(s) != 3 {
+		t.Errorf("Expected 3 events for old channel, got %v", s)
+	}
+
+	if s := current.sequences(); len(s) != 1 || s[0] != "3" {
+		t.Errorf("Expected event 3 for current channel, got %v", s)
+	}
+}
+
+func TestEventBusConcurrent(t *testing.T) {
+	eb := New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			sendEvents(eb, 0, 100)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			sc := newSlowChannel()
+			close(sc.release)
+
+			eb.Subscribe(sc)
+			eb.Unsubscribe(sc)
+		}()
+	}
+
+	wg.Wait()
+
+	if stats := eb.Stats(); len(stats) != 0 {
+		t.Errorf("Expected no subscribers, got %+v", stats)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := ParsePolicy(""); err != nil || p != DefaultPolicy {
+		t.Errorf("Expected default policy, got %s, %v", p, err)
+	}
+
+	if _, err := ParsePolicy("drop-random"); err == nil {
+		t.Errorf("Expected error for unknown policy")
+	}
+}
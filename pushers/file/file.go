@@ -65,8 +65,9 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 		FileConfig: FileConfig{
 			MaxSize: defaultMaxSize,
 		},
-		request: make(chan map[string]interface{}),
-		closer:  make(chan struct{}),
+		request:  make(chan map[string]interface{}),
+		closer:   make(chan struct{}),
+		counters: &pushers.Counters{},
 	}
 
 	for _, optionFn := range options {
@@ -107,7 +108,10 @@ type FileBackend struct {
 	dest    *os.File
 	request chan map[string]interface{}
 	closer  chan struct{}
+	once    sync.Once
 	wg      sync.WaitGroup
+
+	counters *pushers.Counters
 }
 
 // Wait calls the internal waiter.
@@ -115,11 +119,36 @@ func (f *FileBackend) Wait() {
 	f.wg.Wait()
 }
 
+// Close writes the buffered events to the file and closes it. Events
+// sent after Close will be dropped.
+func (f *FileBackend) Close() error {
+	f.once.Do(func() {
+		close(f.closer)
+	})
+
+	f.wg.Wait()
+	return nil
+}
+
+// Stats returns the number of failed and dropped events.
+func (f *FileBackend) Stats() pushers.Stats {
+	return f.counters.Stats(0)
+}
+
 // Send delivers the giving if it passes all filtering criteria into the
 // FileBackend write queue.
 func (f *FileBackend) Send(message event.Event) {
+	select {
+	case <-f.closer:
+		log.Errorf("Dropping event, file channel has been closed")
+		f.counters.AddDropped(1)
+		return
+	default:
+	}
+
 	if err := f.syncWrites(); err != nil {
 		log.Errorf("Error syncing writes: %+q", err)
+		f.counters.AddErrors(1)
 		return
 	}
 
@@ -132,7 +161,12 @@ func (f *FileBackend) Send(message event.Event) {
 		return true
 	})
 
-	f.request <- mp
+	select {
+	case f.request <- mp:
+	case <-f.closer:
+		log.Errorf("Dropping event, file channel has been closed")
+		f.counters.AddDropped(1)
+	}
 }
 
 // syncWrites startups the channel procedure to listen for new writes to giving file.
@@ -177,7 +211,17 @@ func (f *FileBackend) syncLoop() {
 	writeSync:
 		for {
 			select {
+			case <-f.closer:
+				f.write(&buf)
+
+				f.dest.Close()
+				f.dest = nil
+
+				break writeSync
+
 			case <-ticker.C:
+				f.write(&buf)
+
 				f.dest.Close()
 				f.dest = nil
 
@@ -188,6 +232,8 @@ func (f *FileBackend) syncLoop() {
 
 			case req, ok := <-f.request:
 				if !ok {
+					f.write(&buf)
+
 					f.dest.Close()
 					f.dest = nil
 					f.request = nil
@@ -196,6 +242,7 @@ func (f *FileBackend) syncLoop() {
 
 				if err := json.NewEncoder(&buf).Encode(req); err != nil {
 					log.Errorf("Failed to marshal PushMessage to JSON : %+q", err)
+					f.counters.AddErrors(1)
 					continue writeSync
 				}
 
@@ -205,18 +252,27 @@ func (f *FileBackend) syncLoop() {
 			case <-time.After(time.Second):
 			}
 
-			if _, err := io.Copy(f.dest, &buf); err != nil && err != io.EOF {
-				log.Errorf("Failed to copy data to File : %+q", err)
-			}
+			f.write(&buf)
+		}
+	}
+}
 
-			if err := f.dest.Sync(); err != nil {
-				log.Errorf("Failed to sync Write to File : %+q", err)
-			}
+// write copies the buffer to the file and syncs it.
+func (f *FileBackend) write(buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
 
-			// Reset the buffer for reuse.
-			buf.Reset()
-		}
+	if _, err := io.Copy(f.dest, buf); err != nil && err != io.EOF {
+		log.Errorf("Failed to copy data to File : %+q", err)
+	}
+
+	if err := f.dest.Sync(); err != nil {
+		log.Errorf("Failed to sync Write to File : %+q", err)
 	}
+
+	// Reset the buffer for reuse.
+	buf.Reset()
 }
 
 // newFile returns a new file with the giving target path and returns the
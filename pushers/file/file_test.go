@@ -29,3 +29,76 @@
 * must display the words "Powered by Honeytrap" and retain the original copyright notice.
  */
 package fschannel_test
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	fschannel "github.com/honeytrap/honeytrap/pushers/file"
+)
+
+func TestFileClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "honeytrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "events.json")
+
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(fmt.Sprintf("[P]\nfilename=%q\n", filename), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := fschannel.New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		c.Send(event.New(
+			event.Custom("sequence", i),
+		))
+	}
+
+	if err := pushers.Shutdown(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reload can shut down the channel while honeytrap is stopping
+	if err := pushers.Shutdown(c); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	count := 0
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		count++
+	}
+
+	if count != 3 {
+		t.Errorf("Expected 3 events to be written, got %d", count)
+	}
+}
@@ -86,12 +86,35 @@ func RegexFilterFunc(field string, expressions []string) FilterFunc {
 // FilterChannel defines a struct which handles the delivery of giving
 // messages to a specific sets of backend channels based on specific criteria.
 func FilterChannel(channel Channel, fn FilterFunc) Channel {
-	return filterChannel{
+	return &filterChannel{
 		Channel:  channel,
 		FilterFn: fn,
 	}
 }
 
+type convertChannel struct {
+	Channel
+
+	ConvertFn ConvertFunc
+}
+
+// Send delivers the converted event to the channel.
+func (cc convertChannel) Send(e event.Event) {
+	cc.Channel.Send(cc.ConvertFn(e))
+}
+
+// ConvertFunc defines a function returning the event in another format.
+type ConvertFunc func(event.Event) event.Event
+
+// ConvertChannel returns a Channel that converts events before delivering
+// them to the channel.
+func ConvertChannel(channel Channel, fn ConvertFunc) Channel {
+	return &convertChannel{
+		Channel:   channel,
+		ConvertFn: fn,
+	}
+}
+
 type tokenChannel struct {
 	Channel
 
@@ -106,7 +129,7 @@ func (mc tokenChannel) Send(e event.Event) {
 
 // TokenChannel returns a Channel to set token value.
 func TokenChannel(channel Channel, token string) Channel {
-	return tokenChannel{
+	return &tokenChannel{
 		Channel: channel,
 		Token:   token,
 	}
@@ -32,6 +32,7 @@ package kafka
 
 import (
 	"encoding/json"
+	"sync"
 
 	sarama "github.com/Shopify/sarama"
 
@@ -54,14 +55,21 @@ type Backend struct {
 
 	producer sarama.AsyncProducer
 
-	ch chan map[string]interface{}
+	// sync is used to deliver events synchronously
+	sync *syncProducer
+
+	queue *pushers.Queue
+
+	counters *pushers.Counters
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
-	ch := make(chan map[string]interface{}, 100)
+	counters := &pushers.Counters{}
 
 	c := Backend{
-		ch: ch,
+		queue:    pushers.NewQueue(100, counters),
+		sync:     &syncProducer{},
+		counters: counters,
 	}
 
 	for _, optionFn := range options {
@@ -69,7 +77,7 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	}
 
 	config := sarama.NewConfig()
-	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
 
 	producer, err := sarama.NewAsyncProducer(c.Brokers, config)
 	if err != nil {
@@ -77,15 +85,18 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	}
 	c.producer = producer
 
+	go c.errors()
 	go c.run()
 
 	return &c, nil
 }
 
-func (hc Backend) run() {
-	defer hc.producer.AsyncClose()
+func (hc *Backend) run() {
+	defer hc.queue.Done()
+
+	for e := range hc.queue.Events() {
+		doc := event.ToMap(e)
 
-	for doc := range <-hc.ch {
 		data, err := json.Marshal(doc)
 		if err != nil {
 			log.Errorf("Error marshaling event: %s", err.Error())
@@ -94,22 +105,103 @@ func (hc Backend) run() {
 
 		hc.producer.Input() <- &sarama.ProducerMessage{
 			Topic: hc.Topic,
-			Key:   nil,
+			Key:   messageKey(doc),
 			Value: sarama.ByteEncoder(data),
 		}
 	}
 }
 
-// Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc Backend) Send(message event.Event) {
-	mp := make(map[string]interface{})
+// messageKey returns the id of the event as key of the message, events without
+// an id are produced without a key.
+func messageKey(doc map[string]interface{}) sarama.Encoder {
+	if id := pushers.EventID(doc); id != "" {
+		return sarama.StringEncoder(id)
+	}
+
+	return nil
+}
+
+// errors consumes the errors of the producer, the producer will stall
+// otherwise. It returns when the producer has been closed.
+func (hc *Backend) errors() {
+	for err := range hc.producer.Errors() {
+		log.Errorf("Error producing message: %s", err.Error())
+		hc.counters.AddErrors(1)
+	}
+}
+
+// Stats returns the number of queued events and the producer errors.
+func (hc *Backend) Stats() pushers.Stats {
+	return hc.counters.Stats(hc.queue.Len())
+}
+
+// syncProducer is created when the first events are delivered synchronously.
+type syncProducer struct {
+	m        sync.Mutex
+	producer sarama.SyncProducer
+}
+
+// Deliver produces the events synchronously, it returns an error when not all
+// messages have been produced.
+func (hc *Backend) Deliver(events []event.Event) error {
+	hc.sync.m.Lock()
+	defer hc.sync.m.Unlock()
+
+	if hc.sync.producer == nil {
+		config := sarama.NewConfig()
+		config.Producer.Return.Successes = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+
+		producer, err := sarama.NewSyncProducer(hc.Brokers, config)
+		if err != nil {
+			return err
+		}
+
+		hc.sync.producer = producer
+	}
+
+	messages := []*sarama.ProducerMessage{}
+
+	for _, e := range events {
+		doc := event.ToMap(e)
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			log.Errorf("Error marshaling event: %s", err.Error())
+			hc.counters.AddErrors(1)
+			continue
+		}
+
+		messages = append(messages, &sarama.ProducerMessage{
+			Topic: hc.Topic,
+			Key:   messageKey(doc),
+			Value: sarama.ByteEncoder(data),
+		})
+	}
+
+	return hc.sync.producer.SendMessages(messages)
+}
+
+// Close delivers all queued events and closes the producer, events sent after
+// Close are dropped. Calling Close again has no effect.
+func (hc *Backend) Close() error {
+	if !hc.queue.Close() {
+		return nil
+	}
+
+	hc.sync.m.Lock()
+	defer hc.sync.m.Unlock()
 
-	message.Range(func(key, value interface{}) bool {
-		if keyName, ok := key.(string); ok {
-			mp[keyName] = value
+	if hc.sync.producer != nil {
+		if err := hc.sync.producer.Close(); err != nil {
+			log.Errorf("Error closing producer: %s", err.Error())
 		}
-		return true
-	})
+	}
+
+	return hc.producer.Close()
+}
 
-	hc.ch <- mp
+// Send queues the event for producing.
+func (hc *Backend) Send(message event.Event) {
+	hc.queue.Send(message)
 }
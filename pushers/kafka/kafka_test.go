@@ -86,12 +86,27 @@ func TestChannelsKafkaSend(t *testing.T) {
 
 	kb := c.(*Backend)
 
-	select {
-	case <-kb.producer.Successes():
-	case msg := <-kb.producer.Errors():
-		t.Error(msg.Err)
+	if err := kb.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := kb.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %s", err)
+	}
+
+	if stats := kb.Stats(); stats.Errors != 0 || stats.Queued != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	produced := 0
+	for _, rr := range leader.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
 	}
 
-	close(kb.ch)
+	if produced != 1 {
+		t.Errorf("Expected 1 produce request, got %d", produced)
+	}
 
 }
@@ -0,0 +1,267 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	dialTimeout = 10 * time.Second
+	ackTimeout  = 10 * time.Second
+)
+
+var errConnectionLost = errors.New("connection to broker lost")
+
+// client is a connection to the broker for publishing messages, it isn't
+// safe for concurrent use.
+type client struct {
+	conn    net.Conn
+	version byte
+
+	nextID uint16
+
+	// packets contains the packets read from the broker, the channel is
+	// closed when reading fails
+	packets chan packet
+}
+
+// dial connects to the broker and sends the connect packet.
+func dial(network, address string, tlsConfig *tls.Config, c connect) (*client, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	var err error
+
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, network, address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial(network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(ackTimeout))
+
+	r := bufio.NewReader(conn)
+
+	if err := writePacket(conn, c.packet()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	code, err := parseConnack(p)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	} else if code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("connection refused by broker: %s", connackReason(c.version, code))
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	cl := &client{
+		conn:    conn,
+		version: c.version,
+		packets: make(chan packet, 16),
+	}
+
+	go cl.read(r)
+
+	return cl, nil
+}
+
+func (c *client) read(r *bufio.Reader) {
+	defer close(c.packets)
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		if p.kind == packetPingresp {
+			continue
+		}
+
+		c.packets <- p
+	}
+}
+
+func (c *client) write(p packet) error {
+	c.conn.SetWriteDeadline(time.Now().Add(ackTimeout))
+	return writePacket(c.conn, p)
+}
+
+// wait returns the acknowledgement of the packet id, other packets are
+// ignored.
+func (c *client) wait(kind byte, id uint16) error {
+	timeout := time.After(ackTimeout)
+
+	for {
+		select {
+		case p, ok := <-c.packets:
+			if !ok {
+				return errConnectionLost
+			}
+
+			if p.kind != kind {
+				continue
+			}
+
+			ackID, code, err := parseAck(p)
+			if err != nil {
+				return err
+			} else if ackID != id {
+				continue
+			} else if code >= 0x80 {
+				return fmt.Errorf("message rejected by broker: reason code 0x%02x", code)
+			}
+
+			return nil
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for acknowledgement of message %d", id)
+		}
+	}
+}
+
+// publish sends the message, it returns when the message has been
+// acknowledged according to the qos.
+func (c *client) publish(topic string, payload []byte, qos byte, retain bool) error {
+	p := publish{
+		version: c.version,
+		topic:   topic,
+		qos:     qos,
+		retain:  retain,
+		payload: payload,
+	}
+
+	if qos > 0 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+
+		p.id = c.nextID
+	}
+
+	if err := c.write(p.packet()); err != nil {
+		return err
+	}
+
+	switch qos {
+	case 1:
+		return c.wait(packetPuback, p.id)
+	case 2:
+		if err := c.wait(packetPubrec, p.id); err != nil {
+			return err
+		}
+
+		if err := c.write(ack(packetPubrel, p.id)); err != nil {
+			return err
+		}
+
+		return c.wait(packetPubcomp, p.id)
+	}
+
+	return nil
+}
+
+// ping keeps the connection alive, responses are discarded by read.
+func (c *client) ping() error {
+	return c.write(packet{kind: packetPingreq})
+}
+
+// closed returns true when the connection to the broker has been lost.
+func (c *client) closed() bool {
+	select {
+	case _, ok := <-c.packets:
+		// packets that aren't waited for are ignored
+		return !ok
+	default:
+		return false
+	}
+}
+
+// close disconnects from the broker.
+func (c *client) close() error {
+	c.write(packet{kind: packetDisconnect})
+	return c.conn.Close()
+}
+
+// connackReason returns the description of the connack code.
+func connackReason(version byte, code byte) string {
+	if version == version5 {
+		switch code {
+		case 0x84:
+			return "unsupported protocol version"
+		case 0x85:
+			return "client identifier not valid"
+		case 0x86:
+			return "bad user name or password"
+		case 0x87:
+			return "not authorized"
+		case 0x88:
+			return "server unavailable"
+		}
+
+		return fmt.Sprintf("reason code 0x%02x", code)
+	}
+
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+
+	return fmt.Sprintf("return code %d", code)
+}
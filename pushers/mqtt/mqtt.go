@@ -0,0 +1,446 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package mqtt contains the event channel for publishing events to a MQTT
+// broker, using MQTT 3.1.1 or MQTT 5.
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/rs/xid"
+
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = pushers.Register("mqtt", New)
+)
+
+var log = logging.MustGetLogger("channels/mqtt")
+
+var (
+	// ErrBrokerNotSet will be returned if no broker has been set in configuration
+	ErrBrokerNotSet = errors.New("MQTT broker has not been set")
+
+	errNotConnected = errors.New("not connected to broker")
+)
+
+var (
+	defaultTopic      = "honeytrap/{sensor}/{category}"
+	defaultKeepAlive  = 30 * time.Second
+	defaultBufferSize = 10000
+
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Config defines a struct which holds configuration values for the mqtt
+// channel.
+type Config struct {
+	// Broker is the url of the broker, eg. tcp://localhost:1883 or
+	// tls://localhost:8883
+	Broker string `toml:"broker"`
+
+	// Version is the protocol version, either 3.1.1 or 5
+	Version string `toml:"version"`
+
+	ClientID string `toml:"client-id"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// Topic is the topic events are published to, fields of the event
+	// between braces are replaced by their value, eg. honeytrap/{category}
+	Topic  string `toml:"topic"`
+	QoS    int    `toml:"qos"`
+	Retain bool   `toml:"retain"`
+
+	KeepAlive config.Delay `toml:"keep-alive"`
+
+	// BufferSize is the number of events buffered while disconnected, the
+	// oldest events are dropped when the buffer is full
+	BufferSize int `toml:"buffer-size"`
+
+	// Insecure configures if the certificate of the broker should not be
+	// verified
+	Insecure bool `toml:"insecure"`
+
+	// CA is the file containing the certificates used to verify the broker
+	CA string `toml:"ca"`
+}
+
+// Backend defines a struct which provides a channel for publishing events to
+// a MQTT broker.
+type Backend struct {
+	Config
+
+	address   string
+	tlsConfig *tls.Config
+	connect   connect
+
+	client *client
+
+	// buffer contains the events waiting to be published, buffered is the
+	// length of the buffer
+	buffer   []event.Event
+	buffered int64
+
+	queue *pushers.Queue
+
+	counters *pushers.Counters
+}
+
+// New returns a new mqtt channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	counters := &pushers.Counters{}
+
+	c := Backend{
+		Config: Config{
+			Version:    "3.1.1",
+			ClientID:   "honeytrap-" + xid.New().String(),
+			Topic:      defaultTopic,
+			QoS:        1,
+			KeepAlive:  config.Delay(defaultKeepAlive),
+			BufferSize: defaultBufferSize,
+		},
+		queue:    pushers.NewQueue(100, counters),
+		counters: counters,
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.configure(); err != nil {
+		return nil, err
+	}
+
+	go c.run()
+
+	return &c, nil
+}
+
+// configure validates the configuration, and prepares connecting to the
+// broker.
+func (b *Backend) configure() error {
+	if b.Broker == "" {
+		return ErrBrokerNotSet
+	}
+
+	u, err := url.Parse(b.Broker)
+	if err != nil {
+		return err
+	}
+
+	port := "1883"
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		port = "8883"
+
+		b.tlsConfig, err = tlsConfig(b.Insecure, b.CA)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown scheme %s for broker, expected tcp or tls", u.Scheme)
+	}
+
+	b.address = u.Host
+	if u.Port() == "" {
+		b.address = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	if b.tlsConfig != nil && b.tlsConfig.ServerName == "" {
+		b.tlsConfig.ServerName = u.Hostname()
+	}
+
+	b.connect = connect{
+		clientID:  b.ClientID,
+		username:  b.Username,
+		password:  b.Password,
+		keepAlive: uint16(b.KeepAlive.Duration() / time.Second),
+	}
+
+	switch b.Version {
+	case "3.1.1":
+		b.connect.version = version311
+	case "5", "5.0":
+		b.connect.version = version5
+	default:
+		return fmt.Errorf("unknown version %s, expected 3.1.1 or 5", b.Version)
+	}
+
+	if b.QoS < 0 || b.QoS > 2 {
+		return fmt.Errorf("invalid qos %d, expected 0, 1 or 2", b.QoS)
+	}
+
+	if b.KeepAlive < config.Delay(time.Second) {
+		return fmt.Errorf("invalid keep-alive %s", b.KeepAlive.Duration())
+	}
+
+	if b.BufferSize <= 0 {
+		return fmt.Errorf("invalid buffer-size %d", b.BufferSize)
+	}
+
+	return nil
+}
+
+func tlsConfig(insecure bool, ca string) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+
+	if ca == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", ca)
+	}
+
+	return config, nil
+}
+
+var placeholder = regexp.MustCompile(`\{([^}]+)\}`)
+
+// topic returns the topic of the event, the placeholders are replaced by the
+// values of the event. Wildcards and separators within values are replaced.
+func (b *Backend) topic(e event.Event) string {
+	return placeholder.ReplaceAllStringFunc(b.Topic, func(s string) string {
+		v, ok := e.Value(s[1 : len(s)-1])
+		if !ok {
+			return "unknown"
+		}
+
+		return strings.Map(func(r rune) rune {
+			switch r {
+			case '/', '+', '#':
+				return '_'
+			}
+
+			return r
+		}, fmt.Sprint(v))
+	})
+}
+
+func (b *Backend) run() {
+	defer b.queue.Done()
+
+	ticker := time.NewTicker(b.KeepAlive.Duration() / 2)
+	defer ticker.Stop()
+
+	backoff := minBackoff
+
+	var retry <-chan time.Time
+
+	connect := func() {
+		client, err := dial("tcp", b.address, b.tlsConfig, b.connect)
+		if err != nil {
+			log.Errorf("Error connecting to broker %s, retrying in %s: %s", b.address, backoff, err.Error())
+
+			retry = time.After(backoff)
+
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+
+			return
+		}
+
+		log.Debugf("Connected to broker %s", b.address)
+
+		b.client = client
+		backoff = minBackoff
+	}
+
+	disconnect := func(err error) {
+		log.Errorf("Error publishing to broker %s: %s", b.address, err.Error())
+
+		b.client.close()
+		b.client = nil
+
+		retry = time.After(0)
+	}
+
+	connect()
+
+	for {
+		if err := b.publish(); err != nil && b.client != nil {
+			disconnect(err)
+		}
+
+		select {
+		case e, ok := <-b.queue.Events():
+			if !ok {
+				if err := b.publish(); err != nil {
+					log.Errorf("Error publishing buffered events: %s", err.Error())
+				}
+
+				b.counters.AddDropped(len(b.buffer))
+
+				if b.client != nil {
+					b.client.close()
+				}
+
+				return
+			}
+
+			b.add(e)
+		case errCh := <-b.queue.Flushes():
+		drain:
+			for {
+				select {
+				case e, ok := <-b.queue.Events():
+					if !ok {
+						break drain
+					}
+
+					b.add(e)
+				default:
+					break drain
+				}
+			}
+
+			err := b.publish()
+			if err != nil && b.client != nil {
+				disconnect(err)
+			}
+
+			errCh <- err
+		case <-retry:
+			retry = nil
+			connect()
+		case <-ticker.C:
+			if b.client == nil {
+			} else if b.client.closed() {
+				disconnect(errConnectionLost)
+			} else if err := b.client.ping(); err != nil {
+				disconnect(err)
+			}
+		}
+	}
+}
+
+// add buffers the event, the oldest event is dropped when the buffer is full.
+func (b *Backend) add(e event.Event) {
+	if len(b.buffer) >= b.BufferSize {
+		b.buffer = b.buffer[1:]
+		b.counters.AddDropped(1)
+	}
+
+	b.buffer = append(b.buffer, e)
+	atomic.StoreInt64(&b.buffered, int64(len(b.buffer)))
+}
+
+// publish publishes the buffered events, it returns an error when not all
+// events have been published.
+func (b *Backend) publish() error {
+	defer func() {
+		atomic.StoreInt64(&b.buffered, int64(len(b.buffer)))
+	}()
+
+	for len(b.buffer) > 0 {
+		if b.client == nil {
+			return errNotConnected
+		}
+
+		e := b.buffer[0]
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			log.Errorf("Error marshaling event: %s", err.Error())
+			b.counters.AddErrors(1)
+		} else if err := b.client.publish(b.topic(e), payload, byte(b.QoS), b.Retain); err != nil {
+			return err
+		}
+
+		b.buffer = b.buffer[1:]
+
+		// buffer events that were sent while publishing
+		select {
+		case e, ok := <-b.queue.Events():
+			if ok {
+				b.add(e)
+			}
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Flush publishes all queued events, it returns an error when the events
+// couldn't be published.
+func (b *Backend) Flush() error {
+	return b.queue.Flush()
+}
+
+// Stats returns the number of queued and buffered events, and the events
+// that have been dropped because the buffer was full.
+func (b *Backend) Stats() pushers.Stats {
+	return b.counters.Stats(b.queue.Len() + int(atomic.LoadInt64(&b.buffered)))
+}
+
+// Close publishes the buffered events and disconnects from the broker, events
+// sent after Close are dropped. Calling Close again has no effect.
+func (b *Backend) Close() error {
+	b.queue.Close()
+	return nil
+}
+
+// Send queues the event for publishing.
+func (b *Backend) Send(e event.Event) {
+	b.queue.Send(e)
+}
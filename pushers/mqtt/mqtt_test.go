@@ -0,0 +1,390 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// message is a message received by the broker.
+type message struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+}
+
+// broker is an in-process stand-in for a MQTT broker, it accepts a single
+// client at a time.
+type broker struct {
+	l net.Listener
+
+	// code is the return code sent in the connack packet
+	code byte
+
+	connects chan connect
+	messages chan message
+}
+
+func newBroker(t *testing.T, address string) *broker {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{
+		l:        l,
+		connects: make(chan connect, 10),
+		messages: make(chan message, 100),
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+func (b *broker) Close() {
+	b.l.Close()
+}
+
+// field reads a length prefixed field.
+func field(body []byte) ([]byte, []byte) {
+	n := binary.BigEndian.Uint16(body)
+	return body[2 : 2+n], body[2+n:]
+}
+
+// properties skips the properties of a MQTT 5 packet.
+func properties(body []byte) []byte {
+	n := int(body[0])
+	return body[1+n:]
+}
+
+func (b *broker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	p, err := readPacket(r)
+	if err != nil || p.kind != packetConnect {
+		return
+	}
+
+	c := connect{}
+
+	_, body := field(p.body)
+	c.version, body = body[0], body[1:]
+
+	flags := body[0]
+	c.keepAlive = binary.BigEndian.Uint16(body[1:])
+	body = body[3:]
+
+	if c.version == version5 {
+		body = properties(body)
+	}
+
+	var v []byte
+	v, body = field(body)
+	c.clientID = string(v)
+
+	if flags&0x80 != 0 {
+		v, body = field(body)
+		c.username = string(v)
+	}
+
+	if flags&0x40 != 0 {
+		v, _ = field(body)
+		c.password = string(v)
+	}
+
+	b.connects <- c
+
+	connack := []byte{0, b.code}
+	if c.version == version5 {
+		connack = append(connack, 0)
+	}
+
+	writePacket(conn, packet{kind: packetConnack, body: connack})
+
+	if b.code != 0 {
+		return
+	}
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch p.kind {
+		case packetPublish:
+			m := message{
+				qos:    (p.flags >> 1) & 0x03,
+				retain: p.flags&0x01 != 0,
+			}
+
+			topic, body := field(p.body)
+			m.topic = string(topic)
+
+			id := uint16(0)
+			if m.qos > 0 {
+				id, body = binary.BigEndian.Uint16(body), body[2:]
+			}
+
+			if c.version == version5 {
+				body = properties(body)
+			}
+
+			m.payload = body
+			b.messages <- m
+
+			switch m.qos {
+			case 1:
+				writePacket(conn, ack(packetPuback, id))
+			case 2:
+				writePacket(conn, ack(packetPubrec, id))
+			}
+		case packetPubrel:
+			id, _, _ := parseAck(p)
+			writePacket(conn, ack(packetPubcomp, id))
+		case packetPingreq:
+			writePacket(conn, packet{kind: packetPingresp})
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func (b *broker) message(t *testing.T) message {
+	select {
+	case m := <-b.messages:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	return message{}
+}
+
+func newChannel(t *testing.T, config string) *Backend {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(pushers.WithConfig(s.P))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func TestPublish(t *testing.T) {
+	for _, version := range []string{"3.1.1", "5"} {
+		for _, qos := range []byte{0, 1, 2} {
+			b := newBroker(t, "127.0.0.1:0")
+
+			c := newChannel(t, fmt.Sprintf(`broker="tcp://%s"
+version="%s"
+qos=%d
+retain=true
+client-id="sensor-1"
+username="user"
+password="secret"
+`, b.l.Addr(), version, qos))
+
+			c.Send(event.New(
+				event.Sensor("services"),
+				event.Category("ssh"),
+				event.Custom("ssh.username", "root"),
+			))
+
+			if err := c.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			expected := connect{
+				version:   version311,
+				clientID:  "sensor-1",
+				username:  "user",
+				password:  "secret",
+				keepAlive: 30,
+			}
+
+			if version == "5" {
+				expected.version = version5
+			}
+
+			if cn := <-b.connects; cn != expected {
+				t.Errorf("Expected connect %+v, got %+v", expected, cn)
+			}
+
+			m := b.message(t)
+			if m.topic != "honeytrap/services/ssh" || m.qos != qos || !m.retain {
+				t.Errorf("Unexpected message %s with qos %d (retain %t) for version %s", m.topic, m.qos, m.retain, version)
+			}
+
+			doc := map[string]interface{}{}
+			if err := json.Unmarshal(m.payload, &doc); err != nil {
+				t.Fatal(err)
+			} else if doc["ssh.username"] != "root" {
+				t.Errorf("Unexpected payload %s", string(m.payload))
+			}
+
+			if err := c.Close(); err != nil {
+				t.Error(err)
+			}
+
+			if err := pushers.Shutdown(c); err != nil {
+				t.Errorf("Expected flushing and closing again to succeed, got %s", err)
+			}
+
+			b.Close()
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	defer func(d time.Duration) {
+		minBackoff = d
+	}(minBackoff)
+
+	minBackoff = 10 * time.Millisecond
+
+	// reserve an address for the broker, which isn't running yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	l.Close()
+
+	c := newChannel(t, fmt.Sprintf(`broker="tcp://%s"
+buffer-size=2
+`, address))
+	defer c.Close()
+
+	for _, category := range []string{"a", "b", "c"} {
+		c.Send(event.New(event.Sensor("services"), event.Category(category)))
+	}
+
+	if err := c.Flush(); err != errNotConnected {
+		t.Fatalf("Expected %s, got %v", errNotConnected, err)
+	}
+
+	if stats := c.Stats(); stats.Queued != 2 || stats.Dropped != 1 {
+		t.Errorf("Expected 2 buffered and 1 dropped event, got %+v", stats)
+	}
+
+	b := newBroker(t, address)
+	defer b.Close()
+
+	// the oldest event has been dropped
+	for _, topic := range []string{"honeytrap/services/b", "honeytrap/services/c"} {
+		if m := b.message(t); m.topic != topic {
+			t.Errorf("Expected message for %s, got %s", topic, m.topic)
+		}
+	}
+}
+
+func TestRefused(t *testing.T) {
+	b := newBroker(t, "127.0.0.1:0")
+	defer b.Close()
+
+	b.code = 5
+
+	_, err := dial("tcp", b.l.Addr().String(), nil, connect{version: version311, clientID: "x"})
+	if err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("Expected not authorized, got %v", err)
+	}
+}
+
+func TestTopic(t *testing.T) {
+	b := &Backend{
+		Config: Config{
+			Topic: "honeytrap/{sensor}/{category}/{destination-port}",
+		},
+	}
+
+	e := event.New(
+		event.Category("http/#+"),
+		event.DestinationPort(80),
+	)
+
+	if topic := b.topic(e); topic != "honeytrap/unknown/http___/80" {
+		t.Errorf("Unexpected topic %s", topic)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for config, expected := range map[string]string{
+		`qos=1`:                    ErrBrokerNotSet.Error(),
+		`broker="udp://localhost"`: "unknown scheme udp for broker, expected tcp or tls",
+		`broker="tcp://localhost"` + "\nversion=\"3\"": "unknown version 3, expected 3.1.1 or 5",
+		`broker="tcp://localhost"` + "\nqos=3":         "invalid qos 3, expected 0, 1 or 2",
+	} {
+		s := struct {
+			P toml.Primitive
+		}{}
+
+		if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := New(pushers.WithConfig(s.P)); err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q for %s, got %v", expected, config, err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetPubrec     = 5
+	packetPubrel     = 6
+	packetPubcomp    = 7
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// Protocol levels.
+const (
+	version311 = 4
+	version5   = 5
+)
+
+// maxRemainingLength is the maximum size of a packet without fixed header.
+const maxRemainingLength = 268435455
+
+var errMalformed = errors.New("malformed packet")
+
+// packet is a MQTT control packet.
+type packet struct {
+	// kind is the packet type
+	kind byte
+	// flags are the flags of the fixed header
+	flags byte
+
+	body []byte
+}
+
+// readPacket reads a control packet.
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	length, err := readVarint(r)
+	if err != nil {
+		return packet{}, err
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+
+	return packet{
+		kind:  header >> 4,
+		flags: header & 0x0f,
+		body:  body,
+	}, nil
+}
+
+// writePacket writes the control packet with fixed header.
+func writePacket(w io.Writer, p packet) error {
+	if len(p.body) > maxRemainingLength {
+		return fmt.Errorf("packet of %d bytes exceeds maximum size", len(p.body))
+	}
+
+	buf := make([]byte, 0, len(p.body)+5)
+	buf = append(buf, p.kind<<4|p.flags)
+	buf = appendVarint(buf, len(p.body))
+	buf = append(buf, p.body...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func readVarint(r io.ByteReader) (int, error) {
+	value, multiplier := 0, 1
+
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		value += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return value, nil
+		}
+
+		multiplier *= 128
+	}
+
+	return 0, errMalformed
+}
+
+func appendVarint(b []byte, v int) []byte {
+	for {
+		digit := byte(v % 128)
+		if v /= 128; v > 0 {
+			digit |= 0x80
+		}
+
+		b = append(b, digit)
+
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// connect contains the fields of the connect packet.
+type connect struct {
+	version   byte
+	clientID  string
+	username  string
+	password  string
+	keepAlive uint16
+}
+
+func (c connect) packet() packet {
+	flags := byte(0x02) // clean session
+
+	if c.username != "" {
+		flags |= 0x80
+	}
+
+	if c.password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, c.version, flags)
+	body = appendUint16(body, c.keepAlive)
+
+	if c.version == version5 {
+		// no properties
+		body = appendVarint(body, 0)
+	}
+
+	body = appendString(body, c.clientID)
+
+	if c.username != "" {
+		body = appendString(body, c.username)
+	}
+
+	if c.password != "" {
+		body = appendString(body, c.password)
+	}
+
+	return packet{kind: packetConnect, body: body}
+}
+
+// publish contains the fields of the publish packet.
+type publish struct {
+	version byte
+	topic   string
+	id      uint16
+	qos     byte
+	retain  bool
+	payload []byte
+}
+
+func (p publish) packet() packet {
+	flags := p.qos << 1
+	if p.retain {
+		flags |= 0x01
+	}
+
+	body := appendString(nil, p.topic)
+
+	if p.qos > 0 {
+		body = appendUint16(body, p.id)
+	}
+
+	if p.version == version5 {
+		body = appendVarint(body, 0)
+	}
+
+	body = append(body, p.payload...)
+
+	return packet{kind: packetPublish, flags: flags, body: body}
+}
+
+// ack returns an acknowledgement packet (puback, pubrec, pubrel or pubcomp)
+// for the packet id.
+func ack(kind byte, id uint16) packet {
+	p := packet{kind: kind, body: appendUint16(nil, id)}
+
+	if kind == packetPubrel {
+		p.flags = 0x02
+	}
+
+	return p
+}
+
+// parseAck returns the packet id and reason code of an acknowledgement. The
+// reason code is only sent by MQTT 5 brokers, and is omitted on success.
+func parseAck(p packet) (uint16, byte, error) {
+	if len(p.body) < 2 {
+		return 0, 0, errMalformed
+	}
+
+	id := binary.BigEndian.Uint16(p.body)
+
+	if len(p.body) > 2 {
+		return id, p.body[2], nil
+	}
+
+	return id, 0, nil
+}
+
+// parseConnack returns the return code (MQTT 3.1.1) or reason code (MQTT 5)
+// of the connack packet.
+func parseConnack(p packet) (byte, error) {
+	if p.kind != packetConnack || len(p.body) < 2 {
+		return 0, errMalformed
+	}
+
+	return p.body[1], nil
+}
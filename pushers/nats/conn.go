@@ -0,0 +1,448 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+var (
+	dialTimeout = 10 * time.Second
+)
+
+var (
+	errConnectionLost = errors.New("connection to server lost")
+	errNoResponders   = errors.New("no stream listening on subject")
+)
+
+// info contains the fields of the info message of the server.
+type info struct {
+	ServerID    string `json:"server_id"`
+	Nonce       string `json:"nonce"`
+	TLSRequired bool   `json:"tls_required"`
+	Headers     bool   `json:"headers"`
+	MaxPayload  int    `json:"max_payload"`
+}
+
+// options contains the fields of the connect message.
+type options struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	TLSRequired  bool   `json:"tls_required"`
+	Name         string `json:"name,omitempty"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Echo         bool   `json:"echo"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+	Token        string `json:"auth_token,omitempty"`
+	JWT          string `json:"jwt,omitempty"`
+	NKey         string `json:"nkey,omitempty"`
+	Sig          string `json:"sig,omitempty"`
+}
+
+// message is a message received on the reply inbox.
+type message struct {
+	subject string
+	status  int
+	data    []byte
+}
+
+// conn is a connection to a NATS server, publishing is not safe for
+// concurrent use.
+type conn struct {
+	conn net.Conn
+	info info
+
+	m sync.Mutex
+	w *bufio.Writer
+
+	// inbox is the prefix of the reply subjects for JetStream acks
+	inbox string
+	reply uint64
+
+	messages chan message
+	pongs    chan struct{}
+
+	// done is closed when reading fails
+	done chan struct{}
+}
+
+// dial connects to the server, the connection is upgraded to tls when
+// configured or required by the server.
+func dial(address string, tlsConfig *tls.Config, o options, key *nkey) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := handshake(nc, tlsConfig, o, key)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func handshake(nc net.Conn, tlsConfig *tls.Config, o options, key *nkey) (*conn, error) {
+	nc.SetDeadline(time.Now().Add(dialTimeout))
+
+	r := bufio.NewReader(nc)
+
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		inbox:    "_INBOX." + xid.New().String(),
+		messages: make(chan message, 16),
+		pongs:    make(chan struct{}, 16),
+		done:     make(chan struct{}),
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		return nil, fmt.Errorf("unexpected message from server: %s", line)
+	} else if err := json.Unmarshal([]byte(line[5:]), &c.info); err != nil {
+		return nil, err
+	}
+
+	if c.info.TLSRequired && tlsConfig == nil {
+		host, _, _ := net.SplitHostPort(nc.RemoteAddr().String())
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+
+	if tlsConfig != nil {
+		tc := tls.Client(nc, tlsConfig)
+		if err := tc.Handshake(); err != nil {
+			return nil, err
+		}
+
+		nc = tc
+		r = bufio.NewReader(nc)
+
+		o.TLSRequired = true
+	}
+
+	if key != nil {
+		if o.JWT == "" {
+			o.NKey = key.public
+		}
+
+		o.Sig = key.sign(c.info.Nonce)
+	}
+
+	o.Headers = c.info.Headers
+	o.NoResponders = c.info.Headers
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fmt.Fprintf(nc, "CONNECT %s\r\nPING\r\nSUB %s.* 1\r\n", data, c.inbox); err != nil {
+		return nil, err
+	}
+
+	// the server responds to the ping after accepting the connection
+	line, err = readLine(r)
+	if err != nil {
+		return nil, err
+	} else if strings.HasPrefix(line, "-ERR") {
+		return nil, serverError(line)
+	} else if line != "PONG" {
+		return nil, fmt.Errorf("unexpected message from server: %s", line)
+	}
+
+	nc.SetDeadline(time.Time{})
+
+	c.conn = nc
+	c.w = bufio.NewWriter(nc)
+
+	go c.read(r)
+
+	return c, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// serverError returns the error of an -ERR message.
+func serverError(line string) error {
+	return errors.New(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+}
+
+func (c *conn) read(r *bufio.Reader) {
+	defer close(c.done)
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case line == "PING":
+			c.write("PONG\r\n")
+		case line == "PONG":
+			select {
+			case c.pongs <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "MSG "), strings.HasPrefix(line, "HMSG "):
+			m, err := readMessage(r, line)
+			if err != nil {
+				log.Errorf("Error reading message: %s", err.Error())
+				c.conn.Close()
+				return
+			}
+
+			select {
+			case c.messages <- m:
+			default:
+				// nobody is waiting for the ack anymore
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			err := serverError(line)
+			log.Errorf("Error from server: %s", err.Error())
+
+			// the server keeps the connection open when publishing
+			// isn't permitted
+			if !strings.Contains(strings.ToLower(err.Error()), "permissions violation") {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// readMessage reads the payload of a MSG or HMSG message, the status of the
+// headers is returned as status.
+func readMessage(r *bufio.Reader, line string) (message, error) {
+	fields := strings.Fields(line)
+
+	headers := fields[0] == "HMSG"
+
+	// MSG <subject> <sid> [reply] <size>
+	// HMSG <subject> <sid> [reply] <header size> <size>
+	min := 4
+	if headers {
+		min = 5
+	}
+
+	if len(fields) < min {
+		return message{}, fmt.Errorf("malformed message: %s", line)
+	}
+
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return message{}, err
+	}
+
+	headerSize := 0
+	if headers {
+		if headerSize, err = strconv.Atoi(fields[len(fields)-2]); err != nil {
+			return message{}, err
+		} else if headerSize > size {
+			return message{}, fmt.Errorf("malformed message: %s", line)
+		}
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return message{}, err
+	}
+
+	m := message{
+		subject: fields[1],
+		data:    data[headerSize:size],
+	}
+
+	if headers {
+		// NATS/1.0 503
+		status := strings.Fields(strings.SplitN(string(data[:headerSize]), "\r\n", 2)[0])
+		if len(status) > 1 {
+			m.status, _ = strconv.Atoi(status[1])
+		}
+	}
+
+	return m, nil
+}
+
+func (c *conn) write(format string, a ...interface{}) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+
+	fmt.Fprintf(c.w, format, a...)
+	return c.w.Flush()
+}
+
+// publish publishes the payload to the subject.
+func (c *conn) publish(subject string, payload []byte) error {
+	return c.write("PUB %s %d\r\n%s\r\n", subject, len(payload), payload)
+}
+
+// ack contains the fields of a JetStream publish acknowledgement.
+type ack struct {
+	Stream    string `json:"stream"`
+	Sequence  uint64 `json:"seq"`
+	Duplicate bool   `json:"duplicate"`
+
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// rejectedError is returned when the stream rejected the message.
+type rejectedError struct {
+	error
+}
+
+// isRejected returns true if the message won't be accepted by the stream when
+// publishing it again.
+func isRejected(err error) bool {
+	_, ok := err.(rejectedError)
+	return ok || err == errNoResponders
+}
+
+// publishJetStream publishes the payload to the subject, and waits for the
+// acknowledgement of the stream. The id is used by JetStream to detect
+// duplicates when the server supports headers.
+func (c *conn) publishJetStream(subject string, id string, payload []byte, timeout time.Duration) error {
+	c.reply++
+
+	reply := c.inbox + "." + strconv.FormatUint(c.reply, 10)
+
+	var err error
+	if id != "" && c.info.Headers {
+		header := "NATS/1.0\r\nNats-Msg-Id: " + id + "\r\n\r\n"
+		err = c.write("HPUB %s %s %d %d\r\n%s%s\r\n", subject, reply, len(header), len(header)+len(payload), header, payload)
+	} else {
+		err = c.write("PUB %s %s %d\r\n%s\r\n", subject, reply, len(payload), payload)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	expired := time.After(timeout)
+
+	for {
+		select {
+		case m := <-c.messages:
+			if m.subject != reply {
+				// ack of an earlier message that timed out
+				continue
+			}
+
+			if m.status == 503 {
+				return errNoResponders
+			}
+
+			a := ack{}
+			if err := json.Unmarshal(m.data, &a); err != nil {
+				return err
+			} else if a.Error != nil {
+				return rejectedError{fmt.Errorf("message rejected by stream: %s (%d)", a.Error.Description, a.Error.Code)}
+			}
+
+			return nil
+		case <-c.done:
+			return errConnectionLost
+		case <-expired:
+			return fmt.Errorf("timeout waiting for acknowledgement of stream")
+		}
+	}
+}
+
+// flush returns when the server has processed all published messages.
+func (c *conn) flush(timeout time.Duration) error {
+	// discard responses of pings sent by earlier flushes
+	for len(c.pongs) > 0 {
+		<-c.pongs
+	}
+
+	if err := c.write("PING\r\n"); err != nil {
+		return err
+	}
+
+	select {
+	case <-c.pongs:
+		return nil
+	case <-c.done:
+		return errConnectionLost
+	case <-time.After(timeout):
+		return fmt.Errorf("timeout waiting for server")
+	}
+}
+
+// closed returns true when the connection to the server has been lost.
+func (c *conn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) close() error {
+	c.m.Lock()
+	c.w.Flush()
+	c.m.Unlock()
+
+	return c.conn.Close()
+}
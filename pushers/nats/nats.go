@@ -0,0 +1,520 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package nats contains the event channel for publishing events to NATS,
+// optionally waiting for the acknowledgements of JetStream.
+package nats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/cmd"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = pushers.Register("nats", New)
+)
+
+var log = logging.MustGetLogger("channels/nats")
+
+var (
+	// ErrServersNotSet will be returned if no servers have been set in configuration
+	ErrServersNotSet = errors.New("NATS servers have not been set")
+
+	errNotConnected = errors.New("not connected to server")
+)
+
+var (
+	defaultSubject    = "honeytrap.{sensor}.{category}"
+	defaultAckTimeout = 5 * time.Second
+	defaultBufferSize = 10000
+
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Config defines a struct which holds configuration values for the nats
+// channel.
+type Config struct {
+	// Servers are the urls of the servers, eg. nats://localhost:4222 or
+	// tls://localhost:4222, the next server is used when reconnecting
+	Servers []string `toml:"servers"`
+
+	Name string `toml:"name"`
+
+	// Subject is the subject events are published to, fields of the event
+	// between braces are replaced by their value, eg. honeytrap.{category}
+	Subject string `toml:"subject"`
+
+	// JetStream configures if publishing waits for the acknowledgement of
+	// the stream
+	JetStream  bool         `toml:"jetstream"`
+	AckTimeout config.Delay `toml:"ack-timeout"`
+
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	Token    string `toml:"token"`
+
+	// NKey is the file containing the nkey seed of the user
+	NKey string `toml:"nkey"`
+
+	// Credentials is the file containing the user jwt and nkey seed
+	Credentials string `toml:"credentials"`
+
+	// BufferSize is the number of events buffered while disconnected, the
+	// oldest events are dropped when the buffer is full
+	BufferSize int `toml:"buffer-size"`
+
+	// Insecure configures if the certificate of the server should not be
+	// verified
+	Insecure bool `toml:"insecure"`
+
+	// CA is the file containing the certificates used to verify the server
+	CA string `toml:"ca"`
+}
+
+// server is a server to connect to.
+type server struct {
+	address   string
+	tlsConfig *tls.Config
+}
+
+// Backend defines a struct which provides a channel for publishing events to
+// NATS.
+type Backend struct {
+	Config
+
+	servers []server
+	options options
+	key     *nkey
+
+	conn *conn
+
+	// buffer holds the events until the server has accepted them, buffered
+	// is its length as reported by Stats
+	buffer   []event.Event
+	buffered int64
+
+	events pushers.Channel
+
+	queue *pushers.Queue
+
+	counters *pushers.Counters
+}
+
+// New returns a new nats channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	counters := &pushers.Counters{}
+
+	c := Backend{
+		Config: Config{
+			Name:       "honeytrap",
+			Subject:    defaultSubject,
+			AckTimeout: config.Delay(defaultAckTimeout),
+			BufferSize: defaultBufferSize,
+		},
+		queue:    pushers.NewQueue(100, counters),
+		counters: counters,
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.configure(); err != nil {
+		return nil, err
+	}
+
+	go c.run()
+
+	return &c, nil
+}
+
+// SetEvents sets the channel the connection state events are sent to.
+func (b *Backend) SetEvents(events pushers.Channel) {
+	b.events = events
+}
+
+// configure validates the configuration, and prepares connecting to the
+// servers.
+func (b *Backend) configure() error {
+	if len(b.Servers) == 0 {
+		return ErrServersNotSet
+	}
+
+	for _, s := range b.Servers {
+		u, err := url.Parse(s)
+		if err != nil {
+			return err
+		}
+
+		srv := server{
+			address: u.Host,
+		}
+
+		if u.Port() == "" {
+			srv.address = net.JoinHostPort(u.Hostname(), "4222")
+		}
+
+		switch u.Scheme {
+		case "nats":
+		case "tls":
+			srv.tlsConfig, err = tlsConfig(b.Insecure, b.CA)
+			if err != nil {
+				return err
+			}
+
+			srv.tlsConfig.ServerName = u.Hostname()
+		default:
+			return fmt.Errorf("unknown scheme %s for server, expected nats or tls", u.Scheme)
+		}
+
+		b.servers = append(b.servers, srv)
+	}
+
+	b.options = options{
+		Name:     b.Name,
+		Lang:     "go",
+		Version:  cmd.Version,
+		Protocol: 1,
+		User:     b.Username,
+		Pass:     b.Password,
+		Token:    b.Token,
+	}
+
+	var err error
+
+	if b.Credentials != "" && b.NKey != "" {
+		return errors.New("either nkey or credentials can be set")
+	} else if b.Credentials != "" {
+		b.options.JWT, b.key, err = readCredentials(b.Credentials)
+	} else if b.NKey != "" {
+		b.key, err = readSeed(b.NKey)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if b.AckTimeout <= 0 {
+		return fmt.Errorf("invalid ack-timeout %s", b.AckTimeout.Duration())
+	}
+
+	if b.BufferSize <= 0 {
+		return fmt.Errorf("invalid buffer-size %d", b.BufferSize)
+	}
+
+	return nil
+}
+
+func tlsConfig(insecure bool, ca string) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+
+	if ca == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", ca)
+	}
+
+	return config, nil
+}
+
+var placeholder = regexp.MustCompile(`\{([^}]+)\}`)
+
+// subject returns the subject of the event, the placeholders are replaced by
+// the values of the event. Wildcards, separators and whitespace within values
+// are replaced.
+func (b *Backend) subject(e event.Event) string {
+	return placeholder.ReplaceAllStringFunc(b.Subject, func(s string) string {
+		v, ok := e.Value(s[1 : len(s)-1])
+		if !ok {
+			return "unknown"
+		}
+
+		value := strings.Map(func(r rune) rune {
+			switch r {
+			case '.', '*', '>', ' ', '\t', '\r', '\n':
+				return '_'
+			}
+
+			return r
+		}, fmt.Sprint(v))
+
+		if value == "" {
+			return "unknown"
+		}
+
+		return value
+	})
+}
+
+// state sends an event with the state of the connection.
+func (b *Backend) state(t string, address string, err error) {
+	if b.events == nil {
+		return
+	}
+
+	options := []event.Option{
+		event.Sensor("channel"),
+		event.Category("nats"),
+		event.Type(t),
+		event.Custom("nats.server", address),
+	}
+
+	if err != nil {
+		options = append(options, event.Error(err))
+	}
+
+	// the event is sent asynchronously, as it may be routed to this channel
+	go b.events.Send(event.New(options...))
+}
+
+func (b *Backend) run() {
+	defer b.queue.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	backoff := minBackoff
+	next := 0
+
+	var retry <-chan time.Time
+	var address string
+
+	connect := func() {
+		srv := b.servers[next%len(b.servers)]
+		next++
+
+		conn, err := dial(srv.address, srv.tlsConfig, b.options, b.key)
+		if err != nil {
+			log.Errorf("Error connecting to server %s, retrying in %s: %s", srv.address, backoff, err.Error())
+
+			retry = time.After(backoff)
+
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+
+			return
+		}
+
+		log.Debugf("Connected to server %s", srv.address)
+
+		b.conn = conn
+		address = srv.address
+		backoff = minBackoff
+
+		b.state("connected", address, nil)
+	}
+
+	disconnect := func(err error) {
+		log.Errorf("Error publishing to server %s: %s", address, err.Error())
+
+		b.conn.close()
+		b.conn = nil
+
+		b.state("disconnected", address, err)
+
+		retry = time.After(0)
+	}
+
+	connect()
+
+	for {
+		if err := b.publish(); err != nil && b.conn != nil {
+			disconnect(err)
+		}
+
+		select {
+		case e, ok := <-b.queue.Events():
+			if !ok {
+				if err := b.publish(); err != nil {
+					log.Errorf("Error publishing buffered events: %s", err.Error())
+				}
+
+				b.counters.AddDropped(len(b.buffer))
+
+				if b.conn != nil {
+					b.conn.flush(b.AckTimeout.Duration())
+					b.conn.close()
+				}
+
+				return
+			}
+
+			b.add(e)
+		case errCh := <-b.queue.Flushes():
+		drain:
+			for {
+				select {
+				case e, ok := <-b.queue.Events():
+					if !ok {
+						break drain
+					}
+
+					b.add(e)
+				default:
+					break drain
+				}
+			}
+
+			err := b.publish()
+			if err == nil && b.conn != nil {
+				err = b.conn.flush(b.AckTimeout.Duration())
+			}
+
+			if err != nil && b.conn != nil {
+				disconnect(err)
+			}
+
+			errCh <- err
+		case <-retry:
+			retry = nil
+			connect()
+		case <-ticker.C:
+			if b.conn != nil && b.conn.closed() {
+				disconnect(errConnectionLost)
+			}
+		}
+	}
+}
+
+// add appends the event to the buffer, making room by dropping the oldest
+// event when the buffer is full.
+func (b *Backend) add(e event.Event) {
+	if len(b.buffer) >= b.BufferSize {
+		b.buffer = b.buffer[1:]
+		b.counters.AddDropped(1)
+	}
+
+	b.buffer = append(b.buffer, e)
+	atomic.StoreInt64(&b.buffered, int64(len(b.buffer)))
+}
+
+// publish sends the buffered events to the server in order, it stops at the
+// first event that couldn't be sent and returns the error.
+func (b *Backend) publish() error {
+	defer func() {
+		atomic.StoreInt64(&b.buffered, int64(len(b.buffer)))
+	}()
+
+	for len(b.buffer) > 0 {
+		if b.conn == nil {
+			return errNotConnected
+		}
+
+		e := b.buffer[0]
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			log.Errorf("Error marshaling event: %s", err.Error())
+			b.counters.AddErrors(1)
+		} else if !b.JetStream {
+			err = b.conn.publish(b.subject(e), payload)
+		} else if err = b.conn.publishJetStream(b.subject(e), e.ID(), payload, b.AckTimeout.Duration()); isRejected(err) {
+			// the event won't be accepted after reconnecting either
+			log.Errorf("Error publishing event to %s: %s", b.subject(e), err.Error())
+			b.counters.AddErrors(1)
+			err = nil
+		}
+
+		if err != nil {
+			// the event will be published again after reconnecting
+			return err
+		}
+
+		b.buffer = b.buffer[1:]
+
+		// buffer events that were sent while publishing
+		select {
+		case e, ok := <-b.queue.Events():
+			if ok {
+				b.add(e)
+			}
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Flush publishes the queued events and waits until the server has processed
+// them, it returns an error when either fails.
+func (b *Backend) Flush() error {
+	return b.queue.Flush()
+}
+
+// Stats returns the events waiting in the queue and the buffer, the events
+// dropped from the full buffer and the events that couldn't be published.
+func (b *Backend) Stats() pushers.Stats {
+	return b.counters.Stats(b.queue.Len() + int(atomic.LoadInt64(&b.buffered)))
+}
+
+// Close publishes the buffered events, waits until the server has processed
+// them and disconnects, events sent after Close are dropped. Calling Close
+// again has no effect.
+func (b *Backend) Close() error {
+	b.queue.Close()
+	return nil
+}
+
+// Send queues the event for publishing to the server.
+func (b *Backend) Send(e event.Event) {
+	b.queue.Send(e)
+}
@@ -0,0 +1,535 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package nats
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// seed and public key of the nkey authentication example of NATS.
+const (
+	testSeed   = "SUACSSL3UAHUDXKFSNVUZRF5UHPMWZ6BFDTJ7M6USDXIEDNPPQYYYCU3VY"
+	testPublic = "UDXU4RCSJNZOIQHZNWXHXORDPRTGNJAHAHFRGZNEEJCPQTT2M7NLCNF4"
+)
+
+// published is a message received by the server.
+type published struct {
+	subject string
+	reply   string
+	header  string
+	payload string
+}
+
+// natsServer is an in-process stand-in for a NATS server, with JetStream
+// acknowledging the messages that have a reply subject.
+type natsServer struct {
+	l net.Listener
+
+	info info
+
+	// ack is the response to messages with a reply subject
+	ack func(p published) string
+
+	connects chan options
+	messages chan published
+
+	m     sync.Mutex
+	conns []net.Conn
+}
+
+func newServer(t *testing.T, address string) *natsServer {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &natsServer{
+		l: l,
+		info: info{
+			ServerID: "test",
+			Nonce:    "nonce",
+			Headers:  true,
+		},
+		connects: make(chan options, 10),
+		messages: make(chan published, 100),
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			s.m.Lock()
+			s.conns = append(s.conns, conn)
+			s.m.Unlock()
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// Close stops the server and closes the connections.
+func (s *natsServer) Close() {
+	s.l.Close()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	data, _ := json.Marshal(s.info)
+	fmt.Fprintf(conn, "INFO %s\r\n", data)
+
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			o := options{}
+			json.Unmarshal([]byte(line[8:]), &o)
+
+			s.connects <- o
+
+			if o.NKey != "" && !verify(o.NKey, s.info.Nonce, o.Sig) {
+				fmt.Fprintf(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "PUB", "HPUB":
+			p := published{subject: fields[1]}
+
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+
+			headerSize := 0
+			if fields[0] == "HPUB" {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+				fields = fields[:len(fields)-1]
+			}
+
+			if len(fields) == 4 {
+				p.reply = fields[2]
+			}
+
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+
+			p.header = string(data[:headerSize])
+			p.payload = string(data[headerSize:size])
+
+			s.messages <- p
+
+			if p.reply == "" || s.ack == nil {
+				continue
+			}
+
+			if ack := s.ack(p); strings.HasPrefix(ack, "NATS/1.0") {
+				fmt.Fprintf(conn, "HMSG %s 1 %d %d\r\n%s\r\n", p.reply, len(ack), len(ack), ack)
+			} else {
+				fmt.Fprintf(conn, "MSG %s 1 %d\r\n%s\r\n", p.reply, len(ack), ack)
+			}
+		}
+	}
+}
+
+// verify verifies the signature of the nonce.
+func verify(public, nonce, sig string) bool {
+	raw, err := nkeyEncoding.DecodeString(public)
+	if err != nil || len(raw) != 35 {
+		return false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(ed25519.PublicKey(raw[1:33]), []byte(nonce), signature)
+}
+
+func (s *natsServer) message(t *testing.T) published {
+	select {
+	case p := <-s.messages:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	return published{}
+}
+
+// recorder records the state events of the channel.
+type recorder struct {
+	m      sync.Mutex
+	events []event.Event
+}
+
+func (r *recorder) Send(e event.Event) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) types() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	types := []string{}
+	for _, e := range r.events {
+		types = append(types, e.Get("type"))
+	}
+
+	return types
+}
+
+func newChannel(t *testing.T, config string, options ...func(pushers.Channel) error) *Backend {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(append([]func(pushers.Channel) error{pushers.WithConfig(s.P)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func testEvent(category string) event.Event {
+	return event.New(
+		event.Sensor("services"),
+		event.Category(category),
+		event.Custom("ssh.username", "root"),
+	)
+}
+
+func TestPublish(t *testing.T) {
+	s := newServer(t, "127.0.0.1:0")
+	defer s.Close()
+
+	c := newChannel(t, fmt.Sprintf(`servers=["nats://%s"]
+name="sensor-1"
+token="s3cr3t"
+`, s.l.Addr()))
+	defer c.Close()
+
+	c.Send(testEvent("ssh"))
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o := <-s.connects; o.Name != "sensor-1" || o.Token != "s3cr3t" || o.Echo {
+		t.Errorf("Unexpected connect %+v", o)
+	}
+
+	p := s.message(t)
+	if p.subject != "honeytrap.services.ssh" || p.reply != "" {
+		t.Errorf("Unexpected message %+v", p)
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(p.payload), &doc); err != nil {
+		t.Fatal(err)
+	} else if doc["ssh.username"] != "root" {
+		t.Errorf("Unexpected payload %s", p.payload)
+	}
+
+	// the deferred Close closes the channel again
+	if err := pushers.Shutdown(c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJetStream(t *testing.T) {
+	s := newServer(t, "127.0.0.1:0")
+	defer s.Close()
+
+	s.ack = func(p published) string {
+		switch {
+		case strings.HasSuffix(p.subject, ".full"):
+			return `{"error":{"code":503,"description":"maximum messages exceeded"}}`
+		case strings.HasSuffix(p.subject, ".missing"):
+			return "NATS/1.0 503\r\n\r\n"
+		}
+
+		return `{"stream":"HONEYTRAP","seq":1}`
+	}
+
+	c := newChannel(t, fmt.Sprintf(`servers=["nats://%s"]
+subject="honeytrap.{category}"
+jetstream=true
+`, s.l.Addr()))
+	defer c.Close()
+
+	e := testEvent("ssh")
+
+	c.Send(e)
+	c.Send(testEvent("full"))
+	c.Send(testEvent("missing"))
+	c.Send(testEvent("telnet"))
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := s.message(t)
+	if !strings.HasPrefix(p.reply, "_INBOX.") {
+		t.Errorf("Expected a reply inbox, got %+v", p)
+	}
+
+	if expected := "NATS/1.0\r\nNats-Msg-Id: " + e.ID() + "\r\n\r\n"; p.header != expected {
+		t.Errorf("Expected header %q, got %q", expected, p.header)
+	}
+
+	for _, subject := range []string{"honeytrap.full", "honeytrap.missing", "honeytrap.telnet"} {
+		if p := s.message(t); p.subject != subject {
+			t.Errorf("Expected message to %s, got %s", subject, p.subject)
+		}
+	}
+
+	// rejected events aren't published again
+	if stats := c.Stats(); stats.Errors != 2 || stats.Queued != 0 {
+		t.Errorf("Expected 2 errors, got %+v", stats)
+	}
+
+	if len(s.connects) != 1 {
+		t.Errorf("Expected a single connection, got %d", len(s.connects))
+	}
+}
+
+func TestNKey(t *testing.T) {
+	s := newServer(t, "127.0.0.1:0")
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "nats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "user.nk")
+	if err := ioutil.WriteFile(path, []byte(testSeed+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newChannel(t, fmt.Sprintf(`servers=["nats://%s"]
+nkey=%q
+`, s.l.Addr(), path))
+	defer c.Close()
+
+	c.Send(testEvent("ssh"))
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o := <-s.connects; o.NKey != testPublic {
+		t.Errorf("Expected nkey %s, got %s", testPublic, o.NKey)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "user.creds")
+	if err := ioutil.WriteFile(path, []byte(`-----BEGIN NATS USER JWT-----
+eyJ0eXAiOiJqd3QiLCJhbGciOiJlZDI1NTE5In0.e30.c2ln
+------END NATS USER JWT------
+
+************************* IMPORTANT *************************
+NKEY Seed printed below can be used to sign and prove identity.
+
+-----BEGIN USER NKEY SEED-----
+`+testSeed+`
+------END USER NKEY SEED------
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jwt, key, err := readCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if jwt != "eyJ0eXAiOiJqd3QiLCJhbGciOiJlZDI1NTE5In0.e30.c2ln" || key.public != testPublic {
+		t.Errorf("Unexpected credentials %s %s", jwt, key.public)
+	}
+
+	if !verify(key.public, "nonce", key.sign("nonce")) {
+		t.Errorf("Expected a valid signature")
+	}
+
+	if _, err := parseSeed(testSeed[:len(testSeed)-1] + "A"); err != errInvalidSeed {
+		t.Errorf("Expected checksum error, got %v", err)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	defer func(d time.Duration) {
+		minBackoff = d
+	}(minBackoff)
+
+	minBackoff = 10 * time.Millisecond
+
+	// reserve an address for the server, which isn't running yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	l.Close()
+
+	rec := &recorder{}
+
+	c := newChannel(t, fmt.Sprintf(`servers=["nats://%s"]
+buffer-size=2
+`, address), pushers.WithEvents(rec))
+	defer c.Close()
+
+	for _, category := range []string{"a", "b", "c"} {
+		c.Send(testEvent(category))
+	}
+
+	if err := c.Flush(); err != errNotConnected {
+		t.Fatalf("Expected %s, got %v", errNotConnected, err)
+	}
+
+	if stats := c.Stats(); stats.Queued != 2 || stats.Dropped != 1 {
+		t.Errorf("Expected 2 buffered and 1 dropped event, got %+v", stats)
+	}
+
+	s := newServer(t, address)
+
+	// the oldest event has been dropped
+	for _, subject := range []string{"honeytrap.services.b", "honeytrap.services.c"} {
+		if p := s.message(t); p.subject != subject {
+			t.Errorf("Expected message to %s, got %s", subject, p.subject)
+		}
+	}
+
+	s.Close()
+
+	for i := 0; i < 50 && len(rec.types()) < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if types := rec.types(); len(types) < 2 || types[0] != "connected" || types[1] != "disconnected" {
+		t.Errorf("Expected connected and disconnected events, got %v", types)
+	}
+}
+
+func TestSubject(t *testing.T) {
+	b := &Backend{
+		Config: Config{
+			Subject: "honeytrap.{sensor}.{category}.{destination-port}",
+		},
+	}
+
+	e := event.New(
+		event.Category("http.*> x"),
+		event.DestinationPort(80),
+	)
+
+	if subject := b.subject(e); subject != "honeytrap.unknown.http____x.80" {
+		t.Errorf("Unexpected subject %s", subject)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for config, expected := range map[string]string{
+		`name="x"`:                     ErrServersNotSet.Error(),
+		`servers=["http://localhost"]`: "unknown scheme http for server, expected nats or tls",
+		`servers=["nats://localhost"]` + "\nnkey=\"a\"" + "\ncredentials=\"b\"": "either nkey or credentials can be set",
+	} {
+		s := struct {
+			P toml.Primitive
+		}{}
+
+		if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := New(pushers.WithConfig(s.P)); err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q for %s, got %v", expected, config, err)
+		}
+	}
+}
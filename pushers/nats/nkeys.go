@@ -0,0 +1,174 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// Prefixes of encoded nkeys.
+const (
+	prefixSeed = 18 << 3
+	prefixUser = 20 << 3
+)
+
+var (
+	errInvalidSeed        = errors.New("invalid nkey seed")
+	errInvalidCredentials = errors.New("invalid credentials file, expected a user jwt and nkey seed")
+)
+
+var nkeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// nkey is the key pair of a nkey user, used to sign the nonce of the server.
+type nkey struct {
+	public     string
+	privateKey ed25519.PrivateKey
+}
+
+// parseSeed decodes an encoded user seed, eg. SUAM...
+func parseSeed(seed string) (*nkey, error) {
+	raw, err := nkeyEncoding.DecodeString(strings.TrimSpace(seed))
+	if err != nil {
+		return nil, errInvalidSeed
+	}
+
+	if len(raw) != 2+ed25519.SeedSize+2 {
+		return nil, errInvalidSeed
+	}
+
+	data, checksum := raw[:len(raw)-2], binary.LittleEndian.Uint16(raw[len(raw)-2:])
+	if crc16(data) != checksum {
+		return nil, errInvalidSeed
+	}
+
+	// the seed prefix is followed by the prefix of the public key
+	if data[0]&0xf8 != prefixSeed {
+		return nil, errInvalidSeed
+	}
+
+	if prefix := (data[0]&0x07)<<5 | (data[1]&0xf8)>>3; prefix != prefixUser {
+		return nil, errors.New("nkey seed is not a user seed")
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(data[2:])
+
+	public := append([]byte{prefixUser}, privateKey.Public().(ed25519.PublicKey)...)
+	public = append(public, 0, 0)
+	binary.LittleEndian.PutUint16(public[len(public)-2:], crc16(public[:len(public)-2]))
+
+	return &nkey{
+		public:     nkeyEncoding.EncodeToString(public),
+		privateKey: privateKey,
+	}, nil
+}
+
+// sign returns the signature of the nonce.
+func (k *nkey) sign(nonce string) string {
+	return base64.RawURLEncoding.EncodeToString(ed25519.Sign(k.privateKey, []byte(nonce)))
+}
+
+// readSeed reads the seed from the file.
+func readSeed(path string) (*nkey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSeed(string(data))
+}
+
+// readCredentials reads the user jwt and the nkey seed from a credentials
+// file, as generated by nsc.
+func readCredentials(path string) (string, *nkey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jwt, seed := "", ""
+
+	// the jwt and seed are on the line after the begin marker
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		var v *string
+		if strings.Contains(line, "BEGIN NATS USER JWT") {
+			v = &jwt
+		} else if strings.Contains(line, "BEGIN USER NKEY SEED") {
+			v = &seed
+		} else {
+			continue
+		}
+
+		if scanner.Scan() {
+			*v = strings.TrimSpace(scanner.Text())
+		}
+	}
+
+	if jwt == "" || seed == "" {
+		return "", nil, errInvalidCredentials
+	}
+
+	k, err := parseSeed(seed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return jwt, k, nil
+}
+
+// crc16 returns the CRC-16/XMODEM checksum used by nkeys.
+func crc16(data []byte) uint16 {
+	crc := uint16(0)
+
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
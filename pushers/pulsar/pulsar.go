@@ -207,5 +207,6 @@ func (p *producer) Send(e event.Event) {
 
 	p.ch <- Message{
 		Data: msg,
+		Key:  pushers.EventID(mp),
 	}
 }
@@ -0,0 +1,146 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"sync"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Queue queues the events of a channel for the goroutine delivering them.
+// Events sent after Close are dropped and counted, Flush and Close return
+// when the queue has been closed and the goroutine has stopped.
+type Queue struct {
+	ch    chan event.Event
+	flush chan chan error
+	done  chan struct{}
+
+	// m guards closed, Send holds it for reading while queueing so the
+	// events channel isn't closed while an event is sent to it
+	m      sync.RWMutex
+	closed bool
+
+	counters *Counters
+}
+
+// NewQueue returns a queue holding up to size events, events dropped by the
+// queue are added to counters.
+func NewQueue(size int, counters *Counters) *Queue {
+	return &Queue{
+		ch:       make(chan event.Event, size),
+		flush:    make(chan chan error),
+		done:     make(chan struct{}),
+		counters: counters,
+	}
+}
+
+// Events returns the queued events, the channel is closed by Close.
+func (q *Queue) Events() <-chan event.Event {
+	return q.ch
+}
+
+// Flushes returns the flush requests, the result of the flush is sent to the
+// request.
+func (q *Queue) Flushes() <-chan chan error {
+	return q.flush
+}
+
+// Done marks the goroutine delivering the events as stopped.
+func (q *Queue) Done() {
+	close(q.done)
+}
+
+// Len returns the number of queued events.
+func (q *Queue) Len() int {
+	return len(q.ch)
+}
+
+// Send queues the event, it blocks while the queue is full.
+func (q *Queue) Send(e event.Event) {
+	q.m.RLock()
+	defer q.m.RUnlock()
+
+	if q.closed {
+		q.counters.AddDropped(1)
+		return
+	}
+
+	q.ch <- e
+}
+
+// TrySend queues the event, it returns false when the event has been dropped
+// because the queue is full or closed.
+func (q *Queue) TrySend(e event.Event) bool {
+	q.m.RLock()
+	defer q.m.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.ch <- e:
+			return true
+		default:
+		}
+	}
+
+	q.counters.AddDropped(1)
+	return false
+}
+
+// Flush requests a flush and returns its result, there is nothing to flush
+// when the goroutine has stopped.
+func (q *Queue) Flush() error {
+	errCh := make(chan error, 1)
+
+	select {
+	case q.flush <- errCh:
+	case <-q.done:
+		return nil
+	}
+
+	return <-errCh
+}
+
+// Close closes the queue and waits until the goroutine has delivered the
+// queued events. It returns true for the call that closed the queue, the
+// caller releases the resources of the channel.
+func (q *Queue) Close() bool {
+	q.m.Lock()
+	first := !q.closed
+	if first {
+		q.closed = true
+		close(q.ch)
+	}
+	q.m.Unlock()
+
+	<-q.done
+	return first
+}
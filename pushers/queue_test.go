@@ -0,0 +1,93 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestQueueClose(t *testing.T) {
+	counters := &Counters{}
+	q := NewQueue(1, counters)
+
+	delivered := 0
+
+	go func() {
+		defer q.Done()
+
+		for {
+			select {
+			case _, ok := <-q.Events():
+				if !ok {
+					return
+				}
+
+				delivered++
+			case errCh := <-q.Flushes():
+				errCh <- nil
+			}
+		}
+	}()
+
+	q.Send(event.New())
+
+	if err := q.Flush(); err != nil {
+		t.Fatalf("Expected flush to succeed, got %s", err.Error())
+	}
+
+	if !q.Close() {
+		t.Fatal("Expected the first close to close the queue")
+	}
+
+	if q.Close() {
+		t.Fatal("Expected the second close to find the queue closed")
+	}
+
+	q.Send(event.New())
+
+	if q.TrySend(event.New()) {
+		t.Fatal("Expected an event sent after close to be dropped")
+	}
+
+	if err := q.Flush(); err != nil {
+		t.Fatalf("Expected flush after close to succeed, got %s", err.Error())
+	}
+
+	if delivered != 1 {
+		t.Fatalf("Expected 1 delivered event, got %d", delivered)
+	}
+
+	if stats := counters.Stats(q.Len()); stats.Dropped != 2 {
+		t.Fatalf("Expected 2 dropped events, got %d", stats.Dropped)
+	}
+}
@@ -127,7 +127,8 @@ func (b *AMQPObject) Send(e event.Event) {
 		false,
 		amqp.Publishing{
 			ContentType: "text/json",
-			Body: msg,
+			MessageId:   pushers.EventID(mp),
+			Body:        msg,
 		},
 	)
 	if err != nil {
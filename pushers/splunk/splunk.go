@@ -54,20 +54,37 @@ var log = logging.MustGetLogger("channels:splunk")
 type Backend struct {
 	Config
 
+	client hec.HEC
+
 	ch chan map[string]interface{}
+
+	flush chan chan error
+
+	counters *pushers.Counters
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := Backend{
-		ch: ch,
+		ch:       ch,
+		flush:    make(chan chan error),
+		counters: &pushers.Counters{},
 	}
 
 	for _, optionFn := range options {
 		optionFn(&c)
 	}
 
+	c.client = hec.NewCluster(
+		c.Config.Endpoints,
+		c.Config.Token,
+	)
+
+	c.client.SetHTTPClient(&http.Client{Transport: &http.Transport{
+		TLSClientConfig: c.tlsConfig,
+	}})
+
 	go c.run()
 
 	return &c, nil
@@ -77,45 +94,90 @@ func (hc Backend) run() {
 	log.Debug("Splunk indexer started...")
 	defer log.Debug("Splunk indexer stopped...")
 
-	client := hec.NewCluster(
-		hc.Config.Endpoints,
-		hc.Config.Token,
-	)
-
-	client.SetHTTPClient(&http.Client{Transport: &http.Transport{
-		TLSClientConfig: hc.tlsConfig,
-	}})
-
 	batch := []*hec.Event{}
 
 	count := 0
+
+	write := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := hc.client.WriteBatch(batch); err != nil {
+			log.Errorf("Error indexing: %s", err.Error())
+			hc.counters.AddErrors(len(batch))
+			return err
+		}
+
+		count += len(batch)
+
+		log.Infof("Bulk indexing: %d total %d", len(batch), count)
+
+		batch = []*hec.Event{}
+		return nil
+	}
+
+	add := func(doc map[string]interface{}) {
+		event := hec.NewEvent(doc)
+		event.SetTime(time.Now())
+
+		batch = append(batch, event)
+	}
+
 	for {
 		select {
 		case doc := <-hc.ch:
-			event := hec.NewEvent(doc)
-			event.SetTime(time.Now())
+			add(doc)
 
-			batch = append(batch, event)
 			if len(batch) < 10 {
 				continue
 			}
-		case <-time.After(time.Second * 10):
-		}
+		case errCh := <-hc.flush:
+			// add all queued documents before writing
+		drain:
+			for {
+				select {
+				case doc := <-hc.ch:
+					add(doc)
+				default:
+					break drain
+				}
+			}
 
-		if len(batch) == 0 {
+			errCh <- write()
 			continue
+		case <-time.After(time.Second * 10):
 		}
 
-		if err := client.WriteBatch(batch); err != nil {
-			log.Errorf("Error indexing: %s", err.Error())
-		} else {
-			count += len(batch)
+		write()
+	}
+}
 
-			log.Infof("Bulk indexing: %d total %d", len(batch), count)
+// Flush writes all queued events.
+func (hc Backend) Flush() error {
+	errCh := make(chan error)
+	hc.flush <- errCh
+	return <-errCh
+}
 
-			batch = []*hec.Event{}
-		}
+// Stats returns the number of queued events and the indexing errors.
+func (hc Backend) Stats() pushers.Stats {
+	return hc.counters.Stats(len(hc.ch))
+}
+
+// Deliver writes the events synchronously, it returns an error when the
+// batch couldn't be written.
+func (hc Backend) Deliver(events []event.Event) error {
+	batch := []*hec.Event{}
+
+	for _, e := range events {
+		event := hec.NewEvent(event.ToMap(e))
+		event.SetTime(time.Now())
+
+		batch = append(batch, event)
 	}
+
+	return hc.client.WriteBatch(batch)
 }
 
 // Send delivers the giving push messages into the internal elastic search endpoint.
@@ -0,0 +1,158 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// value is a field of a spooled event, the type is kept for the types channels
+// rely on, eg. the date being a time.Time and ports being ints.
+type value struct {
+	Type  string          `json:"t,omitempty"`
+	Value json.RawMessage `json:"v"`
+}
+
+// encode returns the event as json, keeping the types of the fields.
+func encode(e event.Event) ([]byte, error) {
+	fields := map[string]value{}
+
+	var err error
+
+	e.Range(func(k, v interface{}) bool {
+		key, ok := k.(string)
+		if !ok {
+			return true
+		}
+
+		t := ""
+
+		switch x := v.(type) {
+		case int:
+			t = "int"
+		case int64:
+			t = "int64"
+		case uint:
+			t = "uint"
+		case uint16:
+			t = "uint16"
+		case uint64:
+			t = "uint64"
+		case time.Time:
+			t = "time"
+		case []string:
+			t = "strings"
+		case net.IP:
+			v = x.String()
+		case error:
+			v = x.Error()
+		}
+
+		var data []byte
+		if data, err = json.Marshal(v); err != nil {
+			err = fmt.Errorf("could not encode field %s: %s", key, err.Error())
+			return false
+		}
+
+		fields[key] = value{t, data}
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
+
+// decode returns the event of the json.
+func decode(data []byte) (event.Event, error) {
+	fields := map[string]value{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return event.Event{}, err
+	}
+
+	// the stored fields are restored as is, without a new id and date
+	e := event.New()
+	e.Delete("id")
+	e.Delete("date")
+
+	for key, f := range fields {
+		var err error
+		var v interface{}
+
+		switch f.Type {
+		case "int":
+			var x int
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		case "int64":
+			var x int64
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		case "uint":
+			var x uint
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		case "uint16":
+			var x uint16
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		case "uint64":
+			var x uint64
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		case "time":
+			var x time.Time
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		case "strings":
+			var x []string
+			err = json.Unmarshal(f.Value, &x)
+			v = x
+		default:
+			err = json.Unmarshal(f.Value, &v)
+		}
+
+		if err != nil {
+			return event.Event{}, fmt.Errorf("could not decode field %s: %s", key, err.Error())
+		}
+
+		e.Store(key, v)
+	}
+
+	return e, nil
+}
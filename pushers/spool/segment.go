@@ -0,0 +1,247 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Records are stored as the length of the payload, the crc32 of the timestamp
+// and payload, the timestamp in unix nanoseconds and the payload.
+const headerSize = 16
+
+const segmentExt = ".seg"
+
+var errCorrupt = errors.New("corrupt record")
+
+// segment is a file containing records, only the last segment is written.
+type segment struct {
+	id uint64
+
+	// size is the size of the valid records
+	size int64
+	// events is the number of valid records
+	events int
+}
+
+func segmentPath(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+// listSegments returns the ids of the segments in the directory, in order.
+func listSegments(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint64{}
+
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+type record struct {
+	time    time.Time
+	payload []byte
+
+	// next is the offset of the next record
+	next int64
+}
+
+func appendRecord(w io.Writer, t time.Time, payload []byte) (int, error) {
+	buf := make([]byte, headerSize+len(payload))
+
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(t.UnixNano()))
+	copy(buf[headerSize:], payload)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+
+	return w.Write(buf)
+}
+
+// reader reads the records of a segment, starting at an offset.
+type reader struct {
+	f      *os.File
+	r      *bufio.Reader
+	offset int64
+}
+
+func openReader(path string, offset int64) (*reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &reader{
+		f:      f,
+		r:      bufio.NewReader(f),
+		offset: offset,
+	}, nil
+}
+
+// next returns the next record, io.EOF at the end of the segment and
+// errCorrupt for incomplete or invalid records.
+func (r *reader) next() (*record, error) {
+	header := make([]byte, headerSize)
+
+	if n, err := io.ReadFull(r.r, header); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%s after %d bytes at offset %d", errCorrupt, n, r.offset)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("%s of %d bytes at offset %d", errCorrupt, length, r.offset)
+	}
+
+	data := make([]byte, 8+length)
+	copy(data, header[8:16])
+
+	if _, err := io.ReadFull(r.r, data[8:]); err != nil {
+		return nil, fmt.Errorf("%s, truncated at offset %d", errCorrupt, r.offset)
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("%s, checksum mismatch at offset %d", errCorrupt, r.offset)
+	}
+
+	r.offset += headerSize + int64(length)
+
+	return &record{
+		time:    time.Unix(0, int64(binary.BigEndian.Uint64(header[8:16]))),
+		payload: data[8:],
+		next:    r.offset,
+	}, nil
+}
+
+func (r *reader) Close() error {
+	return r.f.Close()
+}
+
+// maxRecordSize protects against allocating huge buffers for corrupt lengths.
+const maxRecordSize = 64 << 20
+
+// scan returns the size and number of valid records of the segment, and the
+// number of records before offset.
+func scan(path string, offset int64) (size int64, events int, before int, err error) {
+	r, err := openReader(path, 0)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	defer r.Close()
+
+	for {
+		rec, err := r.next()
+		if err == io.EOF {
+			return size, events, before, nil
+		} else if err != nil {
+			log.Errorf("Ignoring the remainder of segment %s: %s", path, err.Error())
+			return size, events, before, nil
+		}
+
+		if rec.next <= offset {
+			before++
+		}
+
+		size = rec.next
+		events++
+	}
+}
+
+// position is the position of a record within the spool.
+type position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+func readPosition(path string) (position, error) {
+	p := position{}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+// writePosition replaces the position file atomically.
+func writePosition(path string, p position) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,825 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package spool contains a persistent spool for channels. Events are appended
+// to segment files before delivery, and acknowledged after they have been
+// delivered. Events that haven't been acknowledged are delivered in order when
+// the backend is reachable again, or after restarting.
+//
+// Channels implementing pushers.Deliverer acknowledge the delivery, events
+// are delivered again until the delivery succeeds. Other channels acknowledge
+// the events when they have been sent.
+package spool
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+var log = logging.MustGetLogger("channels/spool")
+
+const (
+	// DefaultSegmentSize is the size after which a new segment is started.
+	DefaultSegmentSize = 16 << 20
+	// DefaultBatchSize is the maximum number of events delivered at once.
+	DefaultBatchSize = 100
+
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	positionFile = "position"
+
+	// maxPending is the number of events kept in memory while the spool
+	// waits for the directory
+	maxPending = 10000
+)
+
+// Config contains the limits of the spool.
+type Config struct {
+	// MaxSize is the maximum size of the spool in bytes, the oldest events
+	// are dropped when exceeded. Zero means unlimited.
+	MaxSize int64
+	// MaxAge is the maximum time events are kept, older events are dropped
+	// instead of delivered. Zero means unlimited.
+	MaxAge time.Duration
+
+	SegmentSize int64
+	BatchSize   int
+}
+
+// Backlog contains the statistics of the events waiting for delivery.
+type Backlog struct {
+	Events int
+	Bytes  int64
+	// Oldest is the time the oldest waiting event has been spooled
+	Oldest time.Time
+}
+
+// Spool is a channel spooling the events on disk before delivering them to
+// the channel.
+type Spool struct {
+	dir     string
+	config  Config
+	channel pushers.Channel
+
+	m sync.Mutex
+
+	// segments contains the segments with events waiting for delivery, the
+	// first contains the acknowledged position, the last is being written
+	segments []*segment
+	w        *os.File
+
+	// ack is the position after the last acknowledged event, acked the
+	// number of acknowledged events of its segment
+	ack   position
+	acked int
+
+	backlog int
+	closed  bool
+
+	// pending contains the events sent before the spool has been opened
+	pending [][]byte
+	lock    *dirLock
+
+	counters pushers.Counters
+
+	notify chan struct{}
+	flush  chan chan error
+	// ready is closed when the spool has been opened
+	ready   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// New returns a spool within the directory, delivering to the channel.
+// Events spooled earlier will be delivered first.
+func New(channel pushers.Channel, dir string, config Config) (*Spool, error) {
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+
+	// keep a few segments within the maximum size, as only complete
+	// segments can be dropped
+	if config.MaxSize > 0 && config.SegmentSize > config.MaxSize/4 {
+		config.SegmentSize = config.MaxSize / 4
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:     dir,
+		config:  config,
+		channel: channel,
+		notify:  make(chan struct{}, 1),
+		flush:   make(chan chan error),
+		ready:   make(chan struct{}),
+		lock:    getLock(dir),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	atomic.AddInt32(&s.lock.waiting, 1)
+
+	go s.run()
+
+	return s, nil
+}
+
+// dirLock is the lock of a directory, a spool replacing another spool of the
+// same directory waits for it to be closed.
+type dirLock struct {
+	ch chan struct{}
+	// waiting is the number of spools waiting for the lock
+	waiting int32
+}
+
+var locks = struct {
+	sync.Mutex
+	dirs map[string]*dirLock
+}{
+	dirs: map[string]*dirLock{},
+}
+
+func getLock(dir string) *dirLock {
+	locks.Lock()
+	defer locks.Unlock()
+
+	dir = filepath.Clean(dir)
+
+	lock, ok := locks.dirs[dir]
+	if !ok {
+		lock = &dirLock{
+			ch: make(chan struct{}, 1),
+		}
+
+		locks.dirs[dir] = lock
+	}
+
+	return lock
+}
+
+// open reads the segments and the acknowledged position, and opens the last
+// segment for writing.
+func (s *Spool) open() error {
+	ids, err := listSegments(s.dir)
+	if err != nil {
+		return err
+	}
+
+	ack, err := readPosition(filepath.Join(s.dir, positionFile))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		path := segmentPath(s.dir, id)
+
+		if id < ack.Segment {
+			os.Remove(path)
+			continue
+		}
+
+		size, events, before, err := scan(path, ack.Offset)
+		if err != nil {
+			return err
+		}
+
+		seg := &segment{
+			id:     id,
+			size:   size,
+			events: events,
+		}
+
+		if len(s.segments) == 0 {
+			// the acknowledged position is within the first segment
+			if id != ack.Segment {
+				ack = position{Segment: id}
+				before = 0
+			}
+
+			s.acked = before
+		}
+
+		s.backlog += events
+		s.segments = append(s.segments, seg)
+	}
+
+	s.backlog -= s.acked
+
+	if len(s.segments) == 0 {
+		ack = position{Segment: ack.Segment + 1}
+
+		s.segments = append(s.segments, &segment{id: ack.Segment})
+	}
+
+	s.ack = ack
+
+	// continue writing after the valid records of the last segment, an
+	// incomplete record from a crash will be overwritten
+	last := s.segments[len(s.segments)-1]
+
+	w, err := os.OpenFile(segmentPath(s.dir, last.id), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Truncate(last.size); err != nil {
+		w.Close()
+		return err
+	}
+
+	if _, err := w.Seek(last.size, io.SeekStart); err != nil {
+		w.Close()
+		return err
+	}
+
+	s.w = w
+
+	if s.backlog > 0 {
+		log.Infof("Spool %s contains %d events waiting for delivery", s.dir, s.backlog)
+	}
+
+	return nil
+}
+
+// Send appends the event to the spool.
+func (s *Spool) Send(e event.Event) {
+	data, err := encode(e)
+	if err != nil {
+		log.Errorf("Error spooling event: %s", err.Error())
+		s.counters.AddErrors(1)
+		return
+	}
+
+	if err := s.append(data); err != nil {
+		log.Errorf("Error spooling event: %s", err.Error())
+		s.counters.AddDropped(1)
+		return
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Spool) append(data []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("spool %s is not open", s.dir)
+	}
+
+	select {
+	case <-s.ready:
+	default:
+		// the directory is used by the spool being replaced, the events
+		// are written when it has been closed
+		if len(s.pending) >= maxPending {
+			return fmt.Errorf("spool %s is not open yet", s.dir)
+		}
+
+		s.pending = append(s.pending, data)
+		s.backlog++
+		return nil
+	}
+
+	if s.w == nil {
+		return fmt.Errorf("spool %s is not open", s.dir)
+	}
+
+	return s.write(data)
+}
+
+// write appends the event to the last segment, the lock must be held.
+func (s *Spool) write(data []byte) error {
+
+	last := s.segments[len(s.segments)-1]
+
+	if last.size >= s.config.SegmentSize {
+		w, err := os.OpenFile(segmentPath(s.dir, last.id+1), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+
+		s.w.Close()
+		s.w = w
+
+		last = &segment{id: last.id + 1}
+		s.segments = append(s.segments, last)
+	}
+
+	n, err := appendRecord(s.w, time.Now(), data)
+	if err != nil {
+		// ignore the partial record, it will be overwritten
+		s.w.Truncate(last.size)
+		s.w.Seek(last.size, io.SeekStart)
+		return err
+	}
+
+	last.size += int64(n)
+	last.events++
+
+	s.backlog++
+	return nil
+}
+
+// writePending writes the events sent before the spool has been opened, the
+// lock must be held.
+func (s *Spool) writePending() {
+	pending := s.pending
+	s.pending = nil
+
+	// the pending events are counted again when written
+	s.backlog -= len(pending)
+
+	for _, data := range pending {
+		if err := s.write(data); err != nil {
+			log.Errorf("Error spooling event: %s", err.Error())
+			s.counters.AddDropped(1)
+		}
+	}
+}
+
+func (s *Spool) size() int64 {
+	size := int64(0)
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+
+	return size
+}
+
+// enforce drops the oldest segments while the spool exceeds its maximum size,
+// the lock must be held.
+func (s *Spool) enforce() {
+	if s.config.MaxSize <= 0 {
+		return
+	}
+
+	for len(s.segments) > 1 && s.size() > s.config.MaxSize {
+		oldest := s.segments[0]
+
+		dropped := oldest.events - s.acked
+
+		log.Warningf("Spool %s exceeds its maximum size, dropping %d events", s.dir, dropped)
+
+		s.counters.AddDropped(dropped)
+		s.backlog -= dropped
+
+		s.ack = position{Segment: s.segments[1].id}
+		s.acked = 0
+
+		s.removeFirst()
+		s.savePosition()
+	}
+}
+
+// removeFirst removes the first segment, the lock must be held.
+func (s *Spool) removeFirst() {
+	if err := os.Remove(segmentPath(s.dir, s.segments[0].id)); err != nil {
+		log.Errorf("Error removing segment: %s", err.Error())
+	}
+
+	s.segments = s.segments[1:]
+}
+
+func (s *Spool) savePosition() {
+	if err := writePosition(filepath.Join(s.dir, positionFile), s.ack); err != nil {
+		log.Errorf("Error saving position of spool %s: %s", s.dir, err.Error())
+	}
+}
+
+// entry is an event read from the spool.
+type entry struct {
+	event   event.Event
+	segment uint64
+	next    int64
+
+	// expired events are acknowledged without being delivered
+	expired bool
+}
+
+// read returns the events after the acknowledged position, the lock must
+// be held.
+func (s *Spool) read() ([]entry, error) {
+	entries := []entry{}
+
+	offset := s.ack.Offset
+
+	for _, seg := range s.segments {
+		if len(entries) >= s.config.BatchSize {
+			break
+		}
+
+		if offset >= seg.size {
+			offset = 0
+			continue
+		}
+
+		r, err := openReader(segmentPath(s.dir, seg.id), offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for r.offset < seg.size && len(entries) < s.config.BatchSize {
+			rec, err := r.next()
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+
+			ent := entry{
+				segment: seg.id,
+				next:    rec.next,
+			}
+
+			if s.config.MaxAge > 0 && time.Since(rec.time) > s.config.MaxAge {
+				ent.expired = true
+			} else if e, err := decode(rec.payload); err != nil {
+				log.Errorf("Error decoding spooled event: %s", err.Error())
+				ent.expired = true
+			} else {
+				ent.event = e
+			}
+
+			entries = append(entries, ent)
+		}
+
+		r.Close()
+
+		offset = 0
+	}
+
+	return entries, nil
+}
+
+// acknowledge moves the acknowledged position after the entries, and removes
+// the segments that have been delivered completely.
+func (s *Spool) acknowledge(entries []entry) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, ent := range entries {
+		// dropped while delivering
+		if ent.segment < s.ack.Segment || (ent.segment == s.ack.Segment && ent.next <= s.ack.Offset) {
+			continue
+		}
+
+		for s.segments[0].id != ent.segment {
+			s.removeFirst()
+			s.acked = 0
+		}
+
+		if ent.expired {
+			s.counters.AddDropped(1)
+		}
+
+		s.ack = position{Segment: ent.segment, Offset: ent.next}
+		s.acked++
+		s.backlog--
+	}
+
+	for len(s.segments) > 1 && s.ack.Offset >= s.segments[0].size {
+		s.removeFirst()
+
+		s.ack = position{Segment: s.segments[0].id}
+		s.acked = 0
+	}
+
+	s.savePosition()
+}
+
+// deliver delivers the events that haven't expired.
+func (s *Spool) deliver(entries []entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic delivering events: %v", r)
+		}
+	}()
+
+	events := []event.Event{}
+	for _, ent := range entries {
+		if !ent.expired {
+			events = append(events, ent.event)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	if d, ok := s.channel.(pushers.Deliverer); ok {
+		return d.Deliver(events)
+	}
+
+	for _, e := range events {
+		s.channel.Send(e)
+	}
+
+	return nil
+}
+
+func (s *Spool) run() {
+	defer close(s.stopped)
+
+	select {
+	case s.lock.ch <- struct{}{}:
+		atomic.AddInt32(&s.lock.waiting, -1)
+	case <-s.done:
+		atomic.AddInt32(&s.lock.waiting, -1)
+		return
+	}
+
+	defer func() {
+		<-s.lock.ch
+	}()
+
+	s.m.Lock()
+
+	err := s.open()
+	if err == nil {
+		s.writePending()
+	} else {
+		s.counters.AddDropped(len(s.pending))
+		s.backlog -= len(s.pending)
+		s.pending = nil
+	}
+
+	close(s.ready)
+
+	s.m.Unlock()
+
+	if err != nil {
+		log.Errorf("Error opening spool %s: %s", s.dir, err.Error())
+		return
+	}
+
+	defer func() {
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		s.savePosition()
+		s.w.Close()
+	}()
+
+	backoff := time.Duration(0)
+
+	// flushes are waiting for the backlog to be delivered
+	flushes := []chan error{}
+
+	reply := func(err error) {
+		for _, errCh := range flushes {
+			errCh <- err
+		}
+
+		flushes = flushes[:0]
+	}
+
+	for {
+		s.m.Lock()
+		s.enforce()
+		entries, err := s.read()
+		s.m.Unlock()
+
+		if err != nil {
+			err = fmt.Errorf("error reading spool %s: %s", s.dir, err.Error())
+		} else if len(entries) == 0 {
+			reply(nil)
+
+			select {
+			case <-s.notify:
+			case errCh := <-s.flush:
+				flushes = append(flushes, errCh)
+			case <-s.done:
+				return
+			}
+
+			continue
+		} else if err = s.deliver(entries); err == nil {
+			s.acknowledge(entries)
+
+			backoff = 0
+			continue
+		} else {
+			s.counters.AddErrors(len(entries))
+		}
+
+		reply(err)
+
+		if backoff *= 2; backoff < minBackoff {
+			backoff = minBackoff
+		} else if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		log.Errorf("Error delivering spooled events, retrying in %s: %s", backoff, err.Error())
+
+		timer := time.NewTimer(backoff)
+
+	wait:
+		for {
+			select {
+			case <-timer.C:
+				break wait
+			case <-s.notify:
+				// enforce the limits while the backend is unavailable
+				s.m.Lock()
+				s.enforce()
+				s.m.Unlock()
+			case errCh := <-s.flush:
+				flushes = append(flushes, errCh)
+				timer.Stop()
+				break wait
+			case <-s.done:
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
+
+// Flush tries to deliver the spooled events, it returns the error if the
+// delivery fails. The events stay spooled in that case. When a spool replacing
+// this spool waits for the directory, the events are left for it to deliver.
+func (s *Spool) Flush() error {
+	select {
+	case <-s.ready:
+		// the lock is held by this spool, the others are waiting
+		if atomic.LoadInt32(&s.lock.waiting) > 0 {
+			return nil
+		}
+	default:
+	}
+
+	errCh := make(chan error, 1)
+
+	select {
+	case s.flush <- errCh:
+	case <-s.stopped:
+		return nil
+	}
+
+	return <-errCh
+}
+
+// Close stops delivering, and shuts down the channel. Spooled events will
+// be delivered when the spool is opened again. Calling Close again has no
+// effect.
+func (s *Spool) Close() error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+
+		<-s.stopped
+		return nil
+	}
+
+	s.closed = true
+
+	if len(s.pending) > 0 {
+		log.Warningf("Spool %s closed before it has been opened, dropping %d events", s.dir, len(s.pending))
+
+		s.counters.AddDropped(len(s.pending))
+		s.backlog -= len(s.pending)
+		s.pending = nil
+	}
+
+	s.m.Unlock()
+
+	close(s.done)
+	<-s.stopped
+
+	return pushers.Shutdown(s.channel)
+}
+
+// Stats returns the number of events waiting for delivery, and the delivery
+// errors and dropped events of the spool.
+func (s *Spool) Stats() pushers.Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.counters.Stats(s.backlog)
+}
+
+// Backlog returns the statistics of the events waiting for delivery.
+func (s *Spool) Backlog() Backlog {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	b := Backlog{
+		Events: s.backlog,
+		Bytes:  s.size() - s.ack.Offset,
+	}
+
+	if s.backlog == 0 {
+		return b
+	}
+
+	// the oldest event is the first with a position after the acknowledged
+	// position
+	offset := s.ack.Offset
+	for _, seg := range s.segments {
+		if offset >= seg.size {
+			offset = 0
+			continue
+		}
+
+		r, err := openReader(segmentPath(s.dir, seg.id), offset)
+		if err != nil {
+			break
+		}
+
+		if rec, err := r.next(); err == nil {
+			b.Oldest = rec.time
+		}
+
+		r.Close()
+		break
+	}
+
+	return b
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"TB", 1 << 40},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize parses sizes like "512MB" or "1GB", units are powers of 1024.
+// Sizes without a unit are in bytes.
+func ParseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(n * float64(unit)), nil
+}
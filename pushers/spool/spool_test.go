@@ -0,0 +1,370 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/event/ecs"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// deliverer delivers the events, or fails while unavailable.
+type deliverer struct {
+	m           sync.Mutex
+	unavailable bool
+	events      []event.Event
+}
+
+func (d *deliverer) Send(e event.Event) {
+	d.Deliver([]event.Event{e})
+}
+
+func (d *deliverer) Deliver(events []event.Event) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.unavailable {
+		return errors.New("unavailable")
+	}
+
+	d.events = append(d.events, events...)
+	return nil
+}
+
+func (d *deliverer) setUnavailable(v bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	d.unavailable = v
+}
+
+func (d *deliverer) messages() []string {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	messages := []string{}
+	for _, e := range d.events {
+		messages = append(messages, e.Get("message"))
+	}
+
+	return messages
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func send(s *Spool, messages ...string) {
+	for _, message := range messages {
+		s.Send(event.New(event.Custom("message", message)))
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d := &deliverer{unavailable: true}
+
+	s, err := New(d, dir, Config{SegmentSize: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(s, "a", "b", "c", "d")
+
+	if err := s.Flush(); err == nil {
+		t.Fatal("Expected flush to fail while unavailable")
+	}
+
+	if backlog := s.Backlog(); backlog.Events != 4 || backlog.Oldest.IsZero() {
+		t.Fatalf("Expected backlog of 4 events, got %+v", backlog)
+	}
+
+	s.Close()
+
+	// the events are delivered after reopening
+	d.setUnavailable(false)
+
+	s, err = New(d, dir, Config{SegmentSize: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(s, "e")
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := d.messages(); !reflect.DeepEqual(messages, []string{"a", "b", "c", "d", "e"}) {
+		t.Fatalf("Expected events in order, got %v", messages)
+	}
+
+	if stats := s.Stats(); stats.Queued != 0 || stats.Dropped != 0 {
+		t.Fatalf("Expected empty spool, got %+v", stats)
+	}
+
+	s.Close()
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected closing again to succeed, got %s", err)
+	}
+
+	// acknowledged events aren't delivered again
+	s, err = New(d, dir, Config{SegmentSize: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := d.messages(); len(messages) != 5 {
+		t.Fatalf("Expected no events delivered again, got %v", messages)
+	}
+
+	if ids, _ := listSegments(dir); len(ids) != 1 {
+		t.Fatalf("Expected delivered segments to be removed, got %d segments", len(ids))
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d := &deliverer{unavailable: true}
+
+	s, err := New(d, dir, Config{MaxSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	for i := 0; i < 50; i++ {
+		send(s, "message")
+	}
+
+	s.Flush()
+
+	if backlog := s.Backlog(); backlog.Bytes > 1024 {
+		t.Fatalf("Expected backlog within maximum size, got %d bytes", backlog.Bytes)
+	}
+
+	stats := s.Stats()
+	if stats.Dropped == 0 || stats.Queued+int(stats.Dropped) != 50 {
+		t.Fatalf("Expected oldest events to be dropped, got %+v", stats)
+	}
+}
+
+func TestSpoolMaxAge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d := &deliverer{unavailable: true}
+
+	s, err := New(d, dir, Config{MaxAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	send(s, "expired")
+	s.Flush()
+
+	time.Sleep(20 * time.Millisecond)
+
+	d.setUnavailable(false)
+
+	send(s, "fresh")
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := d.messages(); !reflect.DeepEqual(messages, []string{"fresh"}) {
+		t.Fatalf("Expected expired event to be dropped, got %v", messages)
+	}
+
+	if stats := s.Stats(); stats.Dropped != 1 {
+		t.Fatalf("Expected 1 dropped event, got %+v", stats)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	date := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	e := event.New(
+		event.Custom("date", date),
+		event.SourceIP(net.ParseIP("192.0.2.1")),
+		event.SourcePort(2222),
+		event.Custom("count", uint64(3)),
+		event.Custom("tags", []string{"a", "b"}),
+		event.Custom("authenticated", true),
+	)
+
+	data, err := encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, expected := range map[string]interface{}{
+		"date":          date,
+		"source-ip":     "192.0.2.1",
+		"source-port":   uint16(2222),
+		"count":         uint64(3),
+		"tags":          []string{"a", "b"},
+		"authenticated": true,
+	} {
+		if v, _ := d.Value(k); !reflect.DeepEqual(v, expected) {
+			t.Errorf("Expected %s to be %#v, got %#v", k, expected, v)
+		}
+	}
+}
+
+func TestCodecID(t *testing.T) {
+	e := ecs.Convert(event.New(event.Category("ssh")))
+
+	data, err := encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := pushers.EventID(event.ToMap(d)); id == "" || id != pushers.EventID(event.ToMap(e)) {
+		t.Errorf("Expected id %s to be kept, got %s", pushers.EventID(event.ToMap(e)), id)
+	}
+
+	if d.Has("id") || d.Has("date") {
+		t.Errorf("Expected no id and date besides the ECS fields, got %s and %v", d.Get("id"), d.Has("date"))
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"1024":   1024,
+		"512MB":  512 << 20,
+		"1.5 gb": 3 << 29,
+		"10k":    10 << 10,
+	} {
+		if size, err := ParseSize(s); err != nil || size != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", s, expected, size, err)
+		}
+	}
+
+	if _, err := ParseSize("lots"); err == nil {
+		t.Error("Expected invalid size to fail")
+	}
+}
+
+func TestSpoolReplace(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d := &deliverer{unavailable: true}
+
+	prev, err := New(d, dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(prev, "a")
+	prev.Flush()
+
+	// the spool replacing the previous spool opens the directory when the
+	// previous spool has been closed
+	s, err := New(d, dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	done := make(chan struct{})
+	go func() {
+		send(s, "b")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected send not to wait for the previous spool")
+	}
+
+	// the events are left for the replacing spool
+	if err := prev.Flush(); err != nil {
+		t.Fatalf("Expected flush to leave the events, got %s", err)
+	}
+
+	if messages := d.messages(); len(messages) != 0 {
+		t.Fatalf("Expected no events before closing the previous spool, got %v", messages)
+	}
+
+	d.setUnavailable(false)
+	prev.Close()
+
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := d.messages(); !reflect.DeepEqual(messages, []string{"a", "b"}) {
+		t.Fatalf("Expected events in order, got %v", messages)
+	}
+}
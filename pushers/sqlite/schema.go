@@ -0,0 +1,304 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/rs/xid"
+)
+
+// dateFormat stores dates with a fixed width, so they sort as text and can be
+// used with the date and time functions of sqlite.
+const dateFormat = "2006-01-02T15:04:05.000000000Z"
+
+// schema contains the tables and indexes, the events table contains every
+// event with the complete event as json, the other tables are normalized views
+// on the events for the common queries.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS events (
+		id TEXT PRIMARY KEY,
+		date TEXT NOT NULL,
+		category TEXT,
+		type TEXT,
+		sensor TEXT,
+		service TEXT,
+		source_ip TEXT,
+		source_port INTEGER,
+		destination_ip TEXT,
+		destination_port INTEGER,
+		session_id TEXT,
+		parent_id TEXT,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS events_date ON events (date)`,
+	`CREATE INDEX IF NOT EXISTS events_source_ip ON events (source_ip)`,
+	`CREATE INDEX IF NOT EXISTS events_category ON events (category)`,
+	`CREATE INDEX IF NOT EXISTS events_session_id ON events (session_id)`,
+
+	`CREATE TABLE IF NOT EXISTS connections (
+		session_id TEXT PRIMARY KEY,
+		opened TEXT,
+		closed TEXT,
+		service TEXT,
+		source_ip TEXT,
+		source_port INTEGER,
+		destination_ip TEXT,
+		destination_port INTEGER,
+		bytes_in INTEGER,
+		bytes_out INTEGER,
+		duration REAL,
+		close_reason TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS connections_opened ON connections (opened)`,
+	`CREATE INDEX IF NOT EXISTS connections_source_ip ON connections (source_ip)`,
+
+	`CREATE TABLE IF NOT EXISTS credentials (
+		id INTEGER PRIMARY KEY,
+		event_id TEXT NOT NULL,
+		date TEXT NOT NULL,
+		session_id TEXT,
+		category TEXT,
+		source_ip TEXT,
+		username TEXT,
+		password TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS credentials_date ON credentials (date)`,
+	`CREATE INDEX IF NOT EXISTS credentials_source_ip ON credentials (source_ip)`,
+	`CREATE INDEX IF NOT EXISTS credentials_username ON credentials (username)`,
+
+	`CREATE TABLE IF NOT EXISTS commands (
+		id INTEGER PRIMARY KEY,
+		event_id TEXT NOT NULL,
+		date TEXT NOT NULL,
+		session_id TEXT,
+		category TEXT,
+		source_ip TEXT,
+		command TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS commands_date ON commands (date)`,
+	`CREATE INDEX IF NOT EXISTS commands_source_ip ON commands (source_ip)`,
+	`CREATE INDEX IF NOT EXISTS commands_session_id ON commands (session_id)`,
+}
+
+// row contains the values of an event as stored in the tables.
+type row struct {
+	doc  map[string]interface{}
+	id   string
+	date string
+}
+
+func newRow(e event.Event) row {
+	doc := event.ToMap(e)
+
+	id, _ := doc["id"].(string)
+	if id == "" {
+		id = xid.New().String()
+		doc["id"] = id
+	}
+
+	date, ok := doc["date"].(time.Time)
+	if !ok {
+		date = time.Now()
+	}
+
+	return row{
+		doc:  doc,
+		id:   id,
+		date: date.UTC().Format(dateFormat),
+	}
+}
+
+// value returns the value of the key, or nil when the event doesn't contain
+// the key or the value can't be stored in a column.
+func (r row) value(key string) interface{} {
+	switch v := r.doc[key].(type) {
+	case string, bool, float32, float64,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64:
+		return v
+	}
+
+	return nil
+}
+
+// suffix returns the string value of the first key that ends with the suffix,
+// services store fields like ssh.username or telnet.command.
+func (r row) suffix(suffix string) (string, bool) {
+	for k, v := range r.doc {
+		if !strings.HasSuffix(k, suffix) {
+			continue
+		}
+
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+	}
+
+	return "", false
+}
+
+// insert stores the event in the events table, and the normalized tables it
+// belongs in. Events that have been stored before are skipped.
+func (r row) insert(tx *sql.Tx) error {
+	data, err := json.Marshal(r.doc)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`INSERT OR IGNORE INTO events (
+		id, date, category, type, sensor, service,
+		source_ip, source_port, destination_ip, destination_port,
+		session_id, parent_id, data
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.id, r.date, r.value("category"), r.value("type"), r.value("sensor"), r.value("service"),
+		r.value("source-ip"), r.value("source-port"), r.value("destination-ip"), r.value("destination-port"),
+		r.value("session-id"), r.value("parent-id"), string(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return nil
+	}
+
+	if err := r.insertConnection(tx); err != nil {
+		return err
+	}
+
+	username, hasUsername := r.suffix(".username")
+	password, hasPassword := r.suffix(".password")
+
+	if hasUsername || hasPassword {
+		if _, err := tx.Exec(`INSERT INTO credentials (
+			event_id, date, session_id, category, source_ip, username, password
+		) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.id, r.date, r.value("session-id"), r.value("category"), r.value("source-ip"), username, password,
+		); err != nil {
+			return err
+		}
+	}
+
+	if command, ok := r.suffix(".command"); ok {
+		if _, err := tx.Exec(`INSERT INTO commands (
+			event_id, date, session_id, category, source_ip, command
+		) VALUES (?, ?, ?, ?, ?, ?)`,
+			r.id, r.date, r.value("session-id"), r.value("category"), r.value("source-ip"), command,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertConnection adds or updates the connection of connection opened and
+// closed events, connections are identified by their session.
+func (r row) insertConnection(tx *sql.Tx) error {
+	sessionID, _ := r.doc["session-id"].(string)
+	if sessionID == "" {
+		return nil
+	}
+
+	switch r.doc["type"] {
+	case "CONNECTION:OPENED":
+		_, err := tx.Exec(`INSERT INTO connections (
+			session_id, opened, service, source_ip, source_port, destination_ip, destination_port
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (session_id) DO UPDATE SET
+			opened = excluded.opened,
+			service = coalesce(connections.service, excluded.service)`,
+			sessionID, r.date, r.value("service"),
+			r.value("source-ip"), r.value("source-port"), r.value("destination-ip"), r.value("destination-port"),
+		)
+		return err
+	case "CONNECTION:CLOSED":
+		_, err := tx.Exec(`INSERT INTO connections (
+			session_id, closed, service, source_ip, source_port, destination_ip, destination_port,
+			bytes_in, bytes_out, duration, close_reason
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (session_id) DO UPDATE SET
+			closed = excluded.closed,
+			service = coalesce(excluded.service, connections.service),
+			bytes_in = excluded.bytes_in,
+			bytes_out = excluded.bytes_out,
+			duration = excluded.duration,
+			close_reason = excluded.close_reason`,
+			sessionID, r.date, r.value("service"),
+			r.value("source-ip"), r.value("source-port"), r.value("destination-ip"), r.value("destination-port"),
+			r.value("bytes-in"), r.value("bytes-out"), r.value("duration"), r.value("close-reason"),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// prune deletes the rows before the date.
+func prune(db *sql.DB, before time.Time) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	date := before.UTC().Format(dateFormat)
+
+	res, err := tx.Exec(`DELETE FROM events WHERE date < ?`, date)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, q := range []string{
+		`DELETE FROM connections WHERE coalesce(closed, opened) < ?`,
+		`DELETE FROM credentials WHERE date < ?`,
+		`DELETE FROM commands WHERE date < ?`,
+	} {
+		if _, err := tx.Exec(q, date); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, tx.Commit()
+}
@@ -0,0 +1,343 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+
+	// pure go sqlite driver, registered as sqlite
+	_ "modernc.org/sqlite"
+)
+
+var (
+	_ = pushers.Register("sqlite", New)
+)
+
+var log = logging.MustGetLogger("channels/sqlite")
+
+const (
+	defaultPath          = "honeytrap.db"
+	defaultBatchSize     = 500
+	defaultBatchInterval = time.Second
+	defaultRetention     = 30 * 24 * time.Hour
+	defaultPruneInterval = time.Hour
+	defaultBusyTimeout   = 5 * time.Second
+)
+
+// Config defines the config used to setup the sqlite channel.
+type Config struct {
+	// Path is the database file, relative paths are relative to the data
+	// directory.
+	Path string `toml:"path"`
+
+	// BatchSize is the maximum number of events written in a transaction.
+	BatchSize int `toml:"batch-size"`
+	// BatchInterval is the maximum time events are queued before written.
+	BatchInterval config.Delay `toml:"batch-interval"`
+
+	// Retention is how long events are kept, a retention of 0 keeps events
+	// forever.
+	Retention config.Delay `toml:"retention"`
+	// PruneInterval is the interval events older than the retention are
+	// deleted.
+	PruneInterval config.Delay `toml:"prune-interval"`
+}
+
+// Backend defines a struct which provides a channel for storing events in a
+// sqlite database.
+type Backend struct {
+	Config
+
+	dataDir string
+
+	m  sync.Mutex
+	db *sql.DB
+
+	queue *pushers.Queue
+
+	counters *pushers.Counters
+}
+
+// New returns a new sqlite channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Path:          defaultPath,
+			BatchSize:     defaultBatchSize,
+			BatchInterval: config.Delay(defaultBatchInterval),
+			Retention:     config.Delay(defaultRetention),
+			PruneInterval: config.Delay(defaultPruneInterval),
+		},
+		counters: &pushers.Counters{},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Path == "" {
+		return nil, fmt.Errorf("path not set")
+	}
+
+	if c.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch-size %d", c.BatchSize)
+	}
+
+	if c.BatchInterval <= 0 {
+		return nil, fmt.Errorf("invalid batch-interval %s", c.BatchInterval.Duration())
+	}
+
+	if c.Retention < 0 {
+		return nil, fmt.Errorf("invalid retention %s", c.Retention.Duration())
+	}
+
+	if c.Retention > 0 && c.PruneInterval <= 0 {
+		return nil, fmt.Errorf("invalid prune-interval %s", c.PruneInterval.Duration())
+	}
+
+	db, err := open(c.path())
+	if err != nil {
+		return nil, err
+	}
+
+	c.db = db
+	c.queue = pushers.NewQueue(c.BatchSize, c.counters)
+
+	go c.run()
+
+	return &c, nil
+}
+
+// SetDataDir sets the directory relative paths are resolved against.
+func (b *Backend) SetDataDir(dataDir string) {
+	b.dataDir = dataDir
+}
+
+func (b *Backend) path() string {
+	if filepath.IsAbs(b.Path) || b.dataDir == "" {
+		return b.Path
+	}
+
+	return filepath.Join(b.dataDir, b.Path)
+}
+
+// open opens the database in write-ahead logging mode, which allows the
+// database to be queried while events are written, and creates the schema.
+func open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", defaultBusyTimeout/time.Millisecond))
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer
+	db.SetMaxOpenConns(1)
+
+	for _, s := range schema {
+		if _, err := db.Exec(s); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating schema: %s", err.Error())
+		}
+	}
+
+	return db, nil
+}
+
+func (b *Backend) run() {
+	defer b.queue.Done()
+
+	batch := []event.Event{}
+
+	write := func() error {
+		err := b.Deliver(batch)
+		if err != nil {
+			log.Errorf("Error writing %d events: %s", len(batch), err.Error())
+		}
+
+		batch = []event.Event{}
+		return err
+	}
+
+	ticker := time.NewTicker(b.BatchInterval.Duration())
+	defer ticker.Stop()
+
+	var pruneC <-chan time.Time
+
+	if b.Retention > 0 {
+		b.prune()
+
+		pruneTicker := time.NewTicker(b.PruneInterval.Duration())
+		defer pruneTicker.Stop()
+
+		pruneC = pruneTicker.C
+	}
+
+	for {
+		select {
+		case e, ok := <-b.queue.Events():
+			if !ok {
+				write()
+				return
+			}
+
+			batch = append(batch, e)
+
+			if len(batch) < b.BatchSize {
+				continue
+			}
+		case errCh := <-b.queue.Flushes():
+			// add all queued events before writing
+		drain:
+			for {
+				select {
+				case e, ok := <-b.queue.Events():
+					if !ok {
+						break drain
+					}
+
+					batch = append(batch, e)
+				default:
+					break drain
+				}
+			}
+
+			errCh <- write()
+			continue
+		case <-pruneC:
+			b.prune()
+			continue
+		case <-ticker.C:
+		}
+
+		write()
+	}
+}
+
+// prune deletes the events older than the retention.
+func (b *Backend) prune() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	n, err := prune(b.db, time.Now().Add(-b.Retention.Duration()))
+	if err != nil {
+		log.Errorf("Error pruning events: %s", err.Error())
+		return
+	}
+
+	if n > 0 {
+		log.Debugf("Pruned %d events older than %s", n, b.Retention.Duration())
+	}
+}
+
+// Deliver writes the events synchronously in a single transaction, it returns
+// an error when the transaction couldn't be committed.
+func (b *Backend) Deliver(events []event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if err := b.insert(events); err != nil {
+		b.counters.AddErrors(len(events))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Backend) insert(events []event.Event) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, e := range events {
+		if err := newRow(e).insert(tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Flush writes all queued events.
+func (b *Backend) Flush() error {
+	return b.queue.Flush()
+}
+
+// Stats returns the number of queued events and the write errors.
+func (b *Backend) Stats() pushers.Stats {
+	return b.counters.Stats(b.queue.Len())
+}
+
+// Close writes all queued events and closes the database, events sent after
+// Close are dropped. Calling Close again has no effect.
+func (b *Backend) Close() error {
+	if !b.queue.Close() {
+		return nil
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.db.Close()
+}
+
+// Send queues the event to be written to the database.
+func (b *Backend) Send(e event.Event) {
+	b.queue.Send(e)
+}
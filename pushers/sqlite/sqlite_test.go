@@ -0,0 +1,299 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package sqlite
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func newChannel(t *testing.T, dir string, config string) *Backend {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(pushers.WithConfig(s.P), pushers.WithDataDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func session(date time.Time) []event.Event {
+	source := event.SourceIP(net.ParseIP("192.0.2.1"))
+
+	opened := event.New(
+		event.Custom("date", date),
+		event.ConnectionSensor,
+		event.Category("connection"),
+		event.ConnectionOpened,
+		event.SessionID("bbq4f2s8di12dfe9n1r0"),
+		event.Service("ssh"),
+		source,
+	)
+
+	return []event.Event{
+		opened,
+		event.New(
+			event.Custom("date", date.Add(time.Second)),
+			event.Sensor("services"),
+			event.Category("ssh"),
+			event.Type("password-authentication"),
+			event.SessionID("bbq4f2s8di12dfe9n1r0"),
+			event.ChildOf(opened),
+			source,
+			event.Custom("ssh.username", "root"),
+			event.Custom("ssh.password", "toor"),
+		),
+		event.New(
+			event.Custom("date", date.Add(2*time.Second)),
+			event.Sensor("services"),
+			event.Category("ssh"),
+			event.Type("ssh-channel"),
+			event.SessionID("bbq4f2s8di12dfe9n1r0"),
+			event.ChildOf(opened),
+			source,
+			event.Custom("ssh.command", "uname -a"),
+		),
+		event.New(
+			event.Custom("date", date.Add(3*time.Second)),
+			event.ConnectionSensor,
+			event.Category("connection"),
+			event.ConnectionClosed,
+			event.SessionID("bbq4f2s8di12dfe9n1r0"),
+			event.ChildOf(opened),
+			source,
+			event.Custom("bytes-in", uint64(120)),
+			event.Custom("bytes-out", uint64(80)),
+			event.Custom("duration", 3.0),
+			event.Custom("close-reason", "eof"),
+		),
+	}
+}
+
+func count(t *testing.T, db *sql.DB, table string) int {
+	n := 0
+	if err := db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := newChannel(t, dir, `path="db/events.db"`)
+	defer c.Close()
+
+	for _, e := range session(time.Now()) {
+		c.Send(e)
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(dir, "db", "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	mode := ""
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	} else if mode != "wal" {
+		t.Errorf("Expected journal mode wal, got %s", mode)
+	}
+
+	for table, expected := range map[string]int{
+		"events":      4,
+		"connections": 1,
+		"credentials": 1,
+		"commands":    1,
+	} {
+		if n := count(t, db, table); n != expected {
+			t.Errorf("Expected %d rows in %s, got %d", expected, table, n)
+		}
+	}
+
+	var (
+		service, closeReason string
+		bytesIn, bytesOut    int
+	)
+
+	if err := db.QueryRow(
+		"SELECT service, bytes_in, bytes_out, close_reason FROM connections WHERE session_id = ? AND opened < closed",
+		"bbq4f2s8di12dfe9n1r0",
+	).Scan(&service, &bytesIn, &bytesOut, &closeReason); err != nil {
+		t.Fatal(err)
+	}
+
+	if service != "ssh" || bytesIn != 120 || bytesOut != 80 || closeReason != "eof" {
+		t.Errorf("Unexpected connection %s %d %d %s", service, bytesIn, bytesOut, closeReason)
+	}
+
+	var username, password, command string
+
+	if err := db.QueryRow("SELECT username, password FROM credentials WHERE source_ip = ?", "192.0.2.1").Scan(&username, &password); err != nil {
+		t.Fatal(err)
+	} else if username != "root" || password != "toor" {
+		t.Errorf("Unexpected credentials %s:%s", username, password)
+	}
+
+	if err := db.QueryRow("SELECT command FROM commands WHERE session_id = ?", "bbq4f2s8di12dfe9n1r0").Scan(&command); err != nil {
+		t.Fatal(err)
+	} else if command != "uname -a" {
+		t.Errorf("Unexpected command %s", command)
+	}
+
+	children := 0
+	if err := db.QueryRow(
+		"SELECT count(*) FROM events e JOIN events p ON e.parent_id = p.id WHERE json_extract(p.data, '$.type') = ?",
+		"CONNECTION:OPENED",
+	).Scan(&children); err != nil {
+		t.Fatal(err)
+	} else if children != 3 {
+		t.Errorf("Expected 3 children of the opened event, got %d", children)
+	}
+}
+
+func TestDeliverTwice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := newChannel(t, dir, `retention="0s"`)
+	defer c.Close()
+
+	events := session(time.Now())
+
+	for i := 0; i < 2; i++ {
+		if err := c.Deliver(events); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, table := range []string{"credentials", "commands"} {
+		if n := count(t, c.db, table); n != 1 {
+			t.Errorf("Expected 1 row in %s, got %d", table, n)
+		}
+	}
+
+	// the deferred Close closes the channel again
+	if err := pushers.Shutdown(c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := newChannel(t, dir, `retention="720h"`)
+	defer c.Close()
+
+	if err := c.Deliver(session(time.Now().Add(-31 * 24 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	recent := session(time.Now().Add(-time.Hour))
+	for _, e := range recent {
+		e.Store("session-id", "bbq4f2s8di12dfe9n1s0")
+	}
+
+	if err := c.Deliver(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	c.prune()
+
+	for table, expected := range map[string]int{
+		"events":      4,
+		"connections": 1,
+		"credentials": 1,
+		"commands":    1,
+	} {
+		if n := count(t, c.db, table); n != expected {
+			t.Errorf("Expected %d rows in %s after pruning, got %d", expected, table, n)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for config, expected := range map[string]string{
+		`path=""`:             "path not set",
+		`batch-size=0`:        "invalid batch-size 0",
+		`batch-interval="0s"`: "invalid batch-interval 0s",
+		`prune-interval="0s"`: "invalid prune-interval 0s",
+		`retention="-1h"`:     "invalid retention -1h0m0s",
+	} {
+		s := struct {
+			P toml.Primitive
+		}{}
+
+		if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := New(pushers.WithConfig(s.P)); err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q for %s, got %v", expected, config, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package syslog contains the event channel for sending events to syslog
+// collectors.
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	// ErrAddressNotSet will be returned if no address has been set in configuration
+	ErrAddressNotSet = errors.New("Syslog address has not been set")
+)
+
+// Transports of the syslog channel.
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+)
+
+// Formats of the syslog messages.
+const (
+	FormatRFC3164 = "rfc3164"
+	FormatRFC5424 = "rfc5424"
+)
+
+// Payloads contained by the syslog messages.
+const (
+	PayloadJSON = "json"
+	PayloadCEF  = "cef"
+	PayloadLEEF = "leef"
+)
+
+// Framing of messages sent over tcp, as described in RFC 6587.
+const (
+	FramingOctetCounting  = "octet-counting"
+	FramingNonTransparent = "non-transparent"
+)
+
+var facilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Config defines a struct which holds configuration values for the syslog
+// channel.
+type Config struct {
+	// Network is the transport, either udp, tcp or tls
+	Network string `toml:"network"`
+
+	// Address of the syslog collector, eg. 127.0.0.1:514
+	Address string `toml:"address"`
+
+	// Format is the syslog format, either rfc5424 or rfc3164
+	Format string `toml:"format"`
+
+	// Payload is the format of the message, either json, cef or leef
+	Payload string `toml:"payload"`
+
+	// Framing of messages sent over tcp, either octet-counting or
+	// non-transparent (newline terminated)
+	Framing string `toml:"framing"`
+
+	Facility string `toml:"facility"`
+	AppName  string `toml:"app-name"`
+	Hostname string `toml:"hostname"`
+
+	// Insecure configures if the certificate of the collector should not be
+	// verified
+	Insecure bool `toml:"insecure"`
+
+	// CA is the file containing the certificates used to verify the
+	// collector
+	CA string `toml:"ca"`
+}
+
+// DefaultConfig returns the defaults of the syslog channel.
+func DefaultConfig() Config {
+	hostname, _ := os.Hostname()
+
+	return Config{
+		Network:  NetworkUDP,
+		Format:   FormatRFC5424,
+		Payload:  PayloadJSON,
+		Framing:  FramingOctetCounting,
+		Facility: "local0",
+		AppName:  "honeytrap",
+		Hostname: hostname,
+	}
+}
+
+// validate checks the configuration.
+func (c Config) validate() error {
+	if c.Address == "" {
+		return ErrAddressNotSet
+	}
+
+	switch c.Network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return fmt.Errorf("unknown network %s, expected %s, %s or %s", c.Network, NetworkUDP, NetworkTCP, NetworkTLS)
+	}
+
+	switch c.Format {
+	case FormatRFC3164, FormatRFC5424:
+	default:
+		return fmt.Errorf("unknown format %s, expected %s or %s", c.Format, FormatRFC3164, FormatRFC5424)
+	}
+
+	switch c.Payload {
+	case PayloadJSON, PayloadCEF, PayloadLEEF:
+	default:
+		return fmt.Errorf("unknown payload %s, expected %s, %s or %s", c.Payload, PayloadJSON, PayloadCEF, PayloadLEEF)
+	}
+
+	switch c.Framing {
+	case FramingOctetCounting, FramingNonTransparent:
+	default:
+		return fmt.Errorf("unknown framing %s, expected %s or %s", c.Framing, FramingOctetCounting, FramingNonTransparent)
+	}
+
+	if _, ok := facilities[c.Facility]; !ok {
+		return fmt.Errorf("unknown facility %s", c.Facility)
+	}
+
+	return nil
+}
+
+// tlsConfig returns the tls configuration for connecting to the collector.
+func (c Config) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+	}
+
+	if c.CA == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(c.CA)
+	if err != nil {
+		return nil, err
+	}
+
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", c.CA)
+	}
+
+	return config, nil
+}
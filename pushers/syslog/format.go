@@ -0,0 +1,155 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Syslog severities.
+const (
+	severityCritical = 2
+	severityError    = 3
+	severityWarning  = 4
+	severityNotice   = 5
+	severityInfo     = 6
+)
+
+// severity returns the syslog severity of the event, based on the severity
+// of alerts and the type of errors.
+func severity(e event.Event) int {
+	switch e.Get("severity") {
+	case "critical":
+		return severityCritical
+	case "high":
+		return severityError
+	case "medium":
+		return severityWarning
+	case "low":
+		return severityNotice
+	}
+
+	switch e.Get("type") {
+	case "fatal":
+		return severityCritical
+	case "error":
+		return severityError
+	}
+
+	return severityInfo
+}
+
+// date returns the date of the event, or the current time if the event
+// doesn't contain a date.
+func date(e event.Event) time.Time {
+	if v, ok := e.Value("date"); !ok {
+	} else if t, ok := v.(time.Time); ok {
+		return t
+	}
+
+	return time.Now()
+}
+
+// header formats the syslog header of messages.
+type header struct {
+	format   string
+	facility int
+	hostname string
+	appName  string
+	pid      int
+}
+
+func newHeader(c Config) header {
+	return header{
+		format:   c.Format,
+		facility: facilities[c.Facility],
+		hostname: c.Hostname,
+		appName:  c.AppName,
+		pid:      os.Getpid(),
+	}
+}
+
+// message returns the syslog message containing the payload.
+func (h header) message(e event.Event, payload []byte) []byte {
+	buf := bytes.Buffer{}
+
+	priority := h.facility*8 + severity(e)
+
+	if h.format == FormatRFC3164 {
+		fmt.Fprintf(&buf, "<%d>%s %s %s[%d]: ",
+			priority,
+			date(e).Format(time.Stamp),
+			field(h.hostname, 255),
+			field(h.appName, 32),
+			h.pid,
+		)
+	} else {
+		fmt.Fprintf(&buf, "<%d>1 %s %s %s %d %s - ",
+			priority,
+			date(e).UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+			field(h.hostname, 255),
+			field(h.appName, 48),
+			h.pid,
+			field(e.Get("category"), 32),
+		)
+	}
+
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// field returns the value as header field, which consists of printable
+// characters without spaces. Empty values are replaced by the nil value.
+func field(s string, size int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+
+		return r
+	}, s)
+
+	if s == "" {
+		return "-"
+	}
+
+	if len(s) > size {
+		s = s[:size]
+	}
+
+	return s
+}
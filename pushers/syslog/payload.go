@@ -0,0 +1,310 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/cmd"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+const (
+	vendor  = "DutchSec"
+	product = "Honeytrap"
+)
+
+// extension maps a honeytrap field to an extension key of CEF or LEEF. Fields
+// starting with a dot match the fields of all services, eg. .username matches
+// ssh.username.
+type extension struct {
+	field string
+	key   string
+}
+
+var cefExtensions = []extension{
+	{"id", "externalId"},
+	{"category", "cat"},
+	{"message", "msg"},
+	{"source-ip", "src"},
+	{"source-port", "spt"},
+	{"source-mac", "smac"},
+	{"destination-ip", "dst"},
+	{"destination-port", "dpt"},
+	{"destination-mac", "dmac"},
+	{"service", "destinationServiceName"},
+	{"sensor-name", "dvchost"},
+	{"bytes-in", "in"},
+	{"bytes-out", "out"},
+	{"http.method", "requestMethod"},
+	{"http.url", "request"},
+	{"url", "request"},
+	{"http.user-agent", "requestClientApplication"},
+	{"user-agent", "requestClientApplication"},
+	{".username", "suser"},
+	{".command", "cs1"},
+	{"session-id", "cs2"},
+	{".password", "cs3"},
+}
+
+// cefLabels contains the labels of the custom string extensions.
+var cefLabels = map[string]string{
+	"cs1": "command",
+	"cs2": "sessionId",
+	"cs3": "password",
+}
+
+var leefExtensions = []extension{
+	{"id", "eventId"},
+	{"category", "cat"},
+	{"message", "msg"},
+	{"source-ip", "src"},
+	{"source-port", "srcPort"},
+	{"source-mac", "srcMAC"},
+	{"destination-ip", "dst"},
+	{"destination-port", "dstPort"},
+	{"destination-mac", "dstMAC"},
+	{"service", "service"},
+	{"sensor-name", "sensor"},
+	{"bytes-in", "srcBytes"},
+	{"bytes-out", "dstBytes"},
+	{"http.method", "method"},
+	{"http.url", "url"},
+	{"url", "url"},
+	{"http.user-agent", "userAgent"},
+	{"user-agent", "userAgent"},
+	{".username", "usrName"},
+	{".command", "command"},
+	{"session-id", "sessionId"},
+	{".password", "password"},
+}
+
+// payloadFunc returns the payload of the syslog message for the event.
+type payloadFunc func(event.Event) ([]byte, error)
+
+func payloadFor(payload string) payloadFunc {
+	switch payload {
+	case PayloadCEF:
+		return cef
+	case PayloadLEEF:
+		return leef
+	default:
+		return jsonPayload
+	}
+}
+
+func jsonPayload(e event.Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// cef formats the event using the ArcSight Common Event Format.
+func cef(e event.Event) ([]byte, error) {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader(vendor),
+		cefHeader(product),
+		cefHeader(cmd.Version),
+		cefHeader(signature(e)),
+		cefHeader(name(e)),
+		eventSeverity(e),
+	)
+
+	values := extensions(e, cefExtensions)
+
+	values = append(values, [2]string{"rt", strconv.FormatInt(date(e).UnixNano()/1e6, 10)})
+
+	if proto := transport(e); proto != "" {
+		values = append(values, [2]string{"proto", proto})
+	}
+
+	for i, kv := range values {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		fmt.Fprintf(&buf, "%s=%s", kv[0], cefValue(kv[1]))
+
+		if label, ok := cefLabels[kv[0]]; ok {
+			fmt.Fprintf(&buf, " %sLabel=%s", kv[0], label)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// leef formats the event using the IBM QRadar Log Event Extended Format,
+// the attributes are delimited by tabs.
+func leef(e event.Event) ([]byte, error) {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "LEEF:2.0|%s|%s|%s|%s|x09|",
+		leefHeader(vendor),
+		leefHeader(product),
+		leefHeader(cmd.Version),
+		leefHeader(signature(e)),
+	)
+
+	values := extensions(e, leefExtensions)
+
+	values = append(values,
+		[2]string{"sev", strconv.Itoa(eventSeverity(e))},
+		[2]string{"devTime", strconv.FormatInt(date(e).UnixNano()/1e6, 10)},
+	)
+
+	if proto := transport(e); proto != "" {
+		values = append(values, [2]string{"proto", proto})
+	}
+
+	for i, kv := range values {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+
+		fmt.Fprintf(&buf, "%s=%s", kv[0], leefValue(kv[1]))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// extensions returns the key and value of the extensions the event contains,
+// in the order of the extensions. Every key is included once.
+func extensions(e event.Event, extensions []extension) [][2]string {
+	keys := []string{}
+
+	e.Range(func(k, v interface{}) bool {
+		if key, ok := k.(string); ok {
+			keys = append(keys, key)
+		}
+
+		return true
+	})
+
+	sort.Strings(keys)
+
+	values := [][2]string{}
+	seen := map[string]bool{}
+
+	for _, ext := range extensions {
+		if seen[ext.key] {
+			continue
+		}
+
+		for _, key := range keys {
+			if key != ext.field && !(strings.HasPrefix(ext.field, ".") && strings.HasSuffix(key, ext.field)) {
+				continue
+			}
+
+			v, _ := e.Value(key)
+
+			s := ""
+			if err, ok := v.(error); ok {
+				s = err.Error()
+			} else {
+				s = fmt.Sprint(v)
+			}
+
+			values = append(values, [2]string{ext.key, s})
+			seen[ext.key] = true
+			break
+		}
+	}
+
+	return values
+}
+
+// signature returns the id of the kind of event, eg. ssh:password-authentication.
+func signature(e event.Event) string {
+	return e.Get("category") + ":" + e.Get("type")
+}
+
+// name returns a description of the event.
+func name(e event.Event) string {
+	return strings.TrimSpace(e.Get("category") + " " + e.Get("type"))
+}
+
+// eventSeverity returns the severity of the event from 0 to 10, as used by CEF
+// and LEEF.
+func eventSeverity(e event.Event) int {
+	switch severity(e) {
+	case severityCritical:
+		return 10
+	case severityError:
+		return 8
+	case severityWarning:
+		return 5
+	case severityNotice:
+		return 3
+	}
+
+	return 1
+}
+
+// transport returns the transport protocol of the binding the event was
+// received on, eg. TCP.
+func transport(e event.Event) string {
+	binding := e.Get("binding")
+
+	if i := strings.Index(binding, "/"); i > 0 {
+		return strings.ToUpper(binding[:i])
+	}
+
+	return ""
+}
+
+var (
+	cefHeaderReplacer = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueReplacer  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+	leefHeaderReplacer = strings.NewReplacer(`|`, `\|`, "\n", " ", "\r", " ")
+	leefValueReplacer  = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
+
+func cefHeader(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+func cefValue(s string) string {
+	return cefValueReplacer.Replace(s)
+}
+
+func leefHeader(s string) string {
+	return leefHeaderReplacer.Replace(s)
+}
+
+func leefValue(s string) string {
+	return leefValueReplacer.Replace(s)
+}
@@ -0,0 +1,223 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"sync"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = pushers.Register("syslog", New)
+)
+
+var log = logging.MustGetLogger("channels/syslog")
+
+// maxBatch is the maximum number of queued events written at once.
+const maxBatch = 100
+
+// Backend defines a struct which provides a channel for delivery of events
+// to a syslog collector.
+type Backend struct {
+	Config
+
+	header  header
+	payload payloadFunc
+
+	m      sync.Mutex
+	writer *writer
+
+	queue *pushers.Queue
+
+	counters *pushers.Counters
+}
+
+// New returns a new syslog channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	counters := &pushers.Counters{}
+
+	c := Backend{
+		Config:   DefaultConfig(),
+		queue:    pushers.NewQueue(100, counters),
+		counters: counters,
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c.header = newHeader(c.Config)
+	c.payload = payloadFor(c.Payload)
+
+	c.writer = &writer{
+		network:   c.Network,
+		address:   c.Address,
+		framing:   c.Framing,
+		tlsConfig: tlsConfig,
+	}
+
+	go c.run()
+
+	return &c, nil
+}
+
+func (b *Backend) run() {
+	defer b.queue.Done()
+
+	for {
+		select {
+		case e, ok := <-b.queue.Events():
+			if !ok {
+				return
+			}
+
+			batch := []event.Event{e}
+
+		drain:
+			for len(batch) < maxBatch {
+				select {
+				case e, ok := <-b.queue.Events():
+					if !ok {
+						break drain
+					}
+
+					batch = append(batch, e)
+				default:
+					break drain
+				}
+			}
+
+			if err := b.Deliver(batch); err != nil {
+				log.Errorf("Error sending events: %s", err.Error())
+			}
+		case errCh := <-b.queue.Flushes():
+			// write all queued events before responding
+			batch := []event.Event{}
+
+		flush:
+			for {
+				select {
+				case e, ok := <-b.queue.Events():
+					if !ok {
+						break flush
+					}
+
+					batch = append(batch, e)
+				default:
+					break flush
+				}
+			}
+
+			errCh <- b.Deliver(batch)
+		}
+	}
+}
+
+// messages returns the syslog messages of the events, events that can't be
+// formatted are counted as errors.
+func (b *Backend) messages(events []event.Event) [][]byte {
+	messages := [][]byte{}
+
+	for _, e := range events {
+		payload, err := b.payload(e)
+		if err != nil {
+			log.Errorf("Error formatting event: %s", err.Error())
+			b.counters.AddErrors(1)
+			continue
+		}
+
+		messages = append(messages, b.header.message(e, payload))
+	}
+
+	return messages
+}
+
+// Deliver sends the events synchronously, it returns an error when the events
+// couldn't be written to the collector.
+func (b *Backend) Deliver(events []event.Event) error {
+	messages := b.messages(events)
+	if len(messages) == 0 {
+		return nil
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if err := b.writer.write(messages); err != nil {
+		b.counters.AddErrors(len(messages))
+		return err
+	}
+
+	return nil
+}
+
+// Flush sends all queued events.
+func (b *Backend) Flush() error {
+	return b.queue.Flush()
+}
+
+// Stats returns the number of queued events and the delivery errors.
+func (b *Backend) Stats() pushers.Stats {
+	return b.counters.Stats(b.queue.Len())
+}
+
+// Close sends all queued events and closes the connection to the collector,
+// events sent after Close are dropped. Calling Close again has no effect.
+func (b *Backend) Close() error {
+	if !b.queue.Close() {
+		return nil
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.writer.close()
+}
+
+// Send queues the event for delivery to the collector.
+func (b *Backend) Send(e event.Event) {
+	b.queue.Send(e)
+}
@@ -0,0 +1,356 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/cmd"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func newChannel(t *testing.T, config string) *Backend {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(pushers.WithConfig(s.P))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func testEvent() event.Event {
+	return event.New(
+		event.Custom("id", "bbq4f2s8di12dfe9n1r0"),
+		event.Custom("date", time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)),
+		event.Sensor("services"),
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.SourceIP(net.ParseIP("192.0.2.1")),
+		event.SourcePort(51234),
+		event.DestinationIP(net.ParseIP("198.51.100.1")),
+		event.DestinationPort(22),
+		event.Custom("binding", "tcp/22"),
+		event.Custom("ssh.username", "root"),
+		event.Custom("ssh.password", "pass=word|x"),
+	)
+}
+
+// readFrame reads an octet counted syslog message.
+func readFrame(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err := r.Read(buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c := newChannel(t, fmt.Sprintf(`network="tcp"
+address="%s"
+hostname="sensor"
+`, l.Addr()))
+
+	c.Send(testEvent())
+	c.Send(testEvent())
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	for i := 0; i < 2; i++ {
+		message, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// local0.info
+		prefix := "<134>1 2018-01-02T03:04:05.000000Z sensor honeytrap "
+		if !strings.HasPrefix(message, prefix) {
+			t.Fatalf("Expected message to start with %q, got %q", prefix, message)
+		}
+
+		parts := strings.SplitN(message, " ", 8)
+		if parts[5] != "ssh" || parts[6] != "-" {
+			t.Errorf("Expected msgid ssh without structured data, got %q", message)
+		}
+
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(parts[7]), &doc); err != nil {
+			t.Fatal(err)
+		}
+
+		if doc["id"] != "bbq4f2s8di12dfe9n1r0" || doc["ssh.username"] != "root" {
+			t.Errorf("Unexpected payload %v", doc)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := pushers.Shutdown(c); err != nil {
+		t.Errorf("Expected flushing and closing again to succeed, got %s", err)
+	}
+
+	c.Send(event.New())
+
+	if stats := c.Stats(); stats.Dropped != 1 {
+		t.Errorf("Expected the event sent after close to be dropped, got %d dropped", stats.Dropped)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := newChannel(t, fmt.Sprintf(`network="udp"
+address="%s"
+format="rfc3164"
+facility="auth"
+app-name="honeypot"
+hostname="sensor"
+payload="cef"
+`, conn.LocalAddr()))
+	defer c.Close()
+
+	c.Send(event.New(
+		event.Custom("date", time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)),
+		event.Category("alert"),
+		event.Severity("high"),
+	))
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// auth.err
+	prefix := "<35>Jan  2 03:04:05 sensor honeypot["
+	if message := string(buf[:n]); !strings.HasPrefix(message, prefix) {
+		t.Errorf("Expected message to start with %q, got %q", prefix, message)
+	} else if !strings.Contains(message, "]: CEF:0|DutchSec|Honeytrap|") {
+		t.Errorf("Expected CEF payload, got %q", message)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{certificate(t)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c := newChannel(t, fmt.Sprintf(`network="tls"
+address="%s"
+framing="non-transparent"
+insecure=true
+`, l.Addr()))
+	defer c.Close()
+
+	received := make(chan string)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	c.Send(testEvent())
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-received:
+		if !strings.HasPrefix(line, "<134>1 ") || !strings.HasSuffix(line, "}\n") {
+			t.Errorf("Expected a newline terminated message, got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+}
+
+func TestCEF(t *testing.T) {
+	data, err := cef(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "CEF:0|DutchSec|Honeytrap|" + cmd.Version + "|ssh:password-authentication|ssh password-authentication|1|" +
+		`externalId=bbq4f2s8di12dfe9n1r0 cat=ssh src=192.0.2.1 spt=51234 dst=198.51.100.1 dpt=22 suser=root ` +
+		`cs3=pass\=word|x cs3Label=password rt=1514862245000 proto=TCP`
+
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(data))
+	}
+}
+
+func TestLEEF(t *testing.T) {
+	data, err := leef(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "LEEF:2.0|DutchSec|Honeytrap|" + cmd.Version + "|ssh:password-authentication|x09|" +
+		strings.Join([]string{
+			"eventId=bbq4f2s8di12dfe9n1r0",
+			"cat=ssh",
+			"src=192.0.2.1",
+			"srcPort=51234",
+			"dst=198.51.100.1",
+			"dstPort=22",
+			"usrName=root",
+			"password=pass=word|x",
+			"sev=1",
+			"devTime=1514862245000",
+			"proto=TCP",
+		}, "\t")
+
+	if string(data) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(data))
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for config, expected := range map[string]string{
+		`network="udp"`: ErrAddressNotSet.Error(),
+		`address="localhost:514"` + "\nnetwork=\"sctp\"":  "unknown network sctp, expected udp, tcp or tls",
+		`address="localhost:514"` + "\nformat=\"rfc1\"":   "unknown format rfc1, expected rfc3164 or rfc5424",
+		`address="localhost:514"` + "\npayload=\"xml\"":   "unknown payload xml, expected json, cef or leef",
+		`address="localhost:514"` + "\nfacility=\"mars\"": "unknown facility mars",
+	} {
+		s := struct {
+			P toml.Primitive
+		}{}
+
+		if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := New(pushers.WithConfig(s.P)); err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q for %s, got %v", expected, config, err)
+		}
+	}
+}
+
+// certificate returns a self signed certificate for the tls collector.
+func certificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
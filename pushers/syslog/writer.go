@@ -0,0 +1,130 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+// writer writes messages to the collector, it (re)connects when needed.
+type writer struct {
+	network string
+	address string
+	framing string
+
+	tlsConfig *tls.Config
+
+	conn net.Conn
+}
+
+func (w *writer) connect() error {
+	if w.conn != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var err error
+
+	switch w.network {
+	case NetworkTLS:
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.address, w.tlsConfig)
+	default:
+		w.conn, err = dialer.Dial(w.network, w.address)
+	}
+
+	return err
+}
+
+// write sends the messages, the connection is closed when writing fails and
+// will be reconnected on the next write.
+func (w *writer) write(messages [][]byte) error {
+	if err := w.connect(); err != nil {
+		return err
+	}
+
+	w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if err := w.send(messages); err != nil {
+		w.close()
+		return err
+	}
+
+	return nil
+}
+
+func (w *writer) send(messages [][]byte) error {
+	// every message is sent as a single datagram
+	if w.network == NetworkUDP {
+		for _, message := range messages {
+			if _, err := w.conn.Write(message); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	bw := bufio.NewWriter(w.conn)
+
+	for _, message := range messages {
+		if w.framing == FramingNonTransparent {
+			bw.Write(message)
+			bw.WriteByte('\n')
+			continue
+		}
+
+		bw.WriteString(strconv.Itoa(len(message)))
+		bw.WriteByte(' ')
+		bw.Write(message)
+	}
+
+	return bw.Flush()
+}
+
+func (w *writer) close() error {
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
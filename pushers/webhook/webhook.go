@@ -0,0 +1,407 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package webhook contains the event channel for posting events to http
+// endpoints.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = pushers.Register("webhook", New)
+)
+
+var log = logging.MustGetLogger("channels/webhook")
+
+var (
+	// ErrURLNotSet will be returned if no url has been set in configuration
+	ErrURLNotSet = errors.New("Webhook url has not been set")
+)
+
+var (
+	defaultBatchSize     = 100
+	defaultBatchInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+	defaultMaxRetries    = 5
+	defaultBackoff       = time.Second
+	defaultMaxBackoff    = time.Minute
+
+	// queueSize is the number of events queued while posting
+	queueSize = 1000
+)
+
+// Config defines a struct which holds configuration values for the webhook
+// channel.
+type Config struct {
+	URL    string `toml:"url"`
+	Method string `toml:"method"`
+
+	// Template is executed with the fields of every event as request body,
+	// without template the events are posted as JSON array.
+	Template    string            `toml:"template"`
+	ContentType string            `toml:"content-type"`
+	Headers     map[string]string `toml:"headers"`
+
+	// BatchSize is the maximum number of events posted at once, the queued
+	// events are posted at least every batch interval.
+	BatchSize     int          `toml:"batch-size"`
+	BatchInterval config.Delay `toml:"batch-interval"`
+
+	Timeout config.Delay `toml:"timeout"`
+
+	// Requests that time out or fail with a server error are retried, with
+	// an exponential backoff starting at backoff.
+	MaxRetries int          `toml:"max-retries"`
+	Backoff    config.Delay `toml:"backoff"`
+	MaxBackoff config.Delay `toml:"max-backoff"`
+
+	// Secret is the key of the HMAC-SHA256 signature of the body, which is
+	// sent as signature header.
+	Secret          string `toml:"secret"`
+	SignatureHeader string `toml:"signature-header"`
+
+	// Insecure configures if the client should not verify tls configuration
+	Insecure bool `toml:"insecure"`
+}
+
+// Backend defines a struct which provides a channel for posting events to a
+// http endpoint.
+type Backend struct {
+	Config
+
+	client   *http.Client
+	template *template.Template
+
+	queue *pushers.Queue
+
+	counters *pushers.Counters
+}
+
+// New returns a new webhook channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Method:          http.MethodPost,
+			ContentType:     "application/json",
+			BatchSize:       defaultBatchSize,
+			BatchInterval:   config.Delay(defaultBatchInterval),
+			Timeout:         config.Delay(defaultTimeout),
+			MaxRetries:      defaultMaxRetries,
+			Backoff:         config.Delay(defaultBackoff),
+			MaxBackoff:      config.Delay(defaultMaxBackoff),
+			SignatureHeader: "X-Honeytrap-Signature",
+		},
+		counters: &pushers.Counters{},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.URL == "" {
+		return nil, ErrURLNotSet
+	}
+
+	if c.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch-size %d", c.BatchSize)
+	}
+
+	if c.BatchInterval <= 0 {
+		return nil, fmt.Errorf("invalid batch-interval %s", c.BatchInterval.Duration())
+	}
+
+	if c.Template != "" {
+		t, err := template.New("webhook").Funcs(funcs).Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template: %s", err.Error())
+		}
+
+		c.template = t
+	}
+
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: c.Insecure,
+			},
+		},
+		Timeout: c.Timeout.Duration(),
+	}
+
+	c.queue = pushers.NewQueue(queueSize, c.counters)
+
+	go c.run()
+
+	return &c, nil
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func (b *Backend) run() {
+	defer b.queue.Done()
+
+	batch := []event.Event{}
+
+	post := func() error {
+		err := b.Deliver(batch)
+		if err != nil {
+			log.Errorf("Error posting %d events: %s", len(batch), err.Error())
+		}
+
+		batch = []event.Event{}
+		return err
+	}
+
+	ticker := time.NewTicker(b.BatchInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-b.queue.Events():
+			if !ok {
+				post()
+				return
+			}
+
+			batch = append(batch, e)
+
+			if len(batch) < b.BatchSize {
+				continue
+			}
+		case errCh := <-b.queue.Flushes():
+			// add all queued events before posting
+		drain:
+			for {
+				select {
+				case e, ok := <-b.queue.Events():
+					if !ok {
+						break drain
+					}
+
+					batch = append(batch, e)
+				default:
+					break drain
+				}
+			}
+
+			errCh <- post()
+			continue
+		case <-ticker.C:
+		}
+
+		post()
+	}
+}
+
+// retryableError is returned for requests that can be retried.
+type retryableError struct {
+	err error
+}
+
+func (r retryableError) Error() string {
+	return r.err.Error()
+}
+
+// request contains the body of a request and the number of events it
+// contains.
+type request struct {
+	body   []byte
+	events int
+}
+
+// requests returns the requests for the events, a request per event when
+// using a template, otherwise the events as JSON array.
+func (b *Backend) requests(events []event.Event) []request {
+	if b.template == nil {
+		data, err := json.Marshal(events)
+		if err != nil {
+			log.Errorf("Error marshaling events: %s", err.Error())
+			b.counters.AddErrors(len(events))
+			return nil
+		}
+
+		return []request{{data, len(events)}}
+	}
+
+	requests := []request{}
+
+	for _, e := range events {
+		buf := bytes.Buffer{}
+		if err := b.template.Execute(&buf, event.ToMap(e)); err != nil {
+			log.Errorf("Error executing template: %s", err.Error())
+			b.counters.AddErrors(1)
+			continue
+		}
+
+		requests = append(requests, request{buf.Bytes(), 1})
+	}
+
+	return requests
+}
+
+// Deliver posts the events synchronously, requests are retried until the
+// maximum number of retries. It returns the error of the last request that
+// failed.
+func (b *Backend) Deliver(events []event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var lastErr error
+
+	for _, r := range b.requests(events) {
+		if err := b.post(r.body); err != nil {
+			b.counters.AddErrors(r.events)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// post sends the body, requests are retried with an exponential backoff when
+// they time out or fail with a server error.
+func (b *Backend) post(body []byte) error {
+	backoff := b.Backoff.Duration()
+
+	for retry := 0; ; retry++ {
+		err := b.do(body)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(retryableError); !ok || retry >= b.MaxRetries {
+			return err
+		}
+
+		log.Debugf("Error posting to webhook, retrying in %s: %s", backoff, err.Error())
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > b.MaxBackoff.Duration() {
+			backoff = b.MaxBackoff.Duration()
+		}
+	}
+}
+
+func (b *Backend) do(body []byte) error {
+	req, err := http.NewRequest(b.Method, b.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", b.ContentType)
+
+	for k, v := range b.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if b.Secret != "" {
+		req.Header.Set(b.SignatureHeader, "sha256="+Sign([]byte(b.Secret), body))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// timeouts and connection errors
+		return retryableError{err}
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 500 {
+		return retryableError{fmt.Errorf("unexpected status %s", resp.Status)}
+	} else if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of the body, receivers
+// verify the signature header by comparing it to the signature they compute
+// with the shared secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Flush posts all queued events.
+func (b *Backend) Flush() error {
+	return b.queue.Flush()
+}
+
+// Stats returns the number of queued events and the failed requests.
+func (b *Backend) Stats() pushers.Stats {
+	return b.counters.Stats(b.queue.Len())
+}
+
+// Close posts all queued events, events sent after Close are dropped. Calling
+// Close again has no effect.
+func (b *Backend) Close() error {
+	b.queue.Close()
+	return nil
+}
+
+// Send queues the event, the event is dropped when the queue is full, as
+// requests to the endpoint are being retried.
+func (b *Backend) Send(e event.Event) {
+	if !b.queue.TrySend(e) {
+		log.Errorf("Dropping event, webhook queue is full or closed")
+	}
+}
@@ -0,0 +1,302 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// recorder records the requests, and responds with the queued status codes.
+type recorder struct {
+	m        sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	statuses []int
+	delay    time.Duration
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	rec.m.Lock()
+	rec.requests = append(rec.requests, r)
+	rec.bodies = append(rec.bodies, string(body))
+
+	status := http.StatusOK
+	if len(rec.statuses) > 0 {
+		status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+	}
+
+	delay := rec.delay
+	rec.delay = 0
+	rec.m.Unlock()
+
+	time.Sleep(delay)
+	w.WriteHeader(status)
+}
+
+func newChannel(t *testing.T, url string, config string) *Backend {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(fmt.Sprintf("[P]\nurl=%q\n%s", url, config), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(pushers.WithConfig(s.P))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func testEvent(category string) event.Event {
+	return event.New(
+		event.Category(category),
+		event.SourceIP(net.ParseIP("192.0.2.1")),
+	)
+}
+
+func TestBatch(t *testing.T) {
+	rec := &recorder{}
+
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c := newChannel(t, server.URL, `
+batch-size=2
+[P.headers]
+Authorization="Bearer token"
+`)
+
+	for _, category := range []string{"ssh", "telnet", "http"} {
+		c.Send(testEvent(category))
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// flushing and closing again can happen when a reload races with
+	// stopping honeytrap
+	if err := pushers.Shutdown(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(rec.requests))
+	}
+
+	for i, expected := range [][]string{{"ssh", "telnet"}, {"http"}} {
+		events := []map[string]interface{}{}
+		if err := json.Unmarshal([]byte(rec.bodies[i]), &events); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(events) != len(expected) {
+			t.Fatalf("Expected %d events, got %s", len(expected), rec.bodies[i])
+		}
+
+		for j := range expected {
+			if events[j]["category"] != expected[j] || events[j]["source-ip"] != "192.0.2.1" {
+				t.Errorf("Unexpected event %v", events[j])
+			}
+		}
+
+		r := rec.requests[i]
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Unexpected request %s %v", r.Method, r.Header)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	rec := &recorder{}
+
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c := newChannel(t, server.URL, `
+template='{"text": {{ printf "%s from %s" .category (index . "source-ip") | json }}}'
+`)
+	defer c.Close()
+
+	c.Send(testEvent("ssh"))
+	c.Send(testEvent("telnet"))
+
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`{"text": "ssh from 192.0.2.1"}`,
+		`{"text": "telnet from 192.0.2.1"}`,
+	}
+
+	if fmt.Sprint(rec.bodies) != fmt.Sprint(expected) {
+		t.Errorf("Expected bodies %v, got %v", expected, rec.bodies)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	// the first request times out
+	rec := &recorder{
+		statuses: []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusBadGateway},
+		delay:    time.Second,
+	}
+
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c := newChannel(t, server.URL, `
+timeout="100ms"
+backoff="1ms"
+`)
+	defer c.Close()
+
+	if err := c.Deliver([]event.Event{testEvent("ssh")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the request that timed out, two server errors and the successful request
+	if len(rec.requests) != 4 {
+		t.Errorf("Expected 4 requests, got %d", len(rec.requests))
+	}
+
+	if stats := c.Stats(); stats.Errors != 0 {
+		t.Errorf("Expected no errors, got %+v", stats)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	rec := &recorder{
+		statuses: []int{500, 500, 500},
+	}
+
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c := newChannel(t, server.URL, `
+max-retries=2
+backoff="1ms"
+`)
+	defer c.Close()
+
+	if err := c.Deliver([]event.Event{testEvent("ssh"), testEvent("ssh")}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if len(rec.requests) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(rec.requests))
+	}
+
+	if stats := c.Stats(); stats.Errors != 2 {
+		t.Errorf("Expected 2 errors, got %+v", stats)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	rec := &recorder{
+		statuses: []int{http.StatusBadRequest},
+	}
+
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c := newChannel(t, server.URL, `backoff="1ms"`)
+	defer c.Close()
+
+	if err := c.Deliver([]event.Event{testEvent("ssh")}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if len(rec.requests) != 1 {
+		t.Errorf("Expected client errors not to be retried, got %d requests", len(rec.requests))
+	}
+}
+
+func TestSignature(t *testing.T) {
+	rec := &recorder{}
+
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c := newChannel(t, server.URL, `
+secret="s3cr3t"
+signature-header="X-Signature"
+`)
+	defer c.Close()
+
+	if err := c.Deliver([]event.Event{testEvent("ssh")}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "sha256=" + Sign([]byte("s3cr3t"), []byte(rec.bodies[0]))
+	if signature := rec.requests[0].Header.Get("X-Signature"); signature != expected {
+		t.Errorf("Expected signature %s, got %s", expected, signature)
+	}
+
+	if Sign([]byte("key"), []byte("The quick brown fox jumps over the lazy dog")) != "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Errorf("Unexpected HMAC-SHA256 signature")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	if _, err := New(); err != ErrURLNotSet {
+		t.Errorf("Expected %s, got %v", ErrURLNotSet, err)
+	}
+
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode("[P]\nurl=\"http://localhost\"\ntemplate=\"{{.category\"", &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(pushers.WithConfig(s.P)); err == nil {
+		t.Errorf("Expected template error")
+	}
+}
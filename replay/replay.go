@@ -0,0 +1,323 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package replay reads the events written by the file channel, to push these
+// again through a channel. This is used to backfill a channel that has been
+// added after the events have been received:
+//
+//    honeytrap replay --channel splunk --from 2018-01-01 --rate 100 events.json
+//
+// The rotated files of the file channel are replayed as well, oldest first.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap/replay")
+
+// rotatedLayout is the layout of the timestamp the file channel appends to
+// rotated files.
+const rotatedLayout = "20060102150405"
+
+// Files returns the rotated files of the file channel for path, ordered from
+// oldest to newest, followed by path itself if it exists.
+func Files(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + "-*")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	for _, match := range matches {
+		suffix := match[len(path)+1:]
+		if _, err := time.Parse(rotatedLayout, suffix); err != nil {
+			continue
+		}
+
+		files = append(files, match)
+	}
+
+	// the timestamps sort chronologically
+	sort.Strings(files)
+
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else if len(files) == 0 {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// LineError is returned for lines that don't contain a valid event.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (le *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", le.Line, le.Err.Error())
+}
+
+// Reader reads events from json lines.
+type Reader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewReader returns a reader of the events in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Next returns the next event, or io.EOF after the last event. Lines that
+// aren't valid json return a LineError, Next can be called again to continue
+// with the next line.
+func (r *Reader) Next() (event.Event, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return event.Event{}, io.EOF
+		} else if err != nil && err != io.EOF {
+			return event.Event{}, err
+		}
+
+		r.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		e, err := parse(line)
+		if err != nil {
+			return event.Event{}, &LineError{r.line, err}
+		}
+
+		return e, nil
+	}
+}
+
+// parse returns the event of a json line, restoring the date and integer
+// values.
+func parse(line []byte) (event.Event, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	m := map[string]interface{}{}
+	if err := dec.Decode(&m); err != nil {
+		return event.Event{}, err
+	}
+
+	// the fields are restored as is, without a new id and date
+	e := event.New()
+	e.Delete("id")
+	e.Delete("date")
+
+	for k, v := range m {
+		switch x := v.(type) {
+		case json.Number:
+			if i, err := x.Int64(); err == nil {
+				v = int(i)
+			} else if f, err := x.Float64(); err == nil {
+				v = f
+			}
+		case string:
+			if k != "date" {
+			} else if t, err := time.Parse(time.RFC3339Nano, x); err == nil {
+				v = t
+			}
+		}
+
+		e.Store(k, v)
+	}
+
+	return e, nil
+}
+
+// Options selects the events that will be replayed.
+type Options struct {
+	// From and To select the events by date, zero values are unbounded.
+	// Events without a date are skipped when a range has been set.
+	From time.Time
+	To   time.Time
+
+	// Filter selects the events, all events are replayed if nil.
+	Filter func(event.Event) bool
+
+	// Rate is the maximum number of events sent per second, zero means
+	// unlimited.
+	Rate float64
+}
+
+func (o Options) selects(e event.Event) bool {
+	if !o.From.IsZero() || !o.To.IsZero() {
+		v, _ := e.Value("date")
+
+		date, ok := v.(time.Time)
+		if !ok {
+			return false
+		} else if !o.From.IsZero() && date.Before(o.From) {
+			return false
+		} else if !o.To.IsZero() && !date.Before(o.To) {
+			return false
+		}
+	}
+
+	if o.Filter != nil && !o.Filter(e) {
+		return false
+	}
+
+	return true
+}
+
+// Stats contains the number of events read, sent, skipped because these
+// haven't been selected, and the number of invalid lines.
+type Stats struct {
+	Read    int
+	Sent    int
+	Skipped int
+	Invalid int
+}
+
+// Replay sends the selected events of the files to the channel, in order.
+// It returns when all files have been replayed or the context is done.
+func Replay(ctx context.Context, channel pushers.Channel, files []string, options Options) (Stats, error) {
+	stats := Stats{}
+
+	var interval time.Duration
+	if options.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / options.Rate)
+	}
+
+	next := time.Now()
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return stats, err
+		}
+
+		r := NewReader(f)
+
+		for {
+			e, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if _, ok := err.(*LineError); ok {
+				log.Warningf("Skipping invalid event in %s: %s", path, err.Error())
+				stats.Invalid++
+				continue
+			} else if err != nil {
+				f.Close()
+				return stats, err
+			}
+
+			stats.Read++
+
+			if !options.selects(e) {
+				stats.Skipped++
+				continue
+			}
+
+			if interval > 0 {
+				if d := time.Until(next); d > 0 {
+					select {
+					case <-time.After(d):
+					case <-ctx.Done():
+					}
+				}
+
+				next = next.Add(interval)
+				if now := time.Now(); next.Before(now) {
+					next = now
+				}
+			}
+
+			if ctx.Err() != nil {
+				f.Close()
+				return stats, ctx.Err()
+			}
+
+			channel.Send(e)
+			stats.Sent++
+		}
+
+		f.Close()
+
+		log.Debugf("Replayed %s", path)
+	}
+
+	return stats, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses the time of the --from and --to flags, either a date with
+// an optional time, or a duration before now like 72h.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a date like 2018-01-02, a time like 2018-01-02T15:04:05Z or a duration like 72h", s)
+}
@@ -0,0 +1,210 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package replay
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/event/expr"
+)
+
+type captureChannel []event.Event
+
+func (cc *captureChannel) Send(e event.Event) {
+	*cc = append(*cc, e)
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"events.json":                "",
+		"events.json-20180102030405": "",
+		"events.json-20171231000000": "",
+		"events.json-backup":         "",
+		"other.json":                 "",
+	})
+	defer os.RemoveAll(dir)
+
+	files, err := Files(filepath.Join(dir, "events.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "events.json-20171231000000"),
+		filepath.Join(dir, "events.json-20180102030405"),
+		filepath.Join(dir, "events.json"),
+	}
+
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+
+	if _, err := Files(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected missing file to fail")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"events.json-20180101000000": `{"date":"2017-12-31T23:00:00Z","category":"ssh","message":"a"}
+{"date":"2018-01-01T10:00:00Z","category":"ssh","source-port":2222,"message":"b"}
+`,
+		"events.json": `{"date":"2018-01-01T11:00:00Z","category":"telnet","message":"c"}
+not json
+{"category":"ssh","message":"no date"}
+
+{"date":"2018-01-01T12:00:00Z","category":"ssh","message":"d"}
+{"date":"2018-01-02T00:00:00Z","category":"ssh","message":"e"}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	files, err := Files(filepath.Join(dir, "events.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc := &captureChannel{}
+
+	stats, err := Replay(context.Background(), cc, files, Options{
+		From:   time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC),
+		Filter: expr.MustCompile("category == 'ssh'").Eval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (Stats{Read: 6, Sent: 2, Skipped: 4, Invalid: 1}); stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+
+	messages := []string{}
+	for _, e := range *cc {
+		messages = append(messages, e.Get("message"))
+	}
+
+	if !reflect.DeepEqual(messages, []string{"b", "d"}) {
+		t.Fatalf("Expected events b and d, got %v", messages)
+	}
+
+	e := (*cc)[0]
+
+	if v, _ := e.Value("date"); v != time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC) {
+		t.Errorf("Expected date to be restored, got %#v", v)
+	}
+
+	if v, _ := e.Value("source-port"); v != 2222 {
+		t.Errorf("Expected source-port to be an int, got %#v", v)
+	}
+}
+
+func TestReplayRate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"events.json": "{}\n{}\n{}\n{}\n{}\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cc := &captureChannel{}
+
+	start := time.Now()
+
+	stats, err := Replay(context.Background(), cc, []string{filepath.Join(dir, "events.json")}, Options{
+		Rate: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Sent != 5 {
+		t.Fatalf("Expected 5 events sent, got %d", stats.Sent)
+	}
+
+	// the first event is sent immediately
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected rate to be limited, replayed in %s", elapsed)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	e, err := parse([]byte(`{"@timestamp":"2018-01-01T10:00:00Z","event":{"id":"b9l6hv0d0qd5hd6rcrb0"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Has("id") || e.Has("date") {
+		t.Errorf("Expected no id and date besides the ECS fields, got %s and %v", e.Get("id"), e.Has("date"))
+	}
+
+	if v, _ := e.Value("event"); !reflect.DeepEqual(v, map[string]interface{}{"id": "b9l6hv0d0qd5hd6rcrb0"}) {
+		t.Errorf("Expected event.id to be kept, got %#v", v)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for s, expected := range map[string]time.Time{
+		"2018-01-01T10:00:00Z": time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC),
+		"2018-01-01":           time.Date(2018, 1, 1, 0, 0, 0, 0, time.Local),
+		"24h":                  now.Add(-24 * time.Hour),
+	} {
+		if v, err := ParseTime(s, now); err != nil || !v.Equal(expected) {
+			t.Errorf("Expected %s to be %s, got %s (%v)", s, expected, v, err)
+		}
+	}
+
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Error("Expected invalid time to fail")
+	}
+}
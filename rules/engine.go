@@ -0,0 +1,78 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rules
+
+import (
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+var log = logging.MustGetLogger("honeytrap:rules")
+
+// Engine evaluates the rules for every event it receives, and sends the alerts
+// of the rules that fire to the channel.
+type Engine struct {
+	rules   []Rule
+	channel pushers.Channel
+}
+
+// NewEngine returns an engine evaluating the rules, sending alerts to channel.
+func NewEngine(channel pushers.Channel, rules ...Rule) *Engine {
+	return &Engine{
+		rules:   rules,
+		channel: channel,
+	}
+}
+
+// Send evaluates the rules for the event. Alerts are ignored, so alerts can't
+// cause rules to fire.
+func (en *Engine) Send(e event.Event) {
+	if e.Get("category") == Category {
+		return
+	}
+
+	now := time.Now()
+
+	for _, rule := range en.rules {
+		a := rule.Eval(e, now)
+		if a == nil {
+			continue
+		}
+
+		log.Infof("Rule %s fired for %s (%d events)", a.Rule, a.Group, a.Count)
+
+		en.channel.Send(event.New(a.Options()...))
+	}
+}
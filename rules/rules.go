@@ -0,0 +1,322 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package rules contains the rule engine, which analyzes the events on the bus
+// and sends alert events when a rule fires. Alerts have the category alert, and
+// can be routed using filters like any other event.
+//
+// A threshold rule fires when at least threshold events match within the
+// window, a sequence rule when events match its steps in order within the
+// window. Events are counted per group, groups are defined by the values of
+// the group-by fields, addresses can be grouped by network by adding the
+// prefix length:
+//
+//    [[rule]]
+//    name="ssh-bruteforce"
+//    type="threshold"
+//    match="category == 'ssh' && type == 'password-authentication'"
+//    group-by=["source-ip/24"]
+//    threshold=50
+//    window="5m"
+//    severity="high"
+//
+//    [[rule]]
+//    name="ssh-login-download"
+//    type="sequence"
+//    steps=["ssh.authenticated == true", "ssh.command =~ 'wget|curl'"]
+//    group-by=["source-ip"]
+//    window="10m"
+package rules
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/event/expr"
+)
+
+// Category is the category of the alert events.
+const Category = "alert"
+
+// Rule types.
+const (
+	TypeThreshold = "threshold"
+	TypeSequence  = "sequence"
+)
+
+// Severities of alerts.
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Rule defines an interface for rules. Eval is called for every event, and
+// returns the alert when the rule fires.
+type Rule interface {
+	Name() string
+	Eval(e event.Event, now time.Time) *Alert
+}
+
+// Alert contains the details of a fired rule.
+type Alert struct {
+	Rule     string
+	Severity string
+	Message  string
+
+	// Group is the key of the group, eg. 192.0.2.0/24
+	Group string
+	Count int
+
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// Event is the event that caused the rule to fire
+	Event event.Event
+}
+
+var fieldRe = regexp.MustCompile(`{([A-Za-z0-9_\-.]+)}`)
+
+// Options returns the options of the alert event. The message can contain
+// fields of the event that caused the rule to fire, eg. {source-ip}, and
+// {count} and {group}.
+func (a *Alert) Options() []event.Option {
+	message := fieldRe.ReplaceAllStringFunc(a.Message, func(s string) string {
+		switch name := s[1 : len(s)-1]; name {
+		case "count":
+			return strconv.Itoa(a.Count)
+		case "group":
+			return a.Group
+		default:
+			if v, ok := a.Event.Value(name); ok {
+				return fmt.Sprint(v)
+			}
+
+			return s
+		}
+	})
+
+	options := []event.Option{
+		event.Sensor("rules"),
+		event.Category(Category),
+		event.Type(a.Rule),
+		event.Severity(a.Severity),
+		event.Custom("alert.rule", a.Rule),
+		event.Custom("alert.group", a.Group),
+		event.Custom("alert.count", a.Count),
+		event.Custom("alert.first-seen", a.FirstSeen),
+		event.Custom("alert.last-seen", a.LastSeen),
+	}
+
+	if message != "" {
+		options = append(options, event.Message("%s", message))
+	}
+
+	// the addresses of the event, to be able to filter and enrich the alert
+	for _, field := range []string{"source-ip", "source-port", "destination-ip", "destination-port", "service"} {
+		if v, ok := a.Event.Value(field); ok {
+			options = append(options, event.Custom(field, v))
+		}
+	}
+
+	return options
+}
+
+// Config contains the configuration of a rule.
+type Config struct {
+	Name     string       `toml:"name"`
+	Type     string       `toml:"type"`
+	Severity string       `toml:"severity"`
+	Message  string       `toml:"message"`
+	GroupBy  []string     `toml:"group-by"`
+	Window   config.Delay `toml:"window"`
+
+	// Match and Threshold configure threshold rules
+	Match     string `toml:"match"`
+	Threshold int    `toml:"threshold"`
+
+	// Steps configures sequence rules
+	Steps []string `toml:"steps"`
+}
+
+// New returns the rule of the configuration.
+func New(c Config) (Rule, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("name not set")
+	}
+
+	switch c.Severity {
+	case "":
+		c.Severity = SeverityMedium
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+	default:
+		return nil, fmt.Errorf("unknown severity %s, expected %s, %s, %s or %s", c.Severity, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical)
+	}
+
+	if c.Window.Duration() <= 0 {
+		return nil, fmt.Errorf("window not set")
+	}
+
+	groupBy, err := parseGroupBy(c.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	b := base{
+		name:     c.Name,
+		severity: c.Severity,
+		message:  c.Message,
+		groupBy:  groupBy,
+		window:   c.Window.Duration(),
+	}
+
+	switch c.Type {
+	case TypeThreshold:
+		return newThreshold(b, c)
+	case TypeSequence:
+		return newSequence(b, c)
+	case "":
+		return nil, fmt.Errorf("type not set")
+	default:
+		return nil, fmt.Errorf("unknown type %s, expected %s or %s", c.Type, TypeThreshold, TypeSequence)
+	}
+}
+
+// compile compiles the expression, the error refers to the key.
+func compile(key string, s string) (*expr.Expression, error) {
+	x, err := expr.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", key, err.Error())
+	}
+
+	return x, nil
+}
+
+// groupField is a field the events are grouped by, addresses are grouped
+// by network if mask is set.
+type groupField struct {
+	name string
+	bits int
+}
+
+func parseGroupBy(fields []string) ([]groupField, error) {
+	groupBy := make([]groupField, len(fields))
+
+	for i, field := range fields {
+		parts := strings.SplitN(field, "/", 2)
+
+		groupBy[i].name = parts[0]
+
+		if len(parts) == 1 {
+			continue
+		}
+
+		bits, err := strconv.Atoi(parts[1])
+		if err != nil || bits < 0 || bits > 128 {
+			return nil, fmt.Errorf("invalid prefix length in group-by field %s", field)
+		}
+
+		groupBy[i].bits = bits
+	}
+
+	return groupBy, nil
+}
+
+func (f groupField) value(e event.Event) string {
+	v, ok := e.Value(f.name)
+	if !ok {
+		return ""
+	}
+
+	s := fmt.Sprint(v)
+	if f.bits == 0 {
+		return s
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return s
+	}
+
+	// prefix lengths larger than 32 only apply to IPv6 addresses
+	if ip4 := ip.To4(); ip4 != nil {
+		bits := f.bits
+		if bits > 32 {
+			bits = 32
+		}
+
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(bits, 32)), Mask: net.CIDRMask(bits, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(f.bits, 128)), Mask: net.CIDRMask(f.bits, 128)}).String()
+}
+
+// base contains the fields common to all rules.
+type base struct {
+	name     string
+	severity string
+	message  string
+	groupBy  []groupField
+	window   time.Duration
+}
+
+func (b *base) Name() string {
+	return b.name
+}
+
+// group returns the key of the group of the event.
+func (b *base) group(e event.Event) string {
+	values := make([]string, len(b.groupBy))
+	for i, f := range b.groupBy {
+		values[i] = f.value(e)
+	}
+
+	return strings.Join(values, "+")
+}
+
+func (b *base) alert(e event.Event, group string, count int, firstSeen, lastSeen time.Time) *Alert {
+	return &Alert{
+		Rule:      b.name,
+		Severity:  b.severity,
+		Message:   b.message,
+		Group:     group,
+		Count:     count,
+		FirstSeen: firstSeen,
+		LastSeen:  lastSeen,
+		Event:     e,
+	}
+}
@@ -0,0 +1,230 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func mustRule(t *testing.T, c Config) Rule {
+	r, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func authEvent(ip string) event.Event {
+	return event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.Custom("source-ip", ip),
+	)
+}
+
+func TestThreshold(t *testing.T) {
+	r := mustRule(t, Config{
+		Name:      "ssh-bruteforce",
+		Type:      TypeThreshold,
+		Match:     `category == "ssh" && type == "password-authentication"`,
+		GroupBy:   []string{"source-ip/24"},
+		Threshold: 3,
+		Window:    config.Delay(time.Minute),
+	})
+
+	now := time.Now()
+
+	if a := r.Eval(authEvent("192.0.2.1"), now); a != nil {
+		t.Fatalf("Unexpected alert: %+v", a)
+	}
+
+	// outside of the group
+	if a := r.Eval(authEvent("198.51.100.1"), now); a != nil {
+		t.Fatalf("Unexpected alert: %+v", a)
+	}
+
+	// not matching
+	if a := r.Eval(event.New(event.Category("http"), event.Custom("source-ip", "192.0.2.2")), now); a != nil {
+		t.Fatalf("Unexpected alert: %+v", a)
+	}
+
+	if a := r.Eval(authEvent("192.0.2.2"), now.Add(10*time.Second)); a != nil {
+		t.Fatalf("Unexpected alert: %+v", a)
+	}
+
+	a := r.Eval(authEvent("192.0.2.3"), now.Add(20*time.Second))
+	if a == nil {
+		t.Fatal("Expected alert")
+	}
+
+	if a.Group != "192.0.2.0/24" || a.Count != 3 || !a.FirstSeen.Equal(now) || a.Severity != SeverityMedium {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+
+	// the count starts over after firing
+	if a := r.Eval(authEvent("192.0.2.1"), now.Add(30*time.Second)); a != nil {
+		t.Fatalf("Unexpected alert: %+v", a)
+	}
+}
+
+func TestThresholdWindow(t *testing.T) {
+	r := mustRule(t, Config{
+		Name:      "ssh-bruteforce",
+		Type:      TypeThreshold,
+		Match:     `category == "ssh"`,
+		GroupBy:   []string{"source-ip"},
+		Threshold: 2,
+		Window:    config.Delay(time.Minute),
+	})
+
+	now := time.Now()
+
+	r.Eval(authEvent("192.0.2.1"), now)
+
+	if a := r.Eval(authEvent("192.0.2.1"), now.Add(2*time.Minute)); a != nil {
+		t.Fatalf("Expected events outside the window to be ignored, got %+v", a)
+	}
+
+	if a := r.Eval(authEvent("192.0.2.1"), now.Add(2*time.Minute+time.Second)); a == nil {
+		t.Fatal("Expected alert")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	r := mustRule(t, Config{
+		Name:     "ssh-login-download",
+		Type:     TypeSequence,
+		Steps:    []string{`ssh.authenticated == true`, `ssh.command =~ 'wget|curl'`},
+		GroupBy:  []string{"source-ip"},
+		Window:   config.Delay(10 * time.Minute),
+		Severity: SeverityHigh,
+	})
+
+	login := event.New(event.Custom("source-ip", "192.0.2.1"), event.Custom("ssh.authenticated", true))
+	wget := event.New(event.Custom("source-ip", "192.0.2.1"), event.Custom("ssh.command", "wget http://example.com/x"))
+	ls := event.New(event.Custom("source-ip", "192.0.2.1"), event.Custom("ssh.command", "ls"))
+
+	now := time.Now()
+
+	if a := r.Eval(wget, now); a != nil {
+		t.Fatalf("Expected steps to match in order, got %+v", a)
+	}
+
+	r.Eval(login, now)
+	r.Eval(ls, now.Add(time.Minute))
+
+	a := r.Eval(wget, now.Add(2*time.Minute))
+	if a == nil {
+		t.Fatal("Expected alert")
+	}
+
+	if a.Rule != "ssh-login-download" || a.Severity != SeverityHigh || a.Count != 2 {
+		t.Errorf("Unexpected alert: %+v", a)
+	}
+
+	// expired sequence
+	r.Eval(login, now)
+
+	if a := r.Eval(wget, now.Add(11*time.Minute)); a != nil {
+		t.Fatalf("Expected expired sequence, got %+v", a)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	window := config.Delay(time.Minute)
+
+	tests := []Config{
+		{Type: TypeThreshold, Match: "category", Threshold: 1, Window: window},
+		{Name: "r", Match: "category", Threshold: 1, Window: window},
+		{Name: "r", Type: "unknown", Window: window},
+		{Name: "r", Type: TypeThreshold, Match: "category", Threshold: 1},
+		{Name: "r", Type: TypeThreshold, Match: "category ==", Threshold: 1, Window: window},
+		{Name: "r", Type: TypeThreshold, Match: "category", Window: window},
+		{Name: "r", Type: TypeThreshold, Match: "category", Threshold: 1, Window: window, Severity: "extreme"},
+		{Name: "r", Type: TypeThreshold, Match: "category", Threshold: 1, Window: window, GroupBy: []string{"source-ip/x"}},
+		{Name: "r", Type: TypeSequence, Window: window},
+	}
+
+	for _, c := range tests {
+		if _, err := New(c); err == nil {
+			t.Errorf("Expected error for %+v", c)
+		}
+	}
+}
+
+type captureChannel []event.Event
+
+func (cc *captureChannel) Send(e event.Event) {
+	*cc = append(*cc, e)
+}
+
+func TestEngine(t *testing.T) {
+	r := mustRule(t, Config{
+		Name:      "any-alert",
+		Type:      TypeThreshold,
+		Match:     "true",
+		GroupBy:   []string{"source-ip"},
+		Threshold: 1,
+		Window:    config.Delay(time.Minute),
+		Message:   "{count} events from {source-ip} ({unknown})",
+	})
+
+	cc := &captureChannel{}
+	engine := NewEngine(cc, r)
+
+	engine.Send(authEvent("192.0.2.1"))
+
+	if len(*cc) != 1 {
+		t.Fatalf("Expected 1 alert, got %d", len(*cc))
+	}
+
+	alert := (*cc)[0]
+
+	if alert.Get("category") != Category || alert.Get("type") != "any-alert" || alert.Get("severity") != SeverityMedium || alert.Get("source-ip") != "192.0.2.1" {
+		t.Errorf("Unexpected alert: %+v", event.ToMap(alert))
+	}
+
+	if got := alert.Get("message"); got != "1 events from 192.0.2.1 ({unknown})" {
+		t.Errorf("Unexpected message: %s", got)
+	}
+
+	// alerts don't cause alerts
+	engine.Send(alert)
+
+	if len(*cc) != 1 {
+		t.Errorf("Expected alerts to be ignored, got %d alerts", len(*cc))
+	}
+}
@@ -0,0 +1,135 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rules
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/event/expr"
+)
+
+// sequence fires when events of a group match the steps in order, within the
+// window starting at the event matching the first step. Events not matching
+// the next step are ignored.
+type sequence struct {
+	base
+
+	steps []*expr.Expression
+
+	m sync.Mutex
+
+	groups    map[string]*progress
+	lastPrune time.Time
+}
+
+// progress is the state of the sequence of a group.
+type progress struct {
+	// step is the index of the next step
+	step int
+
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+func newSequence(b base, c Config) (Rule, error) {
+	if len(c.Steps) == 0 {
+		return nil, fmt.Errorf("steps not set")
+	}
+
+	s := &sequence{
+		base:   b,
+		groups: map[string]*progress{},
+	}
+
+	for i, step := range c.Steps {
+		x, err := compile(fmt.Sprintf("step %d", i+1), step)
+		if err != nil {
+			return nil, err
+		}
+
+		s.steps = append(s.steps, x)
+	}
+
+	return s, nil
+}
+
+func (s *sequence) Eval(e event.Event, now time.Time) *Alert {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	since := now.Add(-s.window)
+
+	if now.Sub(s.lastPrune) > s.window {
+		for key, p := range s.groups {
+			if !p.firstSeen.After(since) {
+				delete(s.groups, key)
+			}
+		}
+
+		s.lastPrune = now
+	}
+
+	key := s.group(e)
+
+	p, ok := s.groups[key]
+	if ok && !p.firstSeen.After(since) {
+		delete(s.groups, key)
+		ok = false
+	}
+
+	if !ok {
+		if !s.steps[0].Eval(e) {
+			return nil
+		}
+
+		p = &progress{
+			firstSeen: now,
+		}
+
+		s.groups[key] = p
+	} else if !s.steps[p.step].Eval(e) {
+		return nil
+	}
+
+	p.step++
+	p.lastSeen = now
+
+	if p.step < len(s.steps) {
+		return nil
+	}
+
+	delete(s.groups, key)
+
+	return s.alert(e, key, p.step, p.firstSeen, p.lastSeen)
+}
@@ -0,0 +1,120 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rules
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/event/expr"
+)
+
+// threshold fires when at least threshold events of a group match within the
+// window. The count of the group starts over after firing.
+type threshold struct {
+	base
+
+	match     *expr.Expression
+	threshold int
+
+	m sync.Mutex
+
+	// groups contains the times of the matching events within the window
+	groups    map[string][]time.Time
+	lastPrune time.Time
+}
+
+func newThreshold(b base, c Config) (Rule, error) {
+	if c.Match == "" {
+		return nil, fmt.Errorf("match not set")
+	}
+
+	if c.Threshold <= 0 {
+		return nil, fmt.Errorf("threshold not set")
+	}
+
+	match, err := compile("match", c.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	return &threshold{
+		base:      b,
+		match:     match,
+		threshold: c.Threshold,
+		groups:    map[string][]time.Time{},
+	}, nil
+}
+
+// within returns the times after since.
+func within(times []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(since) {
+		i++
+	}
+
+	return times[i:]
+}
+
+func (t *threshold) Eval(e event.Event, now time.Time) *Alert {
+	if !t.match.Eval(e) {
+		return nil
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	since := now.Add(-t.window)
+
+	if now.Sub(t.lastPrune) > t.window {
+		for key, times := range t.groups {
+			if len(within(times, since)) == 0 {
+				delete(t.groups, key)
+			}
+		}
+
+		t.lastPrune = now
+	}
+
+	key := t.group(e)
+
+	times := append(within(t.groups[key], since), now)
+	if len(times) < t.threshold {
+		t.groups[key] = times
+		return nil
+	}
+
+	delete(t.groups, key)
+
+	return t.alert(e, key, len(times), times[0], now)
+}
@@ -0,0 +1,192 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/honeytrap/honeytrap/web/api"
+)
+
+// adminSensor exposes the running state to the admin api.
+type adminSensor struct {
+	hc *Honeytrap
+}
+
+// rawType returns the configured type of the component.
+func (st *state) rawType(key string) string {
+	return fmt.Sprintf("%v", st.raw[key]["type"])
+}
+
+func (s *adminSensor) Services() []api.Service {
+	services := []api.Service{}
+
+	st := s.hc.currentState()
+	if st == nil {
+		return services
+	}
+
+	for _, sm := range st.services {
+		services = append(services, api.Service{
+			Name: sm.Name,
+			Type: sm.Type,
+		})
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services
+}
+
+func (s *adminSensor) Ports() []api.Port {
+	ports := []api.Port{}
+
+	st := s.hc.currentState()
+	if st == nil {
+		return ports
+	}
+
+	for _, r := range []*routes{st.tcp, st.udp} {
+		for _, b := range r.all() {
+			p := api.Port{
+				Port:     b.String(),
+				Services: []string{},
+			}
+
+			for _, sm := range b.services {
+				p.Services = append(p.Services, sm.Name)
+			}
+
+			if b.defaultService != nil {
+				p.DefaultService = b.defaultService.Name
+			}
+
+			ports = append(ports, p)
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Port < ports[j].Port
+	})
+
+	return ports
+}
+
+func (s *adminSensor) Directors() []api.Director {
+	directors := []api.Director{}
+
+	st := s.hc.currentState()
+	if st == nil {
+		return directors
+	}
+
+	for name := range st.directors {
+		directors = append(directors, api.Director{
+			Name: name,
+			Type: st.rawType("director." + name),
+		})
+	}
+
+	sort.Slice(directors, func(i, j int) bool {
+		return directors[i].Name < directors[j].Name
+	})
+
+	return directors
+}
+
+func (s *adminSensor) Channels() []api.Channel {
+	channels := []api.Channel{}
+
+	st := s.hc.currentState()
+	if st == nil {
+		return channels
+	}
+
+	for name := range st.channels {
+		channels = append(channels, api.Channel{
+			Name: name,
+			Type: st.rawType("channel." + name),
+		})
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name < channels[j].Name
+	})
+
+	return channels
+}
+
+func (s *adminSensor) Connections() []api.Connection {
+	connections := []api.Connection{}
+
+	s.hc.conns.Range(func(key, value interface{}) bool {
+		c := value.(*connection)
+
+		ac := api.Connection{
+			ID:          c.ID,
+			Source:      c.RemoteAddr().String(),
+			Destination: c.LocalAddr().String(),
+			Start:       c.Start,
+			BytesIn:     c.BytesIn(),
+			BytesOut:    c.BytesOut(),
+		}
+
+		if sm := c.Service(); sm != nil {
+			ac.Service = sm.Name
+		}
+
+		connections = append(connections, ac)
+		return true
+	})
+
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Start.Before(connections[j].Start)
+	})
+
+	return connections
+}
+
+func (s *adminSensor) Kill(id string) error {
+	v, ok := s.hc.conns.Load(id)
+	if !ok {
+		return api.ErrNotFound
+	}
+
+	log.Infof("Killing connection %s by admin request", id)
+	return v.(*connection).Close()
+}
+
+func (s *adminSensor) Reload() error {
+	return s.hc.Reload()
+}
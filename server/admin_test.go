@@ -0,0 +1,91 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/web/api"
+)
+
+func TestAdminSensor(t *testing.T) {
+	hc, _ := New()
+
+	ssh := &ServiceMap{Name: "ssh01", Type: "ssh-simulator"}
+
+	st := &state{
+		services: map[string]*ServiceMap{"ssh01": ssh},
+		tcp:      newRoutes(),
+		udp:      newRoutes(),
+	}
+
+	st.tcp.add(&binding{
+		PortRange:      PortRange{Proto: "tcp", From: 22, To: 22},
+		services:       []*ServiceMap{ssh},
+		defaultService: ssh,
+	})
+
+	hc.setState(st)
+
+	s := &adminSensor{hc}
+
+	ports := s.Ports()
+	if len(ports) != 1 || ports[0].Port != "tcp/22" || ports[0].DefaultService != "ssh01" {
+		t.Errorf("Unexpected ports: %+v", ports)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newConnection(server)
+	c.setService(ssh)
+
+	hc.conns.Store(c.ID, c)
+
+	connections := s.Connections()
+	if len(connections) != 1 || connections[0].ID != c.ID || connections[0].Service != "ssh01" {
+		t.Fatalf("Unexpected connections: %+v", connections)
+	}
+
+	if err := s.Kill("unknown"); err != api.ErrNotFound {
+		t.Errorf("Expected %s, got %v", api.ErrNotFound, err)
+	}
+
+	if err := s.Kill(c.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected killed connection to be closed, got %v", err)
+	}
+}
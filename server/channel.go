@@ -0,0 +1,106 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// NewChannel returns the channel with the name from the configuration, the
+// events will be converted to the format of the channel. The queue and spool
+// of the channel aren't used, the channel is meant to be used on its own, like
+// when replaying events. The options are applied after the configuration, like
+// the data directory and the channel for the events of the channel itself.
+func NewChannel(conf *config.Config, name string, options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	s, ok := conf.Channels[name]
+	if !ok {
+		return nil, fmt.Errorf("Could not find channel %s", name)
+	}
+
+	x := struct {
+		Type   string `toml:"type"`
+		Format string `toml:"format"`
+	}{}
+
+	if err := conf.PrimitiveDecode(s, &x); err != nil {
+		return nil, fmt.Errorf("Error parsing configuration of channel %s: %s", name, err.Error())
+	}
+
+	fn, ok := formats[x.Format]
+	if !ok && x.Format != "" {
+		return nil, fmt.Errorf("Unknown format %s for channel %s, expected ecs", x.Format, name)
+	}
+
+	channelFunc, ok := pushers.Get(x.Type)
+	if !ok {
+		return nil, fmt.Errorf("Channel %s not supported on platform (%s)", x.Type, name)
+	}
+
+	channel, err := channelFunc(
+		append([]func(pushers.Channel) error{pushers.WithConfig(s)}, options...)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing channel %s(%s): %s", name, x.Type, err)
+	}
+
+	if fn == nil {
+		return channel, nil
+	}
+
+	return &convertedChannel{pushers.ConvertChannel(channel, fn), channel}, nil
+}
+
+// convertedChannel flushes and closes the underlying channel of a
+// converting channel.
+type convertedChannel struct {
+	pushers.Channel
+
+	underlying pushers.Channel
+}
+
+func (cc *convertedChannel) Flush() error {
+	if f, ok := cc.underlying.(pushers.Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func (cc *convertedChannel) Close() error {
+	if c, ok := cc.underlying.(pushers.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
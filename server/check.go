@@ -0,0 +1,274 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logging "github.com/op/go-logging"
+
+	"github.com/honeytrap/honeytrap/config"
+)
+
+// Severities of the problems found while checking the configuration.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Problem describes a problem found while checking the configuration.
+type Problem struct {
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Section  string `json:"section,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (p Problem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location = fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+
+	if p.Section != "" {
+		return fmt.Sprintf("%s: %s: [%s] %s", location, p.Severity, p.Section, p.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, p.Severity, p.Message)
+}
+
+var (
+	nearLineRe = regexp.MustCompile(`^Near line (\d+)`)
+	headerRe   = regexp.MustCompile(`^\s*(\[\[?)\s*([^\]]+?)\s*\]`)
+	keyRe      = regexp.MustCompile(`^\s*([A-Za-z0-9_\-"'.]+)\s*=`)
+)
+
+// sectionLines returns the line of the header of every section, and of the
+// first occurrence of every key. Arrays of tables are indexed as well, port.0
+// is the first [[port]] and port.0.services its services key, filter.0.aggregate
+// the [filter.aggregate] table following the first [[filter]].
+func sectionLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	arrays := map[string]int{}
+
+	set := func(name string, n int) {
+		if _, ok := lines[name]; !ok {
+			lines[name] = n
+		}
+	}
+
+	section := ""
+
+	// element is the indexed name of the current array table, like port.0
+	element := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for n := 1; scanner.Scan(); n++ {
+		if m := keyRe.FindStringSubmatch(scanner.Text()); m == nil {
+		} else if section == "" {
+			set(unquote(m[1]), n)
+			continue
+		} else {
+			set(section+"."+unquote(m[1]), n)
+			if element != "" {
+				set(element+"."+unquote(m[1]), n)
+			}
+			continue
+		}
+
+		m := headerRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		section = unquote(m[2])
+		element = ""
+
+		// parents of nested tables, like limits for [limits.source]
+		parts := strings.Split(section, ".")
+		for i := 1; i <= len(parts); i++ {
+			set(strings.Join(parts[:i], "."), n)
+		}
+
+		if m[1] == "[[" {
+			element = fmt.Sprintf("%s.%d", section, arrays[section])
+			set(element, n)
+			arrays[section]++
+			continue
+		}
+
+		// tables within the last element of an array, like filter.0.aggregate
+		// for [filter.aggregate]
+		for name, count := range arrays {
+			if !strings.HasPrefix(section, name+".") {
+				continue
+			}
+
+			element = fmt.Sprintf("%s.%d%s", name, count-1, strings.TrimPrefix(section, name))
+			set(element, n)
+		}
+	}
+
+	return lines
+}
+
+// unquote returns the dotted name without quotes and whitespace.
+func unquote(name string) string {
+	parts := strings.Split(name, ".")
+	for i := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(parts[i]), `"'`)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// lookup returns the line of the section, or of its closest parent.
+func lookup(lines map[string]int, section string) int {
+	parts := strings.Split(section, ".")
+
+	for i := len(parts); i > 0; i-- {
+		if n, ok := lines[strings.Join(parts[:i], ".")]; ok {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// Check loads the configuration and initializes every channel, director,
+// service and the listener, without listening on any port. All problems will
+// be returned, sorted by line. The options are used to create the Honeytrap
+// instance, services may need a data directory.
+func Check(file string, data []byte, options ...OptionFn) []Problem {
+	problems := []Problem{}
+
+	lines := sectionLines(data)
+
+	add := func(severity string, err error) {
+		p := Problem{
+			Severity: severity,
+			File:     file,
+			Message:  err.Error(),
+		}
+
+		if se, ok := err.(*sectionError); ok {
+			p.Section = se.section
+			p.Line = lookup(lines, se.section)
+		}
+
+		if se, ok := err.(*sectionError); !ok || se.key == "" {
+		} else if n, ok := lines[se.key]; ok {
+			p.Line = n
+		}
+
+		problems = append(problems, p)
+	}
+
+	conf := &config.Config{}
+	if err := conf.Decode(bytes.NewReader(data)); err != nil {
+		p := Problem{
+			Severity: SeverityError,
+			File:     file,
+			Message:  err.Error(),
+		}
+
+		if m := nearLineRe.FindStringSubmatch(err.Error()); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+		}
+
+		return append(problems, p)
+	}
+
+	for _, l := range conf.Logging {
+		if _, err := logging.LogLevel(l.Level); err != nil {
+			add(SeverityError, inSection("logging", fmt.Errorf("Invalid log level %s: %s", l.Level, err.Error())))
+		}
+	}
+
+	hc, err := New(options...)
+	if err != nil {
+		add(SeverityError, err)
+		return problems
+	}
+
+	hc.config = conf
+	hc.checking = true
+
+	if _, err := hc.newListener(conf); err != nil {
+		add(SeverityError, inSection("listener", err))
+	}
+
+	st, err := hc.checkState(conf)
+	if errs, ok := err.(configErrors); ok {
+		for _, err := range errs {
+			add(SeverityError, err)
+		}
+	} else if err != nil {
+		add(SeverityError, err)
+	}
+
+	if st != nil {
+		for _, err := range st.warnings {
+			add(SeverityWarning, err)
+		}
+
+		closeAggregates(st.aggregates)
+		shutdownChannels(st.channels, time.Second)
+		closeEnrichers(st.enrichers, nil)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems
+}
+
+// checkState builds the state, a panic while initializing a component
+// will be returned as error.
+func (hc *Honeytrap) checkState(conf *config.Config) (st *state, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Panic while initializing configuration: %v", r)
+		}
+	}()
+
+	return hc.newState(conf, nil)
+}
@@ -0,0 +1,157 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+const checkConfig = `drain-timout = "5s"
+
+[listener]
+type="socket"
+
+[service.echo]
+type="echo"
+
+[service.unused]
+type="echo"
+
+[[port]]
+port="tcp/8080"
+services=["echo", "missing"]
+
+[[port]]
+port="tcp/8080"
+services=["echo"]
+
+[channel.console]
+type="console"
+
+[[filter]]
+channel=["console", "missing"]
+
+[[filter]]
+channel=["console"]
+expression="category == "
+
+[limits.source]
+action = "zap"
+
+[[filter]]
+channel=["console"]
+
+[filter.aggregate]
+window="-1s"
+
+[channel.spooled]
+type="console"
+
+[channel.spooled.spool]
+max-size="lots"
+`
+
+func TestCheck(t *testing.T) {
+	problems := Check("config.toml", []byte(checkConfig))
+
+	expected := []Problem{
+		{SeverityWarning, "config.toml", 1, "drain-timout", "Unrecognized key in configuration: drain-timout"},
+		{SeverityWarning, "config.toml", 9, "service.unused", "Service unused is defined but not used"},
+		{SeverityError, "config.toml", 12, "port.0", "Unknown service 'missing' for port tcp/8080"},
+		{SeverityError, "config.toml", 16, "port.1", "Port tcp/8080 was already defined, ignoring the newer definition"},
+		{SeverityError, "config.toml", 23, "filter.0", "Could not find channel missing for filter"},
+		{SeverityError, "config.toml", 28, "filter.1", "Error compiling expression of filter: at position 13: expected field or value, got end of expression"},
+		{SeverityError, "config.toml", 30, "limits", "Unknown action zap for source limit, expected drop, rst or tarpit"},
+		{SeverityError, "config.toml", 36, "filter.2.aggregate", "Invalid aggregate window -1s for filter"},
+		{SeverityError, "config.toml", 42, "channel.spooled.spool", "Invalid spool for channel spooled: invalid max-size: invalid size \"lots\""},
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %+v", len(expected), len(problems), problems)
+	}
+
+	for i := range expected {
+		if problems[i] != expected[i] {
+			t.Errorf("Problem %d: got %s, expected %s", i, problems[i], expected[i])
+		}
+	}
+}
+
+func TestCheckSyntaxError(t *testing.T) {
+	problems := Check("config.toml", []byte("[listener]\ntype = \n"))
+
+	if len(problems) != 1 || problems[0].Line != 2 || problems[0].Severity != SeverityError {
+		t.Errorf("Expected a single syntax error on line 2, got %+v", problems)
+	}
+}
+
+func TestCheckValid(t *testing.T) {
+	problems := Check("config.toml", []byte(`
+[listener]
+type="socket"
+
+[service.echo]
+type="echo"
+
+[[port]]
+port="tcp/8080"
+services=["echo"]
+`))
+
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems, got %+v", problems)
+	}
+}
+
+func TestCheckSocketPortRange(t *testing.T) {
+	config := `
+[listener]
+%s
+
+[service.echo]
+type="echo"
+
+[[port]]
+port="tcp/any"
+services=["echo"]
+`
+
+	problems := Check("config.toml", []byte(fmt.Sprintf(config, `type="socket"`)))
+	if len(problems) != 1 || problems[0].Section != "listener" || problems[0].Severity != SeverityError {
+		t.Errorf("Expected an error for the socket listener, got %+v", problems)
+	}
+
+	if problems := Check("config.toml", []byte(fmt.Sprintf(config, `type="netstack"
+interfaces=["lo"]`))); len(problems) != 0 {
+		t.Errorf("Expected no problems for the netstack listener, got %+v", problems)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Reasons for a connection to be closed, reported in the connection closed event.
+const (
+	CloseReasonEOF       = "eof"
+	CloseReasonTimeout   = "timeout"
+	CloseReasonPanic     = "panic"
+	CloseReasonNoService = "no-service"
+	CloseReasonShutdown  = "shutdown"
+	CloseReasonClosed    = "closed"
+	CloseReasonError     = "error"
+)
+
+// connection wraps an accepted connection, counting the bytes read and
+// written, and keeps track of the service handling it.
+type connection struct {
+	net.Conn
+
+	ID    string
+	Start time.Time
+
+	bytesIn  uint64
+	bytesOut uint64
+
+	m       sync.Mutex
+	service *ServiceMap
+	readErr error
+}
+
+func newConnection(conn net.Conn) *connection {
+	return &connection{
+		Conn:  conn,
+		ID:    xid.New().String(),
+		Start: time.Now(),
+	}
+}
+
+func (c *connection) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.bytesIn, uint64(n))
+
+	if err != nil {
+		c.m.Lock()
+		c.readErr = err
+		c.m.Unlock()
+	}
+
+	return n, err
+}
+
+func (c *connection) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.bytesOut, uint64(n))
+	return n, err
+}
+
+// BytesIn returns the number of bytes read from the connection.
+func (c *connection) BytesIn() uint64 {
+	return atomic.LoadUint64(&c.bytesIn)
+}
+
+// BytesOut returns the number of bytes written to the connection.
+func (c *connection) BytesOut() uint64 {
+	return atomic.LoadUint64(&c.bytesOut)
+}
+
+// Service returns the service handling the connection, nil if no service
+// has been chosen (yet).
+func (c *connection) Service() *ServiceMap {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.service
+}
+
+func (c *connection) setService(sm *ServiceMap) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.service = sm
+}
+
+// closeReason determines why the connection has ended, using the last read error.
+func (c *connection) closeReason(ctx context.Context) string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if ctx.Err() != nil {
+		return CloseReasonShutdown
+	} else if c.readErr == nil {
+		return CloseReasonClosed
+	} else if c.readErr == io.EOF {
+		return CloseReasonEOF
+	} else if ne, ok := c.readErr.(net.Error); ok && ne.Timeout() {
+		return CloseReasonTimeout
+	}
+
+	return CloseReasonError
+}
+
+// Options returns the event options identifying the connection and service,
+// which services will include in their events. The connection is the session
+// the events are part of.
+func (c *connection) Options() event.Option {
+	options := []event.Option{
+		event.Custom("connection-id", c.ID),
+		event.SessionID(c.ID),
+	}
+
+	if sm := c.Service(); sm != nil {
+		options = append(options,
+			event.Service(sm.Name),
+			event.Custom("service-type", sm.Type),
+		)
+	}
+
+	return event.NewWith(options...)
+}
+
+// eventConnectionOpened returns a connection opened event.
+func eventConnectionOpened(c *connection, options ...event.Option) event.Event {
+	return event.New(
+		event.ConnectionSensor,
+		event.Category("connection"),
+		event.ConnectionOpened,
+		event.SourceAddr(c.RemoteAddr()),
+		event.DestinationAddr(c.LocalAddr()),
+		event.NewWith(options...),
+	)
+}
+
+// eventConnectionClosed returns a connection closed event.
+func eventConnectionClosed(c *connection, reason string, options ...event.Option) event.Event {
+	return event.New(
+		event.ConnectionSensor,
+		event.Category("connection"),
+		event.ConnectionClosed,
+		event.SourceAddr(c.RemoteAddr()),
+		event.DestinationAddr(c.LocalAddr()),
+		event.NewWith(options...),
+		event.Custom("bytes-in", c.BytesIn()),
+		event.Custom("bytes-out", c.BytesOut()),
+		event.Custom("duration", time.Since(c.Start).Seconds()),
+		event.Custom("close-reason", reason),
+	)
+}
@@ -0,0 +1,89 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestConnectionCounters(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	c := newConnection(server)
+
+	go func() {
+		client.Write([]byte("hello"))
+
+		buf := make([]byte, 3)
+		io.ReadFull(client, buf)
+
+		client.Close()
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Read(buf); err != io.EOF {
+		t.Fatalf("Expected EOF, got %v", err)
+	}
+
+	if c.BytesIn() != 5 || c.BytesOut() != 3 {
+		t.Errorf("Wrong counters: in=%d out=%d", c.BytesIn(), c.BytesOut())
+	}
+
+	if reason := c.closeReason(context.Background()); reason != CloseReasonEOF {
+		t.Errorf("Wrong close reason: got %s, expected %s", reason, CloseReasonEOF)
+	}
+
+	c.setService(&ServiceMap{Name: "echo", Type: "echo"})
+
+	ec := event.WithConn(c, c.Options())
+	if id := event.New(ec.Options()).Get("connection-id"); id != c.ID {
+		t.Errorf("Wrong connection id: got %s, expected %s", id, c.ID)
+	}
+
+	e := eventConnectionClosed(c, CloseReasonEOF, ec.Options())
+	if e.Get("connection-id") != c.ID || e.Get("service") != "echo" || e.Get("close-reason") != CloseReasonEOF {
+		t.Errorf("Unexpected closed event: %s, %s, %s", e.Get("connection-id"), e.Get("service"), e.Get("close-reason"))
+	}
+}
@@ -0,0 +1,86 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"sync"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// enrichment adds the fields of the configured enrichers to the events sent by
+// the services, directors and listener, before they are delivered to the
+// subscribers of the bus. It is the single subscriber of the events bus, every
+// event is enriched once.
+type enrichment struct {
+	m         sync.RWMutex
+	enrichers enricher.Pipeline
+
+	channel pushers.Channel
+}
+
+// Send enriches the event and delivers it to the channel.
+func (en *enrichment) Send(e event.Event) {
+	en.m.RLock()
+	en.enrichers.Enrich(e)
+	en.m.RUnlock()
+
+	en.channel.Send(e)
+}
+
+// replace swaps the enrichers, it returns after the event being enriched
+// with the previous enrichers has been enriched, so they can be closed.
+func (en *enrichment) replace(enrichers enricher.Pipeline) {
+	en.m.Lock()
+	defer en.m.Unlock()
+
+	en.enrichers = enrichers
+}
+
+// closeEnrichers closes the enrichers, except those being kept.
+func closeEnrichers(enrichers, keep []enricher.Enricher) {
+	for _, en := range enrichers {
+		kept := false
+		for _, k := range keep {
+			kept = kept || k == en
+		}
+
+		if kept {
+			continue
+		}
+
+		if err := enricher.Close(en); err != nil {
+			log.Errorf("Error closing enricher: %s", err.Error())
+		}
+	}
+}
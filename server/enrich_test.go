@@ -0,0 +1,148 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type captureChannel chan event.Event
+
+func (cc captureChannel) Send(e event.Event) {
+	cc <- e
+}
+
+func TestEnrichment(t *testing.T) {
+	hc, _ := New()
+
+	conf := &config.Config{}
+	if err := conf.Decode(bytes.NewBufferString(`
+[[enrich]]
+type="sensor"
+name="sensor-1"
+tags=["dmz"]
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := hc.newState(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc.enrichment.replace(st.enrichers)
+
+	cc := make(captureChannel, 1)
+	hc.bus.Subscribe(cc)
+
+	hc.events.Send(event.New(event.Category("test")))
+
+	select {
+	case e := <-cc:
+		if got := e.Get("sensor-name"); got != "sensor-1" {
+			t.Errorf("Expected sensor-name sensor-1, got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event not delivered")
+	}
+}
+
+func TestEnrichmentReuse(t *testing.T) {
+	hc, _ := New()
+
+	decode := func(s string) *config.Config {
+		conf := &config.Config{}
+		if err := conf.Decode(bytes.NewBufferString(s)); err != nil {
+			t.Fatal(err)
+		}
+
+		return conf
+	}
+
+	// the first section fails, the others are reused by section
+	prev, err := hc.newState(decode(`
+[[enrich]]
+type="unknown"
+
+[[enrich]]
+type="sensor"
+name="sensor-1"
+
+[[enrich]]
+type="sensor"
+name="sensor-2"
+`), nil)
+	if err == nil {
+		t.Fatal("Expected error for unknown enricher")
+	}
+
+	st, err := hc.newState(decode(`
+[[enrich]]
+type="sensor"
+name="sensor-0"
+
+[[enrich]]
+type="sensor"
+name="sensor-1"
+
+[[enrich]]
+type="sensor"
+name="sensor-2"
+`), prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(st.enrichers) != 3 || st.enrichers[1] != prev.enrichers[0] || st.enrichers[2] != prev.enrichers[1] {
+		t.Errorf("Expected the enrichers of unchanged sections to be reused")
+	}
+}
+
+func TestEnrichmentUnknownType(t *testing.T) {
+	hc, _ := New()
+
+	conf := &config.Config{}
+	if err := conf.Decode(bytes.NewBufferString(`
+[[enrich]]
+type="unknown"
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hc.newState(conf, nil); err == nil {
+		t.Error("Expected error for unknown enricher")
+	}
+}
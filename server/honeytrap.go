@@ -38,6 +38,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mattn/go-isatty"
@@ -46,7 +47,10 @@ import (
 
 	"github.com/honeytrap/honeytrap/cmd"
 	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/correlation"
+	"github.com/honeytrap/honeytrap/metrics"
 	"github.com/honeytrap/honeytrap/web"
+	"github.com/honeytrap/honeytrap/web/api"
 
 	"github.com/honeytrap/honeytrap/director"
 	_ "github.com/honeytrap/honeytrap/director/forward"
@@ -57,6 +61,10 @@ import (
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
 
+	_ "github.com/honeytrap/honeytrap/enricher/geoip"
+	_ "github.com/honeytrap/honeytrap/enricher/rdns"
+	_ "github.com/honeytrap/honeytrap/enricher/sensor"
+
 	"github.com/honeytrap/honeytrap/services"
 	_ "github.com/honeytrap/honeytrap/services/elasticsearch"
 	_ "github.com/honeytrap/honeytrap/services/eos"
@@ -90,11 +98,16 @@ import (
 	_ "github.com/honeytrap/honeytrap/pushers/file"
 	_ "github.com/honeytrap/honeytrap/pushers/kafka"
 	_ "github.com/honeytrap/honeytrap/pushers/marija"
+	_ "github.com/honeytrap/honeytrap/pushers/mqtt"
+	_ "github.com/honeytrap/honeytrap/pushers/nats"
 	_ "github.com/honeytrap/honeytrap/pushers/pulsar"
 	_ "github.com/honeytrap/honeytrap/pushers/rabbitmq"
 	_ "github.com/honeytrap/honeytrap/pushers/raven"
 	_ "github.com/honeytrap/honeytrap/pushers/slack"
 	_ "github.com/honeytrap/honeytrap/pushers/splunk"
+	_ "github.com/honeytrap/honeytrap/pushers/sqlite"
+	_ "github.com/honeytrap/honeytrap/pushers/syslog"
+	_ "github.com/honeytrap/honeytrap/pushers/webhook"
 
 	"github.com/op/go-logging"
 )
@@ -111,15 +124,45 @@ type Honeytrap struct {
 	// TODO(nl5887): rename to bus, should we encapsulate this?
 	bus *eventbus.EventBus
 
+	// events receives the events of the services, directors and listener,
+	// which will be enriched before being sent to the bus
+	events     *eventbus.EventBus
+	enrichment *enrichment
+
 	director director.Director
 
 	token string
 
 	dataDir string
 
-	// Maps a port and a protocol to an array of pointers to services
-	tcpPorts map[int][]*ServiceMap
-	udpPorts map[int][]*ServiceMap
+	// checking is set while checking the configuration, spools won't be
+	// opened as these may be in use
+	checking bool
+
+	// configSource returns the configuration data, used when reloading
+	configSource func() ([]byte, error)
+
+	listener listener.Listener
+
+	// m protects st, which will be replaced when reloading
+	m  sync.RWMutex
+	st *state
+
+	reloadLock sync.Mutex
+
+	// wg tracks the connections being handled, conns contains them
+	wg    sync.WaitGroup
+	conns sync.Map
+
+	// admission enforces the connection limits
+	admission *admission
+
+	api *api.API
+
+	// correlator keeps the profiles of the sources, it is subscribed to the
+	// bus through correlation
+	correlator  *correlation.Correlator
+	correlation pushers.Channel
 }
 
 // New returns a new instance of a Honeytrap struct.
@@ -127,14 +170,24 @@ type Honeytrap struct {
 func New(options ...OptionFn) (*Honeytrap, error) {
 	bus := eventbus.New()
 
+	en := &enrichment{
+		channel: bus,
+	}
+
+	events := eventbus.New()
+	events.Subscribe(eventbus.WithQueue("enrichment", en, 0, eventbus.Block))
+
 	// Initialize all channels within the provided config.
 	conf := &config.Default
 
 	h := &Honeytrap{
-		config:   conf,
-		director: director.MustDummy(),
-		bus:      bus,
-		profiler: profiler.Dummy(),
+		config:     conf,
+		director:   director.MustDummy(),
+		bus:        bus,
+		events:     events,
+		enrichment: en,
+		profiler:   profiler.Dummy(),
+		admission:  newAdmission(),
 	}
 
 	for _, fn := range options {
@@ -176,76 +229,144 @@ var (
 	ErrNoServicesGivenPort = fmt.Errorf("no services for the given ports")
 )
 
+// Reasons why a service has been selected for a connection.
+const (
+	MatchOnlyCandidate = "only-candidate"
+	MatchNoCanHandle   = "no-can-handle"
+	MatchCanHandle     = "can-handle"
+	MatchSilent        = "default-silent"
+	MatchNoMatch       = "default-no-match"
+)
+
+var (
+	defaultPeekTimeout = 30 * time.Second
+	defaultPeekSize    = 1024
+)
+
+// selection describes which service has been selected for a connection, and why.
+type selection struct {
+	Service *ServiceMap
+	Conn    net.Conn
+
+	Binding *binding
+	Reason  string
+
+	// number of bytes peeked
+	Peeked int
+}
+
 /* Finds a service that can handle the given connection.
  * The service is picked (among those configured for the given port) as follows:
  *
+ *     Ports bound to an ip address or network take priority over port-only definitions,
+ *     exact port definitions take priority over port ranges (eg. tcp/8000-8100 or tcp/any)
  *     If there are no services for the given port, return an error
  *     If there is only one service, pick it
  *     For each service (as sorted in the config file):
  *         - If it does not implement CanHandle, pick it
  *         - If it implements CanHandle, peek the connection and pass the peeked
  *           data to CanHandle. If it returns true, pick it
+ *     If the client didn't send any data within the peek timeout, or no service
+ *     can handle the data, pick the default service of the port if configured
  */
-func (hc *Honeytrap) findService(conn net.Conn) (*ServiceMap, net.Conn, error) {
-	localAddr := conn.LocalAddr()
-	var port int
-	var serviceCandidates []*ServiceMap
-	// Todo(capacitorset): implement port "any"?
-	switch a := localAddr.(type) {
+func (hc *Honeytrap) findService(conn net.Conn) (*selection, error) {
+	st := hc.currentState()
+
+	var b *binding
+
+	switch a := conn.LocalAddr().(type) {
 	case *net.TCPAddr:
-		port = a.Port
-		tmp, ok := hc.tcpPorts[port]
+		tmp, ok := st.tcp.find(a.IP, a.Port)
 		if !ok {
-			return nil, nil, ErrNoServicesGivenPort
+			return nil, ErrNoServicesGivenPort
 		}
-		serviceCandidates = tmp // prevent variable shadowing and "unused variable" error
+		b = tmp // prevent variable shadowing and "unused variable" error
 	case *net.UDPAddr:
-		port = a.Port
-		tmp, ok := hc.udpPorts[port]
+		tmp, ok := st.udp.find(a.IP, a.Port)
 		if !ok {
-			return nil, nil, ErrNoServicesGivenPort
+			return nil, ErrNoServicesGivenPort
 		}
-		serviceCandidates = tmp
+		b = tmp
 	default:
-		return nil, nil, fmt.Errorf("unknown address type %T", a)
+		return nil, fmt.Errorf("unknown address type %T", a)
+	}
+
+	sel := &selection{
+		Binding: b,
 	}
 
+	serviceCandidates := b.services
+
 	if len(serviceCandidates) == 1 {
-		return serviceCandidates[0], conn, nil
+		sel.Service, sel.Conn, sel.Reason = serviceCandidates[0], conn, MatchOnlyCandidate
+		return sel, nil
+	}
+
+	peekTimeout := defaultPeekTimeout
+	if b.peekTimeout != 0 {
+		peekTimeout = b.peekTimeout
+	}
+
+	peekSize := defaultPeekSize
+	if b.peekSize != 0 {
+		peekSize = b.peekSize
 	}
 
 	peekUninitialized := true
-	var tConn net.Conn
+	var tConn *timeoutConn
 	var pConn *peekConnection
 	var n int
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, peekSize)
 	for _, service := range serviceCandidates {
 		ch, ok := service.Service.(services.CanHandlerer)
 		if !ok {
 			// Service does not implement CanHandle, assume it can handle the connection
-			return service, conn, nil
+			sel.Service, sel.Reason = service, MatchNoCanHandle
+
+			sel.Conn = conn
+			if pConn != nil {
+				sel.Conn = pConn
+			}
+
+			return sel, nil
 		}
 		// Service implements CanHandle, initialize it if needed and run the checks
 		if peekUninitialized {
-			// wrap connection in a connection with deadlines
-			tConn = TimeoutConn(conn, time.Second*30)
+			// wrap connection in a connection with deadlines, the first
+			// read will use the peek timeout
+			tConn = &timeoutConn{conn, peekTimeout, time.Second * 30}
 			pConn = PeekConnection(tConn)
 			log.Debug("Peeking connection %s => %s", conn.RemoteAddr(), conn.LocalAddr())
 			_n, err := pConn.Peek(buffer)
 			n = _n // avoid silly "variable not used" warning
-			if err != nil {
-				return nil, nil, fmt.Errorf("could not peek bytes: %s", err.Error())
+
+			tConn.ReadTimeout = time.Second * 30
+
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && n == 0 && b.defaultService != nil {
+				// the client stays silent, it probably expects the server to speak first
+				sel.Service, sel.Conn, sel.Reason = b.defaultService, pConn, MatchSilent
+				return sel, nil
+			} else if err != nil {
+				return sel, fmt.Errorf("could not peek bytes: %s", err.Error())
 			}
 			peekUninitialized = false
+			sel.Peeked = n
 		}
 		if ch.CanHandle(buffer[:n]) {
 			// Service supports payload
-			return service, pConn, nil
+			sel.Service, sel.Conn, sel.Reason = service, pConn, MatchCanHandle
+			return sel, nil
 		}
 	}
+
+	if b.defaultService != nil {
+		sel.Service, sel.Conn, sel.Reason = b.defaultService, pConn, MatchNoMatch
+		return sel, nil
+	}
+
 	// There are some services for that port, but non can handle the connection.
 	// Let the caller deal with it.
-	return nil, nil, fmt.Errorf("No suitable service for the given port")
+	return sel, fmt.Errorf("No suitable service for the given port")
 }
 
 func (hc *Honeytrap) heartbeat() {
@@ -254,7 +375,7 @@ func (hc *Honeytrap) heartbeat() {
 	count := 0
 
 	for range beat {
-		hc.bus.Send(event.New(
+		hc.events.Send(event.New(
 			event.Sensor("honeytrap"),
 			event.Category("heartbeat"),
 			event.SeverityInfo,
@@ -340,292 +461,84 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 
 	w.Start()
 
-	channels := map[string]pushers.Channel{}
-	isChannelUsed := make(map[string]bool)
-	// sane defaults!
-
-	for key, s := range hc.config.Channels {
-		x := struct {
-			Type string `toml:"type"`
-		}{}
-
-		err := hc.config.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of channel: %s", err.Error())
-			continue
-		}
-
-		if x.Type == "" {
-			log.Error("Error parsing configuration of channel %s: type not set", key)
-			continue
-		}
+	metrics.Register(metrics.CollectorFunc(hc.channelMetrics))
 
-		if channelFunc, ok := pushers.Get(x.Type); !ok {
-			log.Error("Channel %s not supported on platform (%s)", x.Type, key)
-		} else if d, err := channelFunc(
-			pushers.WithConfig(s),
-		); err != nil {
-			log.Fatalf("Error initializing channel %s(%s): %s", key, x.Type, err)
-		} else {
-			channels[key] = d
-			isChannelUsed[key] = false
-		}
+	correlator, err := hc.newCorrelator()
+	if err != nil {
+		log.Error("Error parsing configuration of correlation: %s", err.Error())
+	} else if correlator.Enabled {
+		hc.correlator = correlator
+		hc.correlation = eventbus.WithQueue("correlation", correlator, 0, eventbus.DropNewest)
+		hc.bus.Subscribe(hc.correlation)
+	} else {
+		correlator.Close()
 	}
 
-	for _, s := range hc.config.Filters {
-		x := struct {
-			Channels   []string `toml:"channel"`
-			Services   []string `toml:"services"`
-			Categories []string `toml:"categories"`
-		}{}
-
-		err := hc.config.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of filter: %s", err.Error())
-			continue
-		}
-
-		for _, name := range x.Channels {
-			channel, ok := channels[name]
-			if !ok {
-				log.Error("Could not find channel %s for filter", name)
-				continue
-			}
-
-			isChannelUsed[name] = true
-			channel = pushers.TokenChannel(channel, hc.token)
-
-			if len(x.Categories) != 0 {
-				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("category", x.Categories))
-			}
-
-			if len(x.Services) != 0 {
-				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("service", x.Services))
-			}
-
-			if err := hc.bus.Subscribe(channel); err != nil {
-				log.Error("Could not add channel %s to bus: %s", name, err.Error())
-			}
-		}
+	apiOptions := []func(*api.API) error{
+		api.WithSensor(&adminSensor{hc}),
+		api.WithConfig(hc.config.API),
 	}
 
-	for name, isUsed := range isChannelUsed {
-		if !isUsed {
-			log.Warningf("Channel %s is unused. Did you forget to add a filter?", name)
-		}
+	if hc.correlator != nil {
+		apiOptions = append(apiOptions, api.WithProfiles(hc.correlator))
 	}
 
-	// initialize directors
-	directors := map[string]director.Director{}
-	availableDirectorNames := director.GetAvailableDirectorNames()
+	a, err := api.New(apiOptions...)
+	if err != nil {
+		log.Error("Error parsing configuration of api: %s", err.Error())
+	} else if err := a.Start(); err != nil {
+		log.Error("Error starting api: %s", err.Error())
+	} else if a.Enabled {
+		hc.bus.Subscribe(a)
+		hc.api = a
+	}
 
-	for key, s := range hc.config.Directors {
-		x := struct {
-			Type string `toml:"type"`
-		}{}
+	st, err := hc.newState(hc.config, nil)
+	if errs, ok := err.(configErrors); ok {
+		fatal := false
 
-		err := hc.config.PrimitiveDecode(s, &x)
-		if err != nil {
-			log.Error("Error parsing configuration of director: %s", err.Error())
-			continue
-		}
+		for _, err := range errs {
+			log.Error(color.RedString(err.Error()))
 
-		if x.Type == "" {
-			log.Error("Error parsing configuration of service %s: type not set", key)
-			continue
+			if se, ok := err.(*sectionError); ok && se.fatal {
+				fatal = true
+			}
 		}
 
-		if directorFunc, ok := director.Get(x.Type); !ok {
-			log.Error("Director type=%s not supported on platform (director=%s). Available directors: %s", x.Type, key, strings.Join(availableDirectorNames, ", "))
-		} else if d, err := directorFunc(
-			director.WithChannel(hc.bus),
-			director.WithConfig(s),
-		); err != nil {
-			log.Fatalf("Error initializing director %s(%s): %s", key, x.Type, err)
-		} else {
-			directors[key] = d
+		if fatal {
+			log.Fatal("Error initializing configuration")
 		}
+	} else if err != nil {
+		log.Fatal(err.Error())
 	}
 
 	// initialize listener
-	x := struct {
-		Type string `toml:"type"`
-	}{}
-
-	if err := hc.config.PrimitiveDecode(hc.config.Listener, &x); err != nil {
-		log.Error("Error parsing configuration of listener: %s", err.Error())
+	l, err := hc.newListener(hc.config)
+	if err != nil {
+		fmt.Println(color.RedString(err.Error()))
 		return
 	}
 
-	if x.Type == "" {
-		fmt.Println(color.RedString("Listener not set"))
-	}
-
-	var enabledDirectorNames []string
-	for key := range directors {
-		enabledDirectorNames = append(enabledDirectorNames, key)
-	}
-
-	serviceList := make(map[string]*ServiceMap)
-	isServiceUsed := make(map[string]bool) // Used to check that every service is used by a port
-	// same for proxies
-	for key, s := range hc.config.Services {
-		x := struct {
-			Type     string `toml:"type"`
-			Director string `toml:"director"`
-			Port     string `toml:"port"`
-		}{}
-
-		if err := hc.config.PrimitiveDecode(s, &x); err != nil {
-			log.Error("Error parsing configuration of service %s: %s", key, err.Error())
-			continue
-		}
-
-		if x.Port != "" {
-			log.Error("Ports in services are deprecated, add services to ports instead")
-			continue
-		}
-
-		// individual configuration per service
-		options := []services.ServicerFunc{
-			services.WithChannel(hc.bus),
-			services.WithConfig(s, hc.config),
-		}
+	hc.listener = l
 
-		if x.Director == "" {
-		} else if d, ok := directors[x.Director]; ok {
-			options = append(options, services.WithDirector(d))
-		} else {
-			log.Error(color.RedString("Could not find director=%s for service=%s. Enabled directors: %s", x.Director, key, strings.Join(enabledDirectorNames, ", ")))
-			continue
-		}
-
-		fn, ok := services.Get(x.Type)
+	for _, addr := range st.addresses {
+		a, ok := l.(listener.AddAddresser)
 		if !ok {
-			log.Error(color.RedString("Could not find type %s for service %s", x.Type, key))
+			log.Error("Listener error")
 			continue
 		}
-
-		service := fn(options...)
-		serviceList[key] = &ServiceMap{
-			Service: service,
-			Name:    key,
-			Type:    x.Type,
-		}
-		isServiceUsed[key] = false
-		log.Infof("Configured service %s (%s)", x.Type, key)
-	}
-
-	listenerFunc, ok := listener.Get(x.Type)
-	if !ok {
-		fmt.Println(color.RedString("Listener %s not support on platform", x.Type))
-		return
-	}
-
-	l, err := listenerFunc(
-		listener.WithChannel(hc.bus),
-		listener.WithConfig(hc.config.Listener),
-	)
-	if err != nil {
-		log.Fatalf("Error initializing listener %s: %s", x.Type, err)
+		a.AddAddress(addr)
 	}
 
-	hc.tcpPorts = make(map[int][]*ServiceMap)
-	hc.udpPorts = make(map[int][]*ServiceMap)
-	for _, s := range hc.config.Ports {
-		x := struct {
-			Port     string   `toml:"port"`
-			Ports    []string `toml:"ports"`
-			Services []string `toml:"services"`
-		}{}
-
-		if err := hc.config.PrimitiveDecode(s, &x); err != nil {
-			log.Error("Error parsing configuration of generic ports: %s", err.Error())
-			continue
-		}
-
-		var ports []string
-		if x.Ports != nil {
-			ports = x.Ports
-		}
-		if x.Port != "" {
-			ports = append(ports, x.Port)
-		}
-		if x.Port != "" && x.Ports != nil {
-			log.Warning("Both \"port\" and \"ports\" were defined, this can be confusing")
-		} else if x.Port == "" && x.Ports == nil {
-			log.Error("Neither \"port\" nor \"ports\" were defined")
-			continue
-		}
-
-		if len(x.Services) == 0 {
-			log.Warning("No services defined for port(s) " + strings.Join(ports, ", "))
-		}
-
-		for _, portStr := range ports {
-			addr, proto, port, err := ToAddr(portStr)
-			if err != nil {
-				log.Error("Error parsing port string: %s", err.Error())
-				continue
-			}
-			if addr == nil {
-				log.Error("Failed to bind: addr is nil")
-				continue
-			}
-
-			// Get the services from their names
-			var servicePtrs []*ServiceMap
-			for _, serviceName := range x.Services {
-				ptr, ok := serviceList[serviceName]
-				if !ok {
-					log.Error("Unknown service '%s' for port %s", serviceName, portStr)
-					continue
-				}
-				servicePtrs = append(servicePtrs, ptr)
-				isServiceUsed[serviceName] = true
-			}
-			if len(servicePtrs) == 0 {
-				log.Errorf("Port %s has no valid services, it won't be listened on", portStr)
-				continue
-			}
-			switch proto {
-			case "tcp":
-				if _, ok := hc.tcpPorts[port]; ok {
-					log.Error("Port tcp/%d was already defined, ignoring the newer definition", port)
-					continue
-				}
-				hc.tcpPorts[port] = servicePtrs
-			case "udp":
-				if _, ok := hc.udpPorts[port]; ok {
-					log.Error("Port udp/%d was already defined, ignoring the newer definition", port)
-					continue
-				}
-				hc.udpPorts[port] = servicePtrs
-			default:
-				log.Errorf("Unknown protocol %s", proto)
-				continue
-			}
-
-			a, ok := l.(listener.AddAddresser)
-			if !ok {
-				log.Error("Listener error")
-				continue
-			}
-			a.AddAddress(addr)
-
-			log.Infof("Configured port %s/%s", addr.Network(), addr.String())
+	for _, channel := range st.subscribers {
+		if err := hc.bus.Subscribe(channel); err != nil {
+			log.Error("Could not add channel to bus: %s", err.Error())
 		}
 	}
 
-	for name, isUsed := range isServiceUsed {
-		if !isUsed {
-			log.Warningf("Service %s is defined but not used", name)
-		}
-	}
+	hc.enrichment.replace(st.enrichers)
 
-	if len(hc.config.Undecoded()) != 0 {
-		log.Warningf("Unrecognized keys in configuration: %v", hc.config.Undecoded())
-	}
+	hc.setState(st)
 
 	if err := l.Start(ctx); err != nil {
 		fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
@@ -650,7 +563,8 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case conn := <-incoming:
-			go hc.handle(conn)
+			hc.wg.Add(1)
+			go hc.handle(ctx, conn)
 		}
 	}
 }
@@ -685,7 +599,26 @@ func (c *timeoutConn) Write(b []byte) (int, error) {
 	return c.Conn.Write(b)
 }
 
-func (hc *Honeytrap) handle(conn net.Conn) {
+func (hc *Honeytrap) handle(ctx context.Context, conn net.Conn) {
+	defer hc.wg.Done()
+
+	if st := hc.currentState(); st != nil && st.limits != nil {
+		release, rej := hc.admission.admit(st.limits, conn)
+		if rej != nil {
+			connectionsRejected.With(portLabel(st, conn), rej.limit).Inc()
+
+			hc.reject(ctx, conn, st.limits, rej)
+			return
+		}
+
+		defer release()
+	}
+
+	c := newConnection(conn)
+
+	hc.conns.Store(c.ID, c)
+	defer hc.conns.Delete(c.ID)
+
 	defer func() {
 		if err := recover(); err != nil {
 			trace := make([]byte, 1024)
@@ -698,18 +631,34 @@ func (hc *Honeytrap) handle(conn net.Conn) {
 
 	defer conn.Close()
 
+	reason := ""
+	connOptions := c.Options()
+
+	selectOptions := event.NewWith()
+
+	defer func() {
+		if reason == "" {
+			reason = c.closeReason(ctx)
+		}
+
+		hc.events.Send(eventConnectionClosed(c, reason, connOptions))
+	}()
+
 	defer func() {
 		if r := recover(); r != nil {
+			reason = CloseReasonPanic
+
 			message := event.Message("%+v", r)
 			if err, ok := r.(error); ok {
 				message = event.Message("%+v", err)
 			}
 
-			hc.bus.Send(event.New(
+			hc.events.Send(event.New(
 				event.SeverityFatal,
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
 				event.Stack(),
+				connOptions,
 				message,
 			))
 		}
@@ -718,26 +667,222 @@ func (hc *Honeytrap) handle(conn net.Conn) {
 	log.Debug("Accepted connection for %s => %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer log.Debug("Disconnected connection for %s => %s", conn.RemoteAddr(), conn.LocalAddr())
 
-	/* conn is the original connection. newConn can be either the same
+	/* c is the original connection, counting bytes. newConn can be either the same
 	 * connection, or a wrapper in the form of a PeekConnection.
 	 */
-	sm, newConn, err := hc.findService(conn)
-	if sm == nil {
+	sel, err := hc.findService(c)
+
+	if sel != nil {
+		candidates := []string{}
+		for _, sm := range sel.Binding.services {
+			candidates = append(candidates, sm.Name)
+		}
+
+		// report which binding matched within the events of the service
+		connOptions = event.NewWith(
+			connOptions,
+			event.Custom("binding", sel.Binding.String()),
+		)
+
+		selectOptions = event.NewWith(
+			event.Custom("service-candidates", candidates),
+			event.Custom("service-match", sel.Reason),
+			event.Custom("peek-length", sel.Peeked),
+		)
+	}
+
+	if err != nil {
 		log.Debug("No suitable handler for %s => %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err.Error())
+
+		peekOutcomes.With(CloseReasonNoService).Inc()
+		connectionsRejected.With(portLabel(hc.currentState(), conn), CloseReasonNoService).Inc()
+
+		reason = CloseReasonNoService
+		hc.events.Send(eventConnectionOpened(c, connOptions, selectOptions))
 		return
 	}
 
+	sm := sel.Service
+	c.setService(sm)
+
+	peekOutcomes.With(sel.Reason).Inc()
+	connectionsAccepted.With(sel.Binding.String(), sm.Name).Inc()
+
+	activeSessions.With(sm.Name).Inc()
+	defer activeSessions.With(sm.Name).Dec()
+
+	opened := eventConnectionOpened(c, connOptions, c.Options(), selectOptions)
+
+	// services will include the connection id, binding and service within
+	// their events, which are derived from the connection opened event
+	ec := event.WithConn(sel.Conn, connOptions, c.Options(), event.ChildOf(opened))
+	connOptions = ec.Options()
+
+	hc.events.Send(opened)
+
 	log.Debug("Handling connection for %s => %s %s(%s)", conn.RemoteAddr(), conn.LocalAddr(), sm.Name, sm.Type)
 
-	ctx := context.Background()
-	if err := sm.Service.Handle(ctx, newConn); err != nil {
+	if err := sm.Service.Handle(ctx, ec); err != nil {
 		log.Errorf(color.RedString("Error handling service: %s: %s", sm.Name, err.Error()))
 	}
 }
 
-// Stop will stop Honeytrap
+var defaultDrainTimeout = 10 * time.Second
+
+func drainTimeout(conf *config.Config) time.Duration {
+	if conf.DrainTimeout == 0 {
+		return defaultDrainTimeout
+	}
+
+	return conf.DrainTimeout.Duration()
+}
+
+// listenerType returns the type of the configured listener.
+func listenerType(conf *config.Config) (string, error) {
+	x := struct {
+		Type string `toml:"type"`
+	}{}
+
+	if err := conf.PrimitiveDecode(conf.Listener, &x); err != nil {
+		return "", fmt.Errorf("Error parsing configuration of listener: %s", err.Error())
+	}
+
+	if x.Type == "" {
+		return "", fmt.Errorf("Listener not set")
+	}
+
+	return x.Type, nil
+}
+
+// newListener initializes the configured listener, it won't listen until
+// addresses have been added and it has been started.
+func (hc *Honeytrap) newListener(conf *config.Config) (listener.Listener, error) {
+	t, err := listenerType(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	listenerFunc, ok := listener.Get(t)
+	if !ok {
+		return nil, fmt.Errorf("Listener %s not supported on platform", t)
+	}
+
+	l, err := listenerFunc(
+		listener.WithChannel(hc.events),
+		listener.WithConfig(conf.Listener),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing listener %s: %s", t, err)
+	}
+
+	return l, nil
+}
+
+// Stop will stop Honeytrap. Active connections get the drain timeout to finish,
+// after which they will be closed. Events queued in the channels will be
+// delivered before returning.
 func (hc *Honeytrap) Stop() {
+	st := hc.currentState()
+
+	timeout := drainTimeout(hc.config)
+	if st != nil {
+		timeout = drainTimeout(st.config)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		hc.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Warningf("Drain timeout expired, closing active connections")
+
+		hc.conns.Range(func(key, value interface{}) bool {
+			value.(*connection).Close()
+			return true
+		})
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			log.Errorf("Services didn't finish after closing connections")
+		}
+	}
+
+	if st != nil {
+		// deliver the events queued within the bus, before shutting down the channels
+		done := make(chan struct{})
+		go func() {
+			hc.events.Close()
+			hc.bus.Replace(st.subscribers, nil)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			log.Errorf("Event bus didn't deliver queued events before drain timeout")
+		}
+
+		closeAggregates(st.aggregates)
+		shutdownChannels(st.channels, timeout)
+		closeEnrichers(st.enrichers, nil)
+	}
+
+	if hc.correlator != nil {
+		hc.bus.Unsubscribe(hc.correlation)
+
+		if err := hc.correlator.Close(); err != nil {
+			log.Errorf("Error persisting profiles: %s", err.Error())
+		}
+	}
+
+	if hc.api != nil {
+		hc.api.Close()
+	}
+
 	hc.profiler.Stop()
 
 	fmt.Println(color.YellowString("Honeytrap stopped."))
 }
+
+// closeAggregates delivers the summaries of the aggregated events.
+func closeAggregates(channels []pushers.Channel) {
+	for _, channel := range channels {
+		if err := pushers.Shutdown(channel); err != nil {
+			log.Errorf("Error delivering aggregated events: %s", err.Error())
+		}
+	}
+}
+
+// shutdownChannels flushes and closes the channels, waiting at most timeout.
+func shutdownChannels(channels map[string]pushers.Channel, timeout time.Duration) {
+	var wg sync.WaitGroup
+
+	for name, channel := range channels {
+		wg.Add(1)
+
+		go func(name string, channel pushers.Channel) {
+			defer wg.Done()
+
+			if err := pushers.Shutdown(channel); err != nil {
+				log.Errorf("Error shutting down channel %s: %s", name, err.Error())
+			}
+		}(name, channel)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Errorf("Timeout expired while delivering queued events")
+	}
+}
@@ -1,7 +1,12 @@
 package server
 
 import (
+	"context"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/pushers"
 )
 
 func TestBigPortToAddr(t *testing.T) {
@@ -35,3 +40,94 @@ func TestUnknownProtoToAddr(t *testing.T) {
 		t.Errorf("No error thrown with incorrect protocol")
 	}
 }
+
+type peekService struct {
+	prefix string
+}
+
+func (s *peekService) CanHandle(payload []byte) bool {
+	return string(payload) == s.prefix
+}
+
+func (s *peekService) Handle(ctx context.Context, conn net.Conn) error {
+	return nil
+}
+
+func (s *peekService) SetChannel(pushers.Channel) {
+}
+
+func findServiceTest(t *testing.T, payload []byte) *selection {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	hc, _ := New()
+
+	get := &ServiceMap{Name: "http", Service: &peekService{"GET"}}
+	ssh := &ServiceMap{Name: "ssh", Service: &peekService{"SSH"}}
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	st := &state{
+		tcp: newRoutes(),
+		udp: newRoutes(),
+	}
+
+	st.tcp.add(&binding{
+		PortRange:      PortRange{Proto: "tcp", From: port, To: port},
+		services:       []*ServiceMap{get, ssh},
+		peekTimeout:    100 * time.Millisecond,
+		defaultService: ssh,
+	})
+
+	hc.setState(st)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	if payload != nil {
+		client.Write(payload)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	sel, err := hc.findService(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sel
+}
+
+func TestFindServicePeek(t *testing.T) {
+	sel := findServiceTest(t, []byte("GET"))
+	if sel.Service.Name != "http" || sel.Reason != MatchCanHandle {
+		t.Errorf("Expected http (%s), got %s (%s)", MatchCanHandle, sel.Service.Name, sel.Reason)
+	}
+}
+
+func TestFindServiceSilent(t *testing.T) {
+	sel := findServiceTest(t, nil)
+	if sel.Service.Name != "ssh" || sel.Reason != MatchSilent {
+		t.Errorf("Expected ssh (%s), got %s (%s)", MatchSilent, sel.Service.Name, sel.Reason)
+	}
+}
+
+func TestFindServiceNoMatch(t *testing.T) {
+	sel := findServiceTest(t, []byte("FOO"))
+	if sel.Service.Name != "ssh" || sel.Reason != MatchNoMatch {
+		t.Errorf("Expected ssh (%s), got %s (%s)", MatchNoMatch, sel.Service.Name, sel.Reason)
+	}
+}
@@ -0,0 +1,424 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Actions taken when a connection is rejected by one of the limits.
+const (
+	ActionDrop   = "drop"
+	ActionReset  = "rst"
+	ActionTarpit = "tarpit"
+)
+
+// Names of the limits, reported in the throttled event.
+const (
+	LimitGlobal = "global"
+	LimitSource = "source"
+	LimitPort   = "port"
+	LimitRate   = "rate"
+)
+
+var (
+	defaultTarpitTimeout     = 60 * time.Second
+	defaultTarpitConnections = 128
+	defaultEventInterval     = 10 * time.Second
+)
+
+// limit defines the maximum number of concurrent connections and the
+// action to take when exceeded, zero means unlimited.
+type limit struct {
+	max    int
+	action string
+}
+
+// limits contains the admission limits, as configured in the [limits] section.
+type limits struct {
+	global limit
+	source limit
+	port   limit
+
+	// rate and burst define the new connections per second per source
+	rate       rate.Limit
+	burst      int
+	rateAction string
+
+	// sources are aggregated using the masks
+	ipv4Mask net.IPMask
+	ipv6Mask net.IPMask
+
+	tarpitTimeout     time.Duration
+	tarpitConnections int
+
+	eventInterval time.Duration
+}
+
+// sourceKey returns the (aggregated) source the ip is accounted to.
+func (l *limits) sourceKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(l.ipv4Mask).String()
+	}
+
+	return ip.Mask(l.ipv6Mask).String()
+}
+
+func parseAction(name, action string) (string, error) {
+	switch action {
+	case "":
+		return ActionDrop, nil
+	case ActionDrop, ActionReset, ActionTarpit:
+		return action, nil
+	default:
+		return "", fmt.Errorf("Unknown action %s for %s limit, expected %s, %s or %s", action, name, ActionDrop, ActionReset, ActionTarpit)
+	}
+}
+
+// parseLimits parses the limits section of the configuration.
+func parseLimits(conf *config.Config) (*limits, error) {
+	type limitConfig struct {
+		MaxConnections int    `toml:"max-connections"`
+		Action         string `toml:"action"`
+	}
+
+	x := struct {
+		TarpitTimeout     config.Delay `toml:"tarpit-timeout"`
+		TarpitConnections int          `toml:"tarpit-connections"`
+		EventInterval     config.Delay `toml:"event-interval"`
+
+		Global limitConfig `toml:"global"`
+		Port   limitConfig `toml:"port"`
+
+		Source struct {
+			MaxConnections int    `toml:"max-connections"`
+			Action         string `toml:"action"`
+			IPv4Mask       int    `toml:"ipv4-mask"`
+			IPv6Mask       int    `toml:"ipv6-mask"`
+		} `toml:"source"`
+
+		Rate struct {
+			Connections float64 `toml:"connections"`
+			Burst       int     `toml:"burst"`
+			Action      string  `toml:"action"`
+		} `toml:"rate"`
+	}{
+		TarpitTimeout:     config.Delay(defaultTarpitTimeout),
+		TarpitConnections: defaultTarpitConnections,
+		EventInterval:     config.Delay(defaultEventInterval),
+	}
+
+	x.Source.IPv4Mask = 32
+	x.Source.IPv6Mask = 128
+
+	if err := conf.PrimitiveDecode(conf.Limits, &x); err != nil {
+		return nil, fmt.Errorf("Error parsing configuration of limits: %s", err.Error())
+	}
+
+	l := &limits{
+		global: limit{max: x.Global.MaxConnections},
+		source: limit{max: x.Source.MaxConnections},
+		port:   limit{max: x.Port.MaxConnections},
+
+		rate:  rate.Limit(x.Rate.Connections),
+		burst: x.Rate.Burst,
+
+		ipv4Mask: net.CIDRMask(x.Source.IPv4Mask, 32),
+		ipv6Mask: net.CIDRMask(x.Source.IPv6Mask, 128),
+
+		tarpitTimeout:     x.TarpitTimeout.Duration(),
+		tarpitConnections: x.TarpitConnections,
+		eventInterval:     x.EventInterval.Duration(),
+	}
+
+	if l.ipv4Mask == nil {
+		return nil, fmt.Errorf("Invalid ipv4-mask %d for source limit", x.Source.IPv4Mask)
+	} else if l.ipv6Mask == nil {
+		return nil, fmt.Errorf("Invalid ipv6-mask %d for source limit", x.Source.IPv6Mask)
+	}
+
+	if x.Rate.Connections < 0 {
+		return nil, fmt.Errorf("Invalid connections %f for rate limit", x.Rate.Connections)
+	} else if x.Rate.Connections > 0 && l.burst <= 0 {
+		// allow at least a single connection
+		l.burst = 1
+	}
+
+	var err error
+	if l.global.action, err = parseAction(LimitGlobal, x.Global.Action); err != nil {
+		return nil, err
+	} else if l.source.action, err = parseAction(LimitSource, x.Source.Action); err != nil {
+		return nil, err
+	} else if l.port.action, err = parseAction(LimitPort, x.Port.Action); err != nil {
+		return nil, err
+	} else if l.rateAction, err = parseAction(LimitRate, x.Rate.Action); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// rejection describes why a connection has not been admitted.
+type rejection struct {
+	limit  string
+	action string
+}
+
+type sourceRate struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+type throttle struct {
+	count    int
+	reported time.Time
+}
+
+// admission keeps track of the active connections, the counters survive
+// reloads of the limits.
+type admission struct {
+	m sync.Mutex
+
+	global  int
+	sources map[string]int
+	ports   map[string]int
+
+	rates  map[string]*sourceRate
+	pruned time.Time
+
+	tarpitted int
+
+	throttles map[string]*throttle
+}
+
+func newAdmission() *admission {
+	return &admission{
+		sources:   map[string]int{},
+		ports:     map[string]int{},
+		rates:     map[string]*sourceRate{},
+		pruned:    time.Now(),
+		throttles: map[string]*throttle{},
+	}
+}
+
+// addrIPPort returns the ip and port of tcp and udp addresses.
+func addrIPPort(addr net.Addr) (net.IP, int) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port
+	case *net.UDPAddr:
+		return a.IP, a.Port
+	default:
+		return nil, 0
+	}
+}
+
+// admit checks the connection against the limits. When admitted, release
+// should be called after the connection has been handled.
+func (a *admission) admit(l *limits, conn net.Conn) (release func(), rej *rejection) {
+	ip, _ := addrIPPort(conn.RemoteAddr())
+	_, port := addrIPPort(conn.LocalAddr())
+
+	source := ""
+	if ip != nil {
+		source = l.sourceKey(ip)
+	}
+
+	portKey := fmt.Sprintf("%s/%d", conn.LocalAddr().Network(), port)
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	now := time.Now()
+
+	if source != "" && l.rate > 0 && !a.allow(l, source, now) {
+		return nil, &rejection{LimitRate, l.rateAction}
+	} else if l.global.max > 0 && a.global >= l.global.max {
+		return nil, &rejection{LimitGlobal, l.global.action}
+	} else if source != "" && l.source.max > 0 && a.sources[source] >= l.source.max {
+		return nil, &rejection{LimitSource, l.source.action}
+	} else if l.port.max > 0 && a.ports[portKey] >= l.port.max {
+		return nil, &rejection{LimitPort, l.port.action}
+	}
+
+	a.global++
+	a.ports[portKey]++
+	if source != "" {
+		a.sources[source]++
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			a.m.Lock()
+			defer a.m.Unlock()
+
+			a.global--
+
+			if a.ports[portKey]--; a.ports[portKey] <= 0 {
+				delete(a.ports, portKey)
+			}
+
+			if source == "" {
+			} else if a.sources[source]--; a.sources[source] <= 0 {
+				delete(a.sources, source)
+			}
+		})
+	}, nil
+}
+
+// allow checks the new connections budget of the source, a.m should be locked.
+func (a *admission) allow(l *limits, source string, now time.Time) bool {
+	// forget sources that have been quiet for a while
+	if now.Sub(a.pruned) > time.Minute {
+		for key, sr := range a.rates {
+			if now.Sub(sr.seen) > time.Minute {
+				delete(a.rates, key)
+			}
+		}
+
+		a.pruned = now
+	}
+
+	sr, ok := a.rates[source]
+	if !ok || sr.limiter.Limit() != l.rate || sr.limiter.Burst() != l.burst {
+		sr = &sourceRate{
+			limiter: rate.NewLimiter(l.rate, l.burst),
+		}
+
+		a.rates[source] = sr
+	}
+
+	sr.seen = now
+	return sr.limiter.AllowN(now, 1)
+}
+
+// throttled counts the rejection, and returns the number of rejections
+// since the last report when a new throttled event should be sent.
+func (a *admission) throttled(l *limits, rej *rejection) (int, bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	t, ok := a.throttles[rej.limit]
+	if !ok {
+		t = &throttle{}
+		a.throttles[rej.limit] = t
+	}
+
+	t.count++
+
+	now := time.Now()
+	if now.Sub(t.reported) < l.eventInterval {
+		return 0, false
+	}
+
+	count := t.count
+
+	t.count = 0
+	t.reported = now
+
+	return count, true
+}
+
+// tarpit returns if another connection can be tarpitted, release should
+// be called when done.
+func (a *admission) tarpit(l *limits) (release func(), ok bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	if a.tarpitted >= l.tarpitConnections {
+		return nil, false
+	}
+
+	a.tarpitted++
+
+	return func() {
+		a.m.Lock()
+		defer a.m.Unlock()
+
+		a.tarpitted--
+	}, true
+}
+
+// reject handles a connection that has not been admitted, using the
+// action of the limit.
+func (hc *Honeytrap) reject(ctx context.Context, conn net.Conn, l *limits, rej *rejection) {
+	defer conn.Close()
+
+	if count, ok := hc.admission.throttled(l, rej); ok {
+		hc.events.Send(event.New(
+			event.ConnectionSensor,
+			event.Category("connection"),
+			event.ConnectionThrottled,
+			event.SourceAddr(conn.RemoteAddr()),
+			event.DestinationAddr(conn.LocalAddr()),
+			event.Custom("limit", rej.limit),
+			event.Custom("action", rej.action),
+			event.Custom("throttled", count),
+		))
+	}
+
+	log.Debug("Throttled connection for %s => %s (limit=%s, action=%s)", conn.RemoteAddr(), conn.LocalAddr(), rej.limit, rej.action)
+
+	switch rej.action {
+	case ActionReset:
+		// closing with a linger of zero sends a RST instead of a FIN
+		if lc, ok := conn.(interface {
+			SetLinger(int) error
+		}); ok {
+			lc.SetLinger(0)
+		}
+	case ActionTarpit:
+		release, ok := hc.admission.tarpit(l)
+		if !ok {
+			// too many tarpitted connections already, drop
+			return
+		}
+
+		defer release()
+
+		// keep the connection open without reading, until the peer gives up
+		select {
+		case <-ctx.Done():
+		case <-time.After(l.tarpitTimeout):
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/honeytrap/honeytrap/config"
+)
+
+type addrConn struct {
+	net.Conn
+
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr  { return c.local }
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+
+func newAddrConn(src string, port int) net.Conn {
+	return &addrConn{
+		local:  &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port},
+		remote: &net.TCPAddr{IP: net.ParseIP(src), Port: 31337},
+	}
+}
+
+func testLimits(t *testing.T, s string) *limits {
+	conf := &config.Config{}
+
+	md, err := toml.Decode(s, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf.MetaData = md
+
+	l, err := parseLimits(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestLimitsParse(t *testing.T) {
+	l := testLimits(t, `
+[limits.source]
+max-connections = 2
+ipv4-mask = 24
+action = "tarpit"
+
+[limits.rate]
+connections = 1.5
+`)
+
+	if l.source.max != 2 || l.source.action != ActionTarpit {
+		t.Errorf("Unexpected source limit: %+v", l.source)
+	}
+
+	if l.global.max != 0 || l.global.action != ActionDrop {
+		t.Errorf("Unexpected global limit: %+v", l.global)
+	}
+
+	if l.burst != 1 {
+		t.Errorf("Expected burst of 1, got %d", l.burst)
+	}
+
+	if key := l.sourceKey(net.ParseIP("10.0.0.42")); key != "10.0.0.0" {
+		t.Errorf("Expected source 10.0.0.0, got %s", key)
+	}
+
+	conf := &config.Config{}
+	md, _ := toml.Decode("[limits.port]\naction = \"reject\"\n", conf)
+	conf.MetaData = md
+
+	if _, err := parseLimits(conf); err == nil || !strings.Contains(err.Error(), "reject") {
+		t.Errorf("Expected unknown action error, got %v", err)
+	}
+}
+
+func TestAdmissionLimits(t *testing.T) {
+	l := testLimits(t, `
+[limits.global]
+max-connections = 3
+
+[limits.source]
+max-connections = 2
+ipv4-mask = 24
+action = "rst"
+
+[limits.port]
+max-connections = 1
+`)
+
+	a := newAdmission()
+
+	release, rej := a.admit(l, newAddrConn("10.0.0.1", 22))
+	if rej != nil {
+		t.Fatalf("Unexpected rejection: %+v", rej)
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.0.2", 22)); rej == nil || rej.limit != LimitPort {
+		t.Errorf("Expected port limit, got %+v", rej)
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.0.3", 23)); rej != nil {
+		t.Errorf("Unexpected rejection: %+v", rej)
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.0.4", 24)); rej == nil || rej.limit != LimitSource || rej.action != ActionReset {
+		t.Errorf("Expected source limit, got %+v", rej)
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.1.1", 24)); rej != nil {
+		t.Errorf("Unexpected rejection: %+v", rej)
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.2.1", 25)); rej == nil || rej.limit != LimitGlobal {
+		t.Errorf("Expected global limit, got %+v", rej)
+	}
+
+	release()
+	release()
+
+	if a.global != 2 || a.sources["10.0.0.0"] != 1 {
+		t.Errorf("Unexpected counters after release: global=%d source=%d", a.global, a.sources["10.0.0.0"])
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.0.2", 22)); rej != nil {
+		t.Errorf("Unexpected rejection after release: %+v", rej)
+	}
+}
+
+func TestAdmissionRate(t *testing.T) {
+	l := testLimits(t, `
+event-interval = "1h"
+
+[limits.rate]
+connections = 0.001
+burst = 2
+`)
+
+	a := newAdmission()
+
+	for i := 0; i < 2; i++ {
+		release, rej := a.admit(l, newAddrConn("10.0.0.1", 22))
+		if rej != nil {
+			t.Fatalf("Unexpected rejection: %+v", rej)
+		}
+
+		release()
+	}
+
+	_, rej := a.admit(l, newAddrConn("10.0.0.1", 22))
+	if rej == nil || rej.limit != LimitRate {
+		t.Fatalf("Expected rate limit, got %+v", rej)
+	}
+
+	if _, rej := a.admit(l, newAddrConn("10.0.0.2", 22)); rej != nil {
+		t.Errorf("Unexpected rejection of other source: %+v", rej)
+	}
+
+	if count, ok := a.throttled(l, rej); !ok || count != 1 {
+		t.Errorf("Expected first throttled event, got %d, %t", count, ok)
+	}
+
+	if _, ok := a.throttled(l, rej); ok {
+		t.Errorf("Expected throttled event to be rate limited")
+	}
+}
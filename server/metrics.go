@@ -0,0 +1,199 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/metrics"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+)
+
+var (
+	connectionsAccepted = metrics.NewCounterVec(
+		"honeytrap_connections_accepted_total",
+		"Number of connections handled by a service, by port and service.",
+		"port", "service",
+	)
+	connectionsRejected = metrics.NewCounterVec(
+		"honeytrap_connections_rejected_total",
+		"Number of connections rejected, by port and reason.",
+		"port", "reason",
+	)
+	activeSessions = metrics.NewGaugeVec(
+		"honeytrap_active_sessions",
+		"Number of connections currently being handled, by service.",
+		"service",
+	)
+	peekOutcomes = metrics.NewCounterVec(
+		"honeytrap_peek_outcomes_total",
+		"Number of service selections, by outcome.",
+		"outcome",
+	)
+	channelEvents = metrics.NewCounterVec(
+		"honeytrap_channel_events_total",
+		"Number of events sent to a channel, by channel.",
+		"channel",
+	)
+)
+
+func init() {
+	metrics.Register(
+		connectionsAccepted,
+		connectionsRejected,
+		activeSessions,
+		peekOutcomes,
+		channelEvents,
+	)
+}
+
+// countingChannel counts the events sent to the channel.
+type countingChannel struct {
+	pushers.Channel
+
+	counter *metrics.Counter
+}
+
+func (cc *countingChannel) Send(e event.Event) {
+	cc.counter.Inc()
+	cc.Channel.Send(e)
+}
+
+// portLabel returns the binding the connection has been routed to, used
+// as port label.
+func portLabel(st *state, conn net.Conn) string {
+	ip, port := addrIPPort(conn.LocalAddr())
+
+	r := st.tcp
+	if _, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		r = st.udp
+	}
+
+	if b, ok := r.find(ip, port); ok {
+		return b.String()
+	}
+
+	return fmt.Sprintf("%s/unknown", conn.LocalAddr().Network())
+}
+
+// channelMetrics collects the queue depth, errors and drops of the
+// configured channels and their queues within the event bus.
+func (hc *Honeytrap) channelMetrics() []metrics.Family {
+	queued := metrics.NewGaugeVec(
+		"honeytrap_channel_queue_depth",
+		"Number of events queued for delivery, by channel.",
+		"channel",
+	)
+	errors := metrics.NewCounterVec(
+		"honeytrap_channel_errors_total",
+		"Number of events that failed to be delivered, by channel.",
+		"channel",
+	)
+	dropped := metrics.NewCounterVec(
+		"honeytrap_channel_dropped_total",
+		"Number of events discarded, by channel.",
+		"channel",
+	)
+
+	backlogEvents := metrics.NewGaugeVec(
+		"honeytrap_spool_backlog_events",
+		"Number of spooled events waiting for delivery, by channel.",
+		"channel",
+	)
+	backlogBytes := metrics.NewGaugeVec(
+		"honeytrap_spool_backlog_bytes",
+		"Size of the spooled events waiting for delivery, by channel.",
+		"channel",
+	)
+	backlogAge := metrics.NewGaugeVec(
+		"honeytrap_spool_backlog_age_seconds",
+		"Age of the oldest spooled event waiting for delivery, by channel.",
+		"channel",
+	)
+
+	if st := hc.currentState(); st != nil {
+		for name, channel := range st.channels {
+			if s, ok := channel.(*spool.Spool); ok {
+				backlog := s.Backlog()
+
+				backlogEvents.With(name).Set(float64(backlog.Events))
+				backlogBytes.With(name).Set(float64(backlog.Bytes))
+
+				if backlog.Oldest.IsZero() {
+					backlogAge.With(name).Set(0)
+				} else {
+					backlogAge.With(name).Set(time.Since(backlog.Oldest).Seconds())
+				}
+			}
+
+			sr, ok := channel.(pushers.StatsReporter)
+			if !ok {
+				continue
+			}
+
+			stats := sr.Stats()
+
+			queued.With(name).Set(float64(stats.Queued))
+			errors.With(name).Add(stats.Errors)
+			dropped.With(name).Add(stats.Dropped)
+		}
+	}
+
+	busQueued := metrics.NewGaugeVec(
+		"honeytrap_eventbus_queue_depth",
+		"Number of events queued within the event bus, by subscriber.",
+		"subscriber",
+	)
+	busDropped := metrics.NewCounterVec(
+		"honeytrap_eventbus_dropped_total",
+		"Number of events dropped by the overflow policy of the event bus, by subscriber.",
+		"subscriber",
+	)
+
+	for _, stats := range append(hc.events.Stats(), hc.bus.Stats()...) {
+		busQueued.With(stats.Name).Add(float64(stats.Queued))
+		busDropped.With(stats.Name).Add(stats.Dropped)
+	}
+
+	families := queued.Collect()
+	families = append(families, busQueued.Collect()...)
+	families = append(families, busDropped.Collect()...)
+	families = append(families, errors.Collect()...)
+	families = append(families, dropped.Collect()...)
+	families = append(families, backlogEvents.Collect()...)
+	families = append(families, backlogBytes.Collect()...)
+	families = append(families, backlogAge.Collect()...)
+	return families
+}
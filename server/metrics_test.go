@@ -0,0 +1,94 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+type statsChannel struct {
+	pushers.Counters
+}
+
+func (sc *statsChannel) Send(event.Event) {
+	sc.AddDropped(1)
+}
+
+func (sc *statsChannel) Stats() pushers.Stats {
+	return sc.Counters.Stats(7)
+}
+
+func TestChannelMetrics(t *testing.T) {
+	hc, _ := New()
+
+	sc := &statsChannel{}
+	sc.Send(event.New())
+	sc.AddErrors(2)
+
+	hc.setState(&state{
+		channels: map[string]pushers.Channel{
+			"queue": sc,
+			"plain": pushers.MustDummy(),
+		},
+	})
+
+	values := map[string]float64{}
+	for _, f := range hc.channelMetrics() {
+		// the bus only contains the queue of the enrichment
+		expected := "queue"
+		if strings.HasPrefix(f.Name, "honeytrap_eventbus_") {
+			expected = "enrichment"
+		}
+
+		for _, s := range f.Samples {
+			if len(s.Labels) != 1 || s.Labels[0].Value != expected {
+				t.Errorf("Unexpected sample for %s: %+v", f.Name, s)
+			}
+
+			values[f.Name] = s.Value
+		}
+	}
+
+	if values["honeytrap_channel_queue_depth"] != 7 || values["honeytrap_channel_errors_total"] != 2 || values["honeytrap_channel_dropped_total"] != 1 {
+		t.Errorf("Unexpected channel metrics: %+v", values)
+	}
+
+	cc := &countingChannel{sc, channelEvents.With("counting")}
+	cc.Send(event.New())
+
+	if v := channelEvents.With("counting").Value(); v != 1 {
+		t.Errorf("Expected 1 event, got %d", v)
+	}
+}
@@ -32,8 +32,10 @@ package server
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"os/user"
 	"path"
@@ -71,46 +73,86 @@ func WithConfig(s string) (OptionFn, error) {
 	}
 
 	return func(b *Honeytrap) error {
+		b.configSource = func() ([]byte, error) {
+			return ioutil.ReadFile(s)
+		}
+
 		return b.config.Load(bytes.NewBuffer(data))
 	}, nil
 }
 
-func WithRemoteConfig(s string) (OptionFn, error) {
-	resp, err := http.Get(s)
+// ReadConfig reads the configuration from a file or url.
+func ReadConfig(s string) ([]byte, error) {
+	u, err := url.Parse(s)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	switch u.Scheme {
+	case "", "file":
+		return ioutil.ReadFile(u.Path)
+	case "http", "https":
+		resp, err := http.Get(s)
+		if err != nil {
+			return nil, err
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unexpected status %s", resp.Status)
+		}
+
+		return ioutil.ReadAll(resp.Body)
+	default:
+		return nil, fmt.Errorf("Unknown path scheme %s", u.Scheme)
+	}
+}
+
+func WithRemoteConfig(s string) (OptionFn, error) {
+	body, err := ReadConfig(s)
 	if err != nil {
 		return nil, err
 	}
+
 	return func(b *Honeytrap) error {
+		b.configSource = func() ([]byte, error) {
+			return ReadConfig(s)
+		}
+
 		return b.config.Load(bytes.NewBuffer(body))
 	}, nil
 }
 
-func WithDataDir(s string) (OptionFn, error) {
-	var err error
-
+// DataDir returns the absolute path of the data directory, creating it if it
+// doesn't exist.
+func DataDir(s string) (string, error) {
 	p, err := expand(s)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	p, err = filepath.Abs(p)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	_, err = os.Stat(p)
 	if os.IsNotExist(err) {
 		err = os.Mkdir(p, 0755)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 	} else if err != nil {
+		return "", err
+	}
+
+	return p, nil
+}
+
+func WithDataDir(s string) (OptionFn, error) {
+	p, err := DataDir(s)
+	if err != nil {
 		return nil, err
 	}
 
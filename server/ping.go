@@ -38,7 +38,7 @@ import (
 
 // ping delivers a ping event to the server indicate it's alive.
 func (hc *Honeytrap) ping() error {
-	hc.bus.Send(event.New(
+	hc.events.Send(event.New(
 		event.PingSensor,
 		event.PingEvent,
 	))
@@ -0,0 +1,404 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PortRange defines a range of ports for a protocol, optionally bound to an
+// ip address or network. Single ports have the same From and To value.
+type PortRange struct {
+	Proto string
+	Host  string
+
+	From int
+	To   int
+}
+
+func (pr PortRange) String() string {
+	port := strconv.Itoa(pr.From)
+	if pr.From != pr.To {
+		port = fmt.Sprintf("%d-%d", pr.From, pr.To)
+	}
+
+	if pr.Host == "" {
+		return fmt.Sprintf("%s/%s", pr.Proto, port)
+	}
+
+	return fmt.Sprintf("%s/%s", pr.Proto, net.JoinHostPort(pr.Host, port))
+}
+
+// Network returns the network the range is bound to, single ip addresses
+// will be returned as a network containing only that address. Nil will be
+// returned if the range is not bound to a host.
+func (pr PortRange) Network() (*net.IPNet, error) {
+	if pr.Host == "" {
+		return nil, nil
+	}
+
+	if _, network, err := net.ParseCIDR(pr.Host); err == nil {
+		return network, nil
+	}
+
+	ip := net.ParseIP(pr.Host)
+	if ip != nil {
+	} else if addr, err := net.ResolveIPAddr("ip", pr.Host); err != nil {
+		return nil, err
+	} else {
+		ip = addr.IP
+	}
+
+	if ip.IsUnspecified() {
+		return nil, nil
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+
+	return &net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(bits, bits),
+	}, nil
+}
+
+// Contains returns true if the port is within the range.
+func (pr PortRange) Contains(port int) bool {
+	return port >= pr.From && port <= pr.To
+}
+
+// overlaps returns true if the ranges share ports without one containing the
+// other, the binding of the shared ports would be ambiguous.
+func (pr PortRange) overlaps(other PortRange) bool {
+	if pr.To < other.From || other.To < pr.From {
+		return false
+	}
+
+	contains := pr.From <= other.From && other.To <= pr.To
+	contained := other.From <= pr.From && pr.To <= other.To
+
+	return !contains && !contained
+}
+
+// Addrs returns the addresses for every port within the range.
+func (pr PortRange) Addrs() ([]net.Addr, error) {
+	addrs := []net.Addr{}
+
+	for port := pr.From; port <= pr.To; port++ {
+		hostport := net.JoinHostPort(pr.Host, strconv.Itoa(port))
+
+		switch pr.Proto {
+		case "tcp":
+			addr, err := net.ResolveTCPAddr("tcp", hostport)
+			if err != nil {
+				return nil, err
+			}
+
+			addrs = append(addrs, addr)
+		case "udp":
+			addr, err := net.ResolveUDPAddr("udp", hostport)
+			if err != nil {
+				return nil, err
+			}
+
+			addrs = append(addrs, addr)
+		default:
+			return nil, fmt.Errorf("unknown protocol %s", pr.Proto)
+		}
+	}
+
+	return addrs, nil
+}
+
+// ToPortRange parses port definitions like tcp/8080, tcp/8000-8100 and
+// tcp/any. The port can be bound to an ip address or network, eg.
+// tcp/10.0.0.5:80 or tcp/10.0.0.0/24:80. The socket listener opens a socket
+// for every port, large ranges require the raw (canary) or netstack listener.
+func ToPortRange(input string) (PortRange, error) {
+	parts := strings.SplitN(input, "/", 2)
+
+	if len(parts) != 2 {
+		return PortRange{}, fmt.Errorf("wrong format (needs to be \"protocol/port\")")
+	}
+
+	pr := PortRange{
+		Proto: parts[0],
+	}
+
+	switch pr.Proto {
+	case "tcp", "udp":
+	default:
+		return PortRange{}, fmt.Errorf("unknown protocol %s", pr.Proto)
+	}
+
+	host, port, err := net.SplitHostPort(parts[1])
+	if err != nil {
+		port = parts[1]
+	} else {
+		pr.Host = host
+	}
+
+	if !strings.Contains(pr.Host, "/") {
+	} else if _, _, err := net.ParseCIDR(pr.Host); err != nil {
+		return PortRange{}, fmt.Errorf("error parsing network: %s", err.Error())
+	}
+
+	if port == "any" {
+		pr.From, pr.To = 1, 65535
+		return pr, nil
+	}
+
+	from, to := port, port
+	if i := strings.Index(port, "-"); i != -1 {
+		from, to = port[:i], port[i+1:]
+	}
+
+	v, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("error parsing port value: %s", err.Error())
+	}
+
+	pr.From = int(v)
+
+	v, err = strconv.ParseUint(to, 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("error parsing port value: %s", err.Error())
+	}
+
+	pr.To = int(v)
+
+	if pr.From > pr.To {
+		return PortRange{}, fmt.Errorf("invalid port range %s", port)
+	}
+
+	// port 0 would be bound to a random port
+	if pr.From == 0 {
+		return PortRange{}, fmt.Errorf("invalid port 0")
+	}
+
+	return pr, nil
+}
+
+// binding maps a port range, optionally bound to a network, to the services
+// handling it.
+type binding struct {
+	PortRange
+
+	network *net.IPNet
+
+	services []*ServiceMap
+
+	// peeking configuration, used when there are multiple services
+	peekTimeout    time.Duration
+	peekSize       int
+	defaultService *ServiceMap
+}
+
+// isHost returns true if the binding is bound to a single ip address.
+func (b *binding) isHost() bool {
+	if b.network == nil {
+		return false
+	}
+
+	ones, bits := b.network.Mask.Size()
+	return ones == bits
+}
+
+// routes contains the bindings of a single protocol.
+type routes struct {
+	// port-only bindings of a single port
+	ports map[int]*binding
+
+	// port-only bindings of a port range, narrowest first
+	ranges []*binding
+
+	// bindings bound to an ip address or network, most specific first
+	hosts []*binding
+}
+
+func newRoutes() *routes {
+	return &routes{
+		ports: map[int]*binding{},
+	}
+}
+
+// add adds the binding, ranges can contain other ranges of the same network
+// but can't partially overlap.
+func (r *routes) add(b *binding) error {
+	if b.network != nil {
+		for _, other := range r.hosts {
+			if other.network.String() != b.network.String() {
+			} else if other.From == b.From && other.To == b.To {
+				return fmt.Errorf("Port %s was already defined, ignoring the newer definition", b)
+			} else if other.overlaps(b.PortRange) {
+				return fmt.Errorf("Port %s overlaps port %s, ignoring the newer definition", b, other)
+			}
+		}
+
+		r.hosts = append(r.hosts, b)
+
+		sort.SliceStable(r.hosts, func(i, j int) bool {
+			onesI, _ := r.hosts[i].network.Mask.Size()
+			onesJ, _ := r.hosts[j].network.Mask.Size()
+			if onesI != onesJ {
+				return onesI > onesJ
+			}
+
+			return r.hosts[i].To-r.hosts[i].From < r.hosts[j].To-r.hosts[j].From
+		})
+
+		return nil
+	}
+
+	if b.From != b.To {
+		for _, other := range r.ranges {
+			if other.From == b.From && other.To == b.To {
+				return fmt.Errorf("Port %s was already defined, ignoring the newer definition", b)
+			} else if other.overlaps(b.PortRange) {
+				return fmt.Errorf("Port %s overlaps port %s, ignoring the newer definition", b, other)
+			}
+		}
+
+		r.ranges = append(r.ranges, b)
+
+		sort.SliceStable(r.ranges, func(i, j int) bool {
+			return r.ranges[i].To-r.ranges[i].From < r.ranges[j].To-r.ranges[j].From
+		})
+
+		return nil
+	}
+
+	if _, ok := r.ports[b.From]; ok {
+		return fmt.Errorf("Port %s was already defined, ignoring the newer definition", b)
+	}
+
+	r.ports[b.From] = b
+	return nil
+}
+
+// find returns the binding for the destination ip and port. Bindings for an ip
+// address or network take priority over port-only bindings, and exact port
+// definitions take priority over ranges.
+func (r *routes) find(ip net.IP, port int) (*binding, bool) {
+	for _, b := range r.hosts {
+		if b.network.Contains(ip) && b.Contains(port) {
+			return b, true
+		}
+	}
+
+	if b, ok := r.ports[port]; ok {
+		return b, true
+	}
+
+	for _, b := range r.ranges {
+		if b.Contains(port) {
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+// covers returns true if the port will be listened on by a wildcard address.
+func (r *routes) covers(port int) bool {
+	for _, b := range r.all() {
+		if b.isHost() {
+			continue
+		}
+
+		if b.Contains(port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *routes) all() []*binding {
+	bindings := append([]*binding{}, r.hosts...)
+	bindings = append(bindings, r.ranges...)
+
+	for _, b := range r.ports {
+		bindings = append(bindings, b)
+	}
+
+	return bindings
+}
+
+// addresses returns the addresses the listener needs to listen on. Bindings to
+// networks will use wildcard addresses, bindings to a single ip address will only
+// be listened on if the port is not already covered by a wildcard address.
+func (r *routes) addresses() ([]net.Addr, error) {
+	addrs := []net.Addr{}
+
+	for _, b := range r.all() {
+		pr := b.PortRange
+		if !b.isHost() {
+			pr.Host = ""
+		}
+
+		v, err := pr.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		if !b.isHost() {
+			addrs = append(addrs, v...)
+			continue
+		}
+
+		for _, addr := range v {
+			port := 0
+
+			switch a := addr.(type) {
+			case *net.TCPAddr:
+				port = a.Port
+			case *net.UDPAddr:
+				port = a.Port
+			}
+
+			if r.covers(port) {
+				continue
+			}
+
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs, nil
+}
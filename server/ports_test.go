@@ -0,0 +1,190 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func TestToPortRange(t *testing.T) {
+	tests := []struct {
+		input string
+		from  int
+		to    int
+	}{
+		{"tcp/8080", 8080, 8080},
+		{"tcp/8000-8100", 8000, 8100},
+		{"udp/1-65535", 1, 65535},
+		{"tcp/any", 1, 65535},
+		{"tcp/127.0.0.1:8000-8001", 8000, 8001},
+	}
+
+	for _, test := range tests {
+		pr, err := ToPortRange(test.input)
+		if err != nil {
+			t.Errorf("Error parsing %s: %s", test.input, err.Error())
+			continue
+		}
+
+		if pr.From != test.from || pr.To != test.to {
+			t.Errorf("Wrong range for %s: got %d-%d, expected %d-%d", test.input, pr.From, pr.To, test.from, test.to)
+		}
+	}
+}
+
+func TestToPortRangeInvalid(t *testing.T) {
+	for _, input := range []string{"tcp/8100-8000", "tdp/any", "tcp/1-70000", "tcp/a-b", "tcp/0", "tcp/0-10"} {
+		if _, err := ToPortRange(input); err == nil {
+			t.Errorf("No error thrown for %s", input)
+		}
+	}
+}
+
+func TestRoutesFind(t *testing.T) {
+	r := newRoutes()
+
+	for _, v := range []struct {
+		input string
+		name  string
+	}{
+		{"tcp/8080", "exact"},
+		{"tcp/any", "any"},
+		{"tcp/8000-8100", "range"},
+		{"tcp/10.0.0.5:80", "host"},
+		{"tcp/10.0.0.0/24:80", "network"},
+		{"tcp/80", "port"},
+	} {
+		pr, err := ToPortRange(v.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		network, err := pr.Network()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.add(&binding{
+			PortRange: pr,
+			network:   network,
+			services:  []*ServiceMap{{Name: v.name}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ip       string
+		port     int
+		expected string
+	}{
+		{"10.0.0.1", 8080, "exact"},
+		{"10.0.0.1", 8081, "range"},
+		{"10.0.0.1", 22, "any"},
+		{"10.0.0.5", 80, "host"},
+		{"10.0.0.6", 80, "network"},
+		{"10.0.1.6", 80, "port"},
+	}
+
+	for _, test := range tests {
+		b, ok := r.find(net.ParseIP(test.ip), test.port)
+		if !ok {
+			t.Errorf("Expected service %s for %s:%d", test.expected, test.ip, test.port)
+			continue
+		}
+
+		if b.services[0].Name != test.expected {
+			t.Errorf("Wrong service for %s:%d: got %s, expected %s", test.ip, test.port, b.services[0].Name, test.expected)
+		}
+	}
+}
+
+func TestRoutesAddOverlap(t *testing.T) {
+	r := newRoutes()
+
+	add := func(input string) error {
+		pr, err := ToPortRange(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		network, _ := pr.Network()
+		return r.add(&binding{
+			PortRange: pr,
+			network:   network,
+		})
+	}
+
+	for _, input := range []string{"tcp/any", "tcp/8000-8100", "tcp/8050-8060", "tcp/8080", "tcp/10.0.0.0/24:80-90", "tcp/10.0.0.0/24:85"} {
+		if err := add(input); err != nil {
+			t.Errorf("Expected %s to be added, got %s", input, err)
+		}
+	}
+
+	for _, input := range []string{"tcp/8000-8100", "tcp/8090-8200", "tcp/8080", "tcp/10.0.0.0/24:80-90", "tcp/10.0.0.0/24:70-80"} {
+		if err := add(input); err == nil {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+}
+
+func TestRoutesAddresses(t *testing.T) {
+	r := newRoutes()
+
+	for _, input := range []string{"tcp/10.0.0.5:80", "tcp/10.0.0.6:80", "tcp/127.0.0.1:22", "tcp/80"} {
+		pr, err := ToPortRange(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		network, _ := pr.Network()
+		r.add(&binding{
+			PortRange: pr,
+			network:   network,
+		})
+	}
+
+	addrs, err := r.addresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the ip addresses on port 80 are covered by the wildcard address
+	found := map[string]bool{}
+	for _, addr := range addrs {
+		found[addr.String()] = true
+	}
+
+	if len(addrs) != 2 || !found[":80"] || !found["127.0.0.1:22"] {
+		t.Errorf("Unexpected addresses: %v", addrs)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/listener"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+var (
+	// ErrReloadNotSupported will be returned when the configuration has not
+	// been loaded from a file or url.
+	ErrReloadNotSupported = errors.New("configuration source does not support reloading")
+	// ErrNotRunning will be returned when reloading before honeytrap has started.
+	ErrNotRunning = errors.New("honeytrap is not running")
+)
+
+func (hc *Honeytrap) currentState() *state {
+	hc.m.RLock()
+	defer hc.m.RUnlock()
+
+	return hc.st
+}
+
+func (hc *Honeytrap) setState(st *state) {
+	hc.m.Lock()
+	defer hc.m.Unlock()
+
+	hc.st = st
+}
+
+// Reload will read the configuration again and replace the running channels, filters,
+// directors, services and ports. Components with unchanged configuration will be
+// kept. Connections already being handled will finish on the service
+// instance they started with. On any configuration error the reload
+// will be aborted, and the current state kept.
+func (hc *Honeytrap) Reload() error {
+	hc.reloadLock.Lock()
+	defer hc.reloadLock.Unlock()
+
+	prev := hc.currentState()
+	if prev == nil {
+		return ErrNotRunning
+	}
+
+	if hc.configSource == nil {
+		return ErrReloadNotSupported
+	}
+
+	data, err := hc.configSource()
+	if err != nil {
+		return err
+	}
+
+	// the logging backends are configured once at startup, decoding
+	// doesn't reopen the log outputs.
+	conf := &config.Config{}
+	if err := conf.Decode(bytes.NewBuffer(data)); err != nil {
+		return err
+	}
+
+	st, err := hc.newState(conf, prev)
+	if err != nil {
+		discardState(st, prev, drainTimeout(conf))
+		return err
+	}
+
+	if !reflect.DeepEqual(decodeRaw(prev.config, prev.config.Listener), decodeRaw(conf, conf.Listener)) {
+		log.Warning("Listener configuration changed, this requires a restart")
+	}
+
+	if !reflect.DeepEqual(prev.config.Logging, conf.Logging) {
+		log.Warning("Logging configuration changed, this requires a restart")
+	}
+
+	// stop listening on removed addresses before the state is swapped,
+	// new addresses will be added after.
+	for key, addr := range prev.addresses {
+		if _, ok := st.addresses[key]; ok {
+			continue
+		}
+
+		if r, ok := hc.listener.(listener.RemoveAddresser); ok {
+			r.RemoveAddress(addr)
+		} else {
+			log.Warningf("Listener doesn't support removing address %s, keeping it", key)
+		}
+	}
+
+	hc.bus.Replace(prev.subscribers, st.subscribers)
+
+	// the subscribers have been replaced, so no events will be aggregated
+	// anymore by the previous filters
+	closeAggregates(prev.aggregates)
+
+	hc.enrichment.replace(st.enrichers)
+	closeEnrichers(prev.enrichers, st.enrichers)
+
+	hc.setState(st)
+
+	for key, addr := range st.addresses {
+		if _, ok := prev.addresses[key]; ok {
+			continue
+		}
+
+		if a, ok := hc.listener.(listener.AddAddresser); ok {
+			a.AddAddress(addr)
+		}
+	}
+
+	// channels that have been replaced or removed can deliver their
+	// queued events in the background
+	removed := map[string]pushers.Channel{}
+	for name, channel := range prev.channels {
+		if st.channels[name] == channel {
+			continue
+		}
+
+		removed[name] = channel
+	}
+
+	go shutdownChannels(removed, drainTimeout(conf))
+
+	log.Info("Configuration reloaded")
+
+	hc.events.Send(event.New(
+		event.Sensor("honeytrap"),
+		event.Category("reload"),
+		event.SeverityInfo,
+	))
+
+	return nil
+}
+
+// discardState shuts down the components of a state that won't be used,
+// except for the components it shares with the previous state.
+func discardState(st *state, prev *state, timeout time.Duration) {
+	closeAggregates(st.aggregates)
+
+	channels := map[string]pushers.Channel{}
+	for name, channel := range st.channels {
+		if prev.channels[name] == channel {
+			continue
+		}
+
+		channels[name] = channel
+	}
+
+	shutdownChannels(channels, timeout)
+
+	closeEnrichers(st.enrichers, prev.enrichers)
+
+	for key, d := range st.directors {
+		if prev.directors[key] == d {
+			continue
+		}
+
+		if c, ok := d.(io.Closer); !ok {
+		} else if err := c.Close(); err != nil {
+			log.Errorf("Error closing director %s: %s", key, err.Error())
+		}
+	}
+}
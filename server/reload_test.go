@@ -0,0 +1,197 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+const reloadConfig = `
+[service.echo]
+type="echo"
+
+[service.other]
+type="%s"
+
+[[port]]
+port="tcp/%d"
+services=["echo"]
+`
+
+func newReloadTest(t *testing.T, data *[]byte) *Honeytrap {
+	hc, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc.config = &config.Config{}
+	if err := hc.config.Load(bytes.NewBuffer(*data)); err != nil {
+		t.Fatal(err)
+	}
+
+	hc.configSource = func() ([]byte, error) {
+		return *data, nil
+	}
+
+	st, err := hc.newState(hc.config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc.setState(st)
+	return hc
+}
+
+func TestReload(t *testing.T) {
+	data := []byte(fmt.Sprintf(reloadConfig, "echo", 8080))
+
+	hc := newReloadTest(t, &data)
+	prev := hc.currentState()
+
+	data = []byte(fmt.Sprintf(reloadConfig, "echo", 8081))
+	if err := hc.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := hc.currentState()
+	if st == prev {
+		t.Fatal("Expected state to be replaced")
+	}
+
+	if _, ok := st.tcp.ports[8081]; !ok {
+		t.Error("Expected port tcp/8081 to be configured")
+	}
+
+	if _, ok := st.tcp.ports[8080]; ok {
+		t.Error("Expected port tcp/8080 to be removed")
+	}
+
+	if st.services["echo"] != prev.services["echo"] {
+		t.Error("Expected unchanged service to be reused")
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	data := []byte(fmt.Sprintf(reloadConfig, "echo", 8080))
+
+	hc := newReloadTest(t, &data)
+	prev := hc.currentState()
+
+	data = []byte(fmt.Sprintf(reloadConfig, "unknown-service", 8081))
+	if err := hc.Reload(); err == nil {
+		t.Fatal("Expected reload to fail with unknown service type")
+	}
+
+	if hc.currentState() != prev {
+		t.Error("Expected state to be kept after failed reload")
+	}
+}
+
+// closingChannel records the names of the closed channels.
+type closingChannel struct {
+	Name string `toml:"name"`
+}
+
+var (
+	closedChannels  []string
+	closedChannelsM sync.Mutex
+
+	_ = pushers.Register("reload-test", func(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+		c := &closingChannel{}
+
+		for _, optionFn := range options {
+			if err := optionFn(c); err != nil {
+				return nil, err
+			}
+		}
+
+		return c, nil
+	})
+)
+
+func (c *closingChannel) Send(event.Event) {
+}
+
+func (c *closingChannel) Close() error {
+	closedChannelsM.Lock()
+	defer closedChannelsM.Unlock()
+
+	closedChannels = append(closedChannels, c.Name)
+	return nil
+}
+
+const reloadChannelsConfig = `
+[channel.kept]
+type="reload-test"
+name="kept"
+%s
+
+[[filter]]
+channel=["kept"]
+
+[service.echo]
+type="%s"
+
+[[port]]
+port="tcp/8080"
+services=["echo"]
+`
+
+func TestReloadInvalidShutdown(t *testing.T) {
+	data := []byte(fmt.Sprintf(reloadChannelsConfig, "", "echo"))
+
+	hc := newReloadTest(t, &data)
+
+	data = []byte(fmt.Sprintf(reloadChannelsConfig, `
+[channel.added]
+type="reload-test"
+name="added"
+`, "unknown-service"))
+
+	if err := hc.Reload(); err == nil {
+		t.Fatal("Expected reload to fail with unknown service type")
+	}
+
+	closedChannelsM.Lock()
+	defer closedChannelsM.Unlock()
+
+	if !reflect.DeepEqual(closedChannels, []string{"added"}) {
+		t.Errorf("Expected only the added channel to be closed, got %v", closedChannels)
+	}
+}
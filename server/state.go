@@ -0,0 +1,782 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/director"
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event/ecs"
+	"github.com/honeytrap/honeytrap/event/expr"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/eventbus"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+	"github.com/honeytrap/honeytrap/rules"
+	"github.com/honeytrap/honeytrap/services"
+)
+
+// configErrors contains all errors found while building the state from
+// the configuration.
+type configErrors []error
+
+func (ce configErrors) Error() string {
+	s := make([]string, len(ce))
+	for i, err := range ce {
+		s[i] = err.Error()
+	}
+
+	return strings.Join(s, "; ")
+}
+
+// sectionError is an error within a section of the configuration, like
+// service.ssh or port.0.
+type sectionError struct {
+	section string
+	err     error
+
+	// key is set if the error is about a single key
+	key string
+
+	// fatal errors prevent honeytrap from starting
+	fatal bool
+}
+
+func (se *sectionError) Error() string {
+	return se.err.Error()
+}
+
+func inSection(section string, err error) error {
+	return &sectionError{section: section, err: err}
+}
+
+// warn logs the warning and keeps it, to be reported when checking the
+// configuration.
+func (st *state) warn(section string, format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+
+	log.Warning(err.Error())
+	st.warnings = append(st.warnings, inSection(section, err))
+}
+
+// opaqueSections are decoded by the components themselves, their keys can't be
+// checked for being used.
+var opaqueSections = []string{"channel", "director", "enrich", "listener", "web", "api", "correlation"}
+
+var (
+	defaultAggregateKey    = []string{"source-ip", "category", "type"}
+	defaultAggregateWindow = time.Minute
+)
+
+// maxSocketAddresses is the maximum number of addresses the socket listener
+// will listen on, it opens a socket for every address.
+const maxSocketAddresses = 1024
+
+// spoolConfig is the configuration of the spool of a channel.
+type spoolConfig struct {
+	MaxSize     string       `toml:"max-size"`
+	MaxAge      config.Delay `toml:"max-age"`
+	SegmentSize string       `toml:"segment-size"`
+}
+
+func (sc *spoolConfig) parse() (spool.Config, error) {
+	c := spool.Config{
+		MaxAge: sc.MaxAge.Duration(),
+	}
+
+	if c.MaxAge < 0 {
+		return c, fmt.Errorf("invalid max-age %s", c.MaxAge)
+	}
+
+	var err error
+
+	if sc.MaxSize == "" {
+	} else if c.MaxSize, err = spool.ParseSize(sc.MaxSize); err != nil {
+		return c, fmt.Errorf("invalid max-size: %s", err.Error())
+	}
+
+	if sc.SegmentSize == "" {
+	} else if c.SegmentSize, err = spool.ParseSize(sc.SegmentSize); err != nil {
+		return c, fmt.Errorf("invalid segment-size: %s", err.Error())
+	}
+
+	return c, nil
+}
+
+// formats contains the event formats channels can opt in to, besides the
+// native format.
+var formats = map[string]pushers.ConvertFunc{
+	"ecs": ecs.Convert,
+}
+
+// state contains everything that is being built from the configuration and
+// can be replaced while running.
+type state struct {
+	config *config.Config
+
+	channels    map[string]pushers.Channel
+	subscribers []pushers.Channel
+	aggregates  []pushers.Channel
+	enrichers   enricher.Pipeline
+	directors   map[string]director.Director
+	services    map[string]*ServiceMap
+
+	// rules contains the rules by section, they keep the state of the rule
+	rules map[string]rules.Rule
+
+	// enricherSections contains the enrichers by section, to be reused
+	enricherSections map[string]enricher.Enricher
+
+	// raw contains the decoded configuration of every channel, director
+	// and service, used to detect changes while reloading
+	raw map[string]map[string]interface{}
+
+	// Maps a (network,) port and a protocol to an array of pointers to services
+	tcp *routes
+	udp *routes
+
+	// addresses the listener should listen on
+	addresses map[string]net.Addr
+
+	limits *limits
+
+	// warnings contains the problems that don't prevent using the state
+	warnings configErrors
+}
+
+func addressKey(a net.Addr) string {
+	return a.Network() + "/" + a.String()
+}
+
+// decodeRaw decodes the primitive into a generic map, which can be compared
+// to the previous configuration. The keys won't be marked as decoded within
+// the metadata of the configuration.
+func decodeRaw(conf *config.Config, p toml.Primitive) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := toml.PrimitiveDecode(p, &m); err != nil {
+		return nil
+	}
+
+	return m
+}
+
+// unchanged returns true if the previous state contains the same
+// configuration for key.
+func (st *state) unchanged(prev *state, key string) bool {
+	if prev == nil {
+		return false
+	}
+
+	a, ok := prev.raw[key]
+	if !ok {
+		return false
+	}
+
+	return reflect.DeepEqual(a, st.raw[key])
+}
+
+func opaque(section string) bool {
+	for _, s := range opaqueSections {
+		if s == section {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newState will build the channels, filters, directors, services and ports from
+// the configuration. Components with an unchanged configuration will be reused from
+// the previous state. All configuration errors will be returned as configErrors.
+func (hc *Honeytrap) newState(conf *config.Config, prev *state) (*state, error) {
+	st := &state{
+		config:    conf,
+		channels:  map[string]pushers.Channel{},
+		directors: map[string]director.Director{},
+		services:  map[string]*ServiceMap{},
+		raw:       map[string]map[string]interface{}{},
+		tcp:       newRoutes(),
+		udp:       newRoutes(),
+		addresses: map[string]net.Addr{},
+		rules:     map[string]rules.Rule{},
+
+		enricherSections: map[string]enricher.Enricher{},
+	}
+
+	errs := configErrors{}
+
+	if l, err := parseLimits(conf); err != nil {
+		errs = append(errs, inSection("limits", err))
+	} else {
+		st.limits = l
+	}
+
+	isChannelUsed := make(map[string]bool)
+	// sane defaults!
+
+	type queueConfig struct {
+		size   int
+		policy eventbus.Policy
+	}
+
+	// the queue of the channel within the event bus
+	queues := map[string]queueConfig{}
+
+	// the format of the events delivered to the channel
+	channelFormats := map[string]string{}
+
+	for key, s := range conf.Channels {
+		x := struct {
+			Type string `toml:"type"`
+
+			QueueSize int    `toml:"queue-size"`
+			Overflow  string `toml:"overflow"`
+
+			Format string `toml:"format"`
+
+			Spool *spoolConfig `toml:"spool"`
+		}{}
+
+		err := conf.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, inSection("channel."+key, fmt.Errorf("Error parsing configuration of channel: %s", err.Error())))
+			continue
+		}
+
+		if x.Type == "" {
+			errs = append(errs, inSection("channel."+key, fmt.Errorf("Error parsing configuration of channel %s: type not set", key)))
+			continue
+		}
+
+		policy, err := eventbus.ParsePolicy(x.Overflow)
+		if err != nil {
+			errs = append(errs, inSection("channel."+key, fmt.Errorf("Error parsing configuration of channel %s: %s", key, err.Error())))
+			continue
+		}
+
+		if x.QueueSize < 0 {
+			errs = append(errs, inSection("channel."+key, fmt.Errorf("Invalid queue-size %d for channel %s", x.QueueSize, key)))
+			continue
+		}
+
+		if _, ok := formats[x.Format]; !ok && x.Format != "" {
+			errs = append(errs, inSection("channel."+key, fmt.Errorf("Unknown format %s for channel %s, expected ecs", x.Format, key)))
+			continue
+		}
+
+		var sc *spool.Config
+		if x.Spool != nil {
+			c, err := x.Spool.parse()
+			if err != nil {
+				errs = append(errs, inSection("channel."+key+".spool", fmt.Errorf("Invalid spool for channel %s: %s", key, err.Error())))
+				continue
+			}
+
+			sc = &c
+		}
+
+		queues[key] = queueConfig{x.QueueSize, policy}
+		channelFormats[key] = x.Format
+
+		st.raw["channel."+key] = decodeRaw(conf, s)
+
+		if st.unchanged(prev, "channel."+key) {
+			st.channels[key] = prev.channels[key]
+			isChannelUsed[key] = false
+		} else if channelFunc, ok := pushers.Get(x.Type); !ok {
+			errs = append(errs, inSection("channel."+key, fmt.Errorf("Channel %s not supported on platform (%s)", x.Type, key)))
+		} else if d, err := channelFunc(
+			pushers.WithConfig(s),
+			pushers.WithEvents(hc.events),
+			pushers.WithDataDir(hc.dataDir),
+		); err != nil {
+			errs = append(errs, &sectionError{
+				section: "channel." + key,
+				err:     fmt.Errorf("Error initializing channel %s(%s): %s", key, x.Type, err),
+				fatal:   true,
+			})
+		} else if sc == nil || hc.checking {
+			st.channels[key] = d
+			isChannelUsed[key] = false
+		} else if sp, err := spool.New(d, filepath.Join(hc.dataDir, "spool", key), *sc); err != nil {
+			errs = append(errs, &sectionError{
+				section: "channel." + key + ".spool",
+				err:     fmt.Errorf("Error initializing spool of channel %s: %s", key, err),
+				fatal:   true,
+			})
+		} else {
+			st.channels[key] = sp
+			isChannelUsed[key] = false
+		}
+	}
+
+	for i, s := range conf.Filters {
+		section := fmt.Sprintf("filter.%d", i)
+
+		x := struct {
+			Channels   []string `toml:"channel"`
+			Services   []string `toml:"services"`
+			Categories []string `toml:"categories"`
+			Expression string   `toml:"expression"`
+
+			Aggregate *struct {
+				Key       []string     `toml:"key"`
+				Window    config.Delay `toml:"window"`
+				Fields    []string     `toml:"fields"`
+				MaxValues int          `toml:"max-values"`
+			} `toml:"aggregate"`
+		}{}
+
+		err := conf.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, inSection(section, fmt.Errorf("Error parsing configuration of filter: %s", err.Error())))
+			continue
+		}
+
+		var expression *expr.Expression
+		if x.Expression != "" {
+			expression, err = expr.Compile(x.Expression)
+			if err != nil {
+				errs = append(errs, &sectionError{
+					section: section,
+					key:     section + ".expression",
+					err:     fmt.Errorf("Error compiling expression of filter: %s", err.Error()),
+				})
+				continue
+			}
+		}
+
+		var aggregate *pushers.AggregateConfig
+		if a := x.Aggregate; a != nil {
+			aggregate = &pushers.AggregateConfig{
+				Key:       defaultAggregateKey,
+				Window:    a.Window.Duration(),
+				Fields:    a.Fields,
+				MaxValues: a.MaxValues,
+			}
+
+			if len(a.Key) > 0 {
+				aggregate.Key = a.Key
+			}
+
+			if aggregate.Window == 0 {
+				aggregate.Window = defaultAggregateWindow
+			} else if aggregate.Window < 0 {
+				errs = append(errs, inSection(section+".aggregate", fmt.Errorf("Invalid aggregate window %s for filter", aggregate.Window)))
+				continue
+			}
+		}
+
+		for _, name := range x.Channels {
+			channel, ok := st.channels[name]
+			if !ok {
+				errs = append(errs, inSection(section, fmt.Errorf("Could not find channel %s for filter", name)))
+				continue
+			}
+
+			isChannelUsed[name] = true
+			channel = &countingChannel{channel, channelEvents.With(name)}
+
+			if fn, ok := formats[channelFormats[name]]; ok {
+				channel = pushers.ConvertChannel(channel, fn)
+			}
+
+			channel = pushers.TokenChannel(channel, hc.token)
+
+			// aggregate the events that pass the filters
+			if aggregate != nil {
+				channel = pushers.AggregateChannel(channel, *aggregate)
+				st.aggregates = append(st.aggregates, channel)
+			}
+
+			if len(x.Categories) != 0 {
+				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("category", x.Categories))
+			}
+
+			if len(x.Services) != 0 {
+				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("service", x.Services))
+			}
+
+			if expression != nil {
+				channel = pushers.FilterChannel(channel, expression.Eval)
+			}
+
+			q := queues[name]
+			channel = eventbus.WithQueue(name, channel, q.size, q.policy)
+
+			st.subscribers = append(st.subscribers, channel)
+		}
+	}
+
+	for i, s := range conf.Enrichers {
+		section := fmt.Sprintf("enrich.%d", i)
+
+		x := struct {
+			Type string `toml:"type"`
+		}{}
+
+		err := conf.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, inSection(section, fmt.Errorf("Error parsing configuration of enricher: %s", err.Error())))
+			continue
+		}
+
+		st.raw[section] = decodeRaw(conf, s)
+
+		if st.unchanged(prev, section) && prev.enricherSections[section] != nil {
+			st.enricherSections[section] = prev.enricherSections[section]
+			st.enrichers = append(st.enrichers, prev.enricherSections[section])
+		} else if x.Type == "" {
+			errs = append(errs, inSection(section, fmt.Errorf("Error parsing configuration of enricher: type not set")))
+		} else if enricherFunc, ok := enricher.Get(x.Type); !ok {
+			errs = append(errs, inSection(section, fmt.Errorf("Enricher %s not supported on platform", x.Type)))
+		} else if en, err := enricherFunc(
+			enricher.WithConfig(s),
+			enricher.WithDataDir(hc.dataDir),
+		); err != nil {
+			errs = append(errs, &sectionError{
+				section: section,
+				err:     fmt.Errorf("Error initializing enricher %s: %s", x.Type, err),
+				fatal:   true,
+			})
+		} else {
+			st.enricherSections[section] = en
+			st.enrichers = append(st.enrichers, en)
+		}
+	}
+
+	// the rule engine is subscribed to the bus, alerts are sent back to the
+	// bus to be filtered like other events
+	engineRules := []rules.Rule{}
+
+	for i, s := range conf.Rules {
+		section := fmt.Sprintf("rule.%d", i)
+
+		c := rules.Config{}
+		if err := conf.PrimitiveDecode(s, &c); err != nil {
+			errs = append(errs, inSection(section, fmt.Errorf("Error parsing configuration of rule: %s", err.Error())))
+			continue
+		}
+
+		st.raw[section] = decodeRaw(conf, s)
+
+		if st.unchanged(prev, section) && prev.rules[section] != nil {
+			st.rules[section] = prev.rules[section]
+		} else if r, err := rules.New(c); err != nil {
+			errs = append(errs, inSection(section, fmt.Errorf("Error in rule %s: %s", c.Name, err.Error())))
+			continue
+		} else {
+			st.rules[section] = r
+		}
+
+		engineRules = append(engineRules, st.rules[section])
+	}
+
+	if len(engineRules) > 0 {
+		// the engine drops events instead of blocking the bus, as it sends
+		// to the bus itself
+		engine := rules.NewEngine(hc.events, engineRules...)
+		st.subscribers = append(st.subscribers, eventbus.WithQueue("rules", engine, 0, eventbus.DropNewest))
+	}
+
+	for name, isUsed := range isChannelUsed {
+		if !isUsed {
+			st.warn("channel."+name, "Channel %s is unused. Did you forget to add a filter?", name)
+		}
+	}
+
+	// initialize directors
+	availableDirectorNames := director.GetAvailableDirectorNames()
+
+	isDirectorReused := map[string]bool{}
+
+	for key, s := range conf.Directors {
+		x := struct {
+			Type string `toml:"type"`
+		}{}
+
+		err := conf.PrimitiveDecode(s, &x)
+		if err != nil {
+			errs = append(errs, inSection("director."+key, fmt.Errorf("Error parsing configuration of director: %s", err.Error())))
+			continue
+		}
+
+		if x.Type == "" {
+			errs = append(errs, inSection("director."+key, fmt.Errorf("Error parsing configuration of director %s: type not set", key)))
+			continue
+		}
+
+		st.raw["director."+key] = decodeRaw(conf, s)
+
+		if st.unchanged(prev, "director."+key) {
+			st.directors[key] = prev.directors[key]
+			isDirectorReused[key] = true
+		} else if directorFunc, ok := director.Get(x.Type); !ok {
+			errs = append(errs, inSection("director."+key, fmt.Errorf("Director type=%s not supported on platform (director=%s). Available directors: %s", x.Type, key, strings.Join(availableDirectorNames, ", "))))
+		} else if d, err := directorFunc(
+			director.WithChannel(hc.events),
+			director.WithConfig(s),
+		); err != nil {
+			errs = append(errs, &sectionError{
+				section: "director." + key,
+				err:     fmt.Errorf("Error initializing director %s(%s): %s", key, x.Type, err),
+				fatal:   true,
+			})
+		} else {
+			st.directors[key] = d
+		}
+	}
+
+	var enabledDirectorNames []string
+	for key := range st.directors {
+		enabledDirectorNames = append(enabledDirectorNames, key)
+	}
+
+	isServiceUsed := make(map[string]bool) // Used to check that every service is used by a port
+	// same for proxies
+	for key, s := range conf.Services {
+		x := struct {
+			Type     string `toml:"type"`
+			Director string `toml:"director"`
+			Port     string `toml:"port"`
+		}{}
+
+		if err := conf.PrimitiveDecode(s, &x); err != nil {
+			errs = append(errs, inSection("service."+key, fmt.Errorf("Error parsing configuration of service %s: %s", key, err.Error())))
+			continue
+		}
+
+		if x.Port != "" {
+			errs = append(errs, inSection("service."+key, fmt.Errorf("Ports in services are deprecated, add services to ports instead")))
+			continue
+		}
+
+		st.raw["service."+key] = decodeRaw(conf, s)
+
+		// services using a director can only be reused if the director has been reused as well
+		if !st.unchanged(prev, "service."+key) {
+		} else if x.Director != "" && !isDirectorReused[x.Director] {
+		} else {
+			st.services[key] = prev.services[key]
+			isServiceUsed[key] = false
+			continue
+		}
+
+		// individual configuration per service
+		options := []services.ServicerFunc{
+			services.WithChannel(hc.events),
+			services.WithConfig(s, conf),
+		}
+
+		if x.Director == "" {
+		} else if d, ok := st.directors[x.Director]; ok {
+			options = append(options, services.WithDirector(d))
+		} else {
+			errs = append(errs, inSection("service."+key, fmt.Errorf("Could not find director=%s for service=%s. Enabled directors: %s", x.Director, key, strings.Join(enabledDirectorNames, ", "))))
+			continue
+		}
+
+		fn, ok := services.Get(x.Type)
+		if !ok {
+			errs = append(errs, inSection("service."+key, fmt.Errorf("Could not find type %s for service %s", x.Type, key)))
+			continue
+		}
+
+		service := fn(options...)
+		st.services[key] = &ServiceMap{
+			Service: service,
+			Name:    key,
+			Type:    x.Type,
+		}
+		isServiceUsed[key] = false
+		log.Infof("Configured service %s (%s)", x.Type, key)
+	}
+
+	for i, s := range conf.Ports {
+		section := fmt.Sprintf("port.%d", i)
+
+		x := struct {
+			Port     string   `toml:"port"`
+			Ports    []string `toml:"ports"`
+			Services []string `toml:"services"`
+
+			PeekTimeout    config.Delay `toml:"peek-timeout"`
+			PeekSize       int          `toml:"peek-size"`
+			DefaultService string       `toml:"default-service"`
+		}{}
+
+		if err := conf.PrimitiveDecode(s, &x); err != nil {
+			errs = append(errs, inSection(section, fmt.Errorf("Error parsing configuration of generic ports: %s", err.Error())))
+			continue
+		}
+
+		var ports []string
+		if x.Ports != nil {
+			ports = x.Ports
+		}
+		if x.Port != "" {
+			ports = append(ports, x.Port)
+		}
+		if x.Port != "" && x.Ports != nil {
+			st.warn(section, "Both \"port\" and \"ports\" were defined, this can be confusing")
+		} else if x.Port == "" && x.Ports == nil {
+			errs = append(errs, inSection(section, fmt.Errorf("Neither \"port\" nor \"ports\" were defined")))
+			continue
+		}
+
+		if len(x.Services) == 0 {
+			st.warn(section, "No services defined for port(s) %s", strings.Join(ports, ", "))
+		}
+
+		if x.PeekSize < 0 {
+			errs = append(errs, inSection(section, fmt.Errorf("Invalid peek-size %d for port(s) %s", x.PeekSize, strings.Join(ports, ", "))))
+			continue
+		}
+
+		var defaultService *ServiceMap
+		if x.DefaultService == "" {
+		} else if sm, ok := st.services[x.DefaultService]; ok {
+			defaultService = sm
+			isServiceUsed[x.DefaultService] = true
+		} else {
+			errs = append(errs, inSection(section, fmt.Errorf("Unknown default-service '%s' for port(s) %s", x.DefaultService, strings.Join(ports, ", "))))
+			continue
+		}
+
+		for _, portStr := range ports {
+			pr, err := ToPortRange(portStr)
+			if err != nil {
+				errs = append(errs, inSection(section, fmt.Errorf("Error parsing port string: %s", err.Error())))
+				continue
+			}
+
+			network, err := pr.Network()
+			if err != nil {
+				errs = append(errs, inSection(section, fmt.Errorf("Error resolving host of port %s: %s", portStr, err.Error())))
+				continue
+			}
+
+			// Get the services from their names
+			var servicePtrs []*ServiceMap
+			for _, serviceName := range x.Services {
+				ptr, ok := st.services[serviceName]
+				if !ok {
+					errs = append(errs, inSection(section, fmt.Errorf("Unknown service '%s' for port %s", serviceName, portStr)))
+					continue
+				}
+				servicePtrs = append(servicePtrs, ptr)
+				isServiceUsed[serviceName] = true
+			}
+			if len(servicePtrs) == 0 {
+				errs = append(errs, inSection(section, fmt.Errorf("Port %s has no valid services, it won't be listened on", portStr)))
+				continue
+			}
+
+			r := st.tcp
+			if pr.Proto == "udp" {
+				r = st.udp
+			}
+
+			if err := r.add(&binding{
+				PortRange:      pr,
+				network:        network,
+				services:       servicePtrs,
+				peekTimeout:    x.PeekTimeout.Duration(),
+				peekSize:       x.PeekSize,
+				defaultService: defaultService,
+			}); err != nil {
+				errs = append(errs, inSection(section, err))
+				continue
+			}
+
+			log.Infof("Configured port %s", pr)
+		}
+	}
+
+	for _, r := range []*routes{st.tcp, st.udp} {
+		addrs, err := r.addresses()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error resolving addresses: %s", err.Error()))
+			continue
+		}
+
+		for _, addr := range addrs {
+			st.addresses[addressKey(addr)] = addr
+		}
+	}
+
+	if t, err := listenerType(conf); err == nil && t == "socket" && len(st.addresses) > maxSocketAddresses {
+		errs = append(errs, &sectionError{
+			section: "listener",
+			err:     fmt.Errorf("The ports need %d addresses, the socket listener opens a socket per address and supports at most %d. Switch to the raw listener (type=\"raw\") or the netstack listener (type=\"netstack\") for large port ranges like tcp/any", len(st.addresses), maxSocketAddresses),
+			fatal:   true,
+		})
+
+		st.addresses = map[string]net.Addr{}
+	}
+
+	for name, isUsed := range isServiceUsed {
+		if !isUsed {
+			st.warn("service."+name, "Service %s is defined but not used", name)
+		}
+	}
+
+	for _, key := range conf.Undecoded() {
+		if opaque(key[0]) {
+			continue
+		}
+
+		// keys of services belong to their table, otherwise to the (array of) table(s)
+		section := key[0]
+		if len(key) > 2 && key[0] == "service" {
+			section = strings.Join(key[:2], ".")
+		}
+
+		err := fmt.Errorf("Unrecognized key in configuration: %s", key)
+
+		log.Warning(err.Error())
+		st.warnings = append(st.warnings, &sectionError{section: section, key: key.String(), err: err})
+	}
+
+	if len(errs) > 0 {
+		return st, errs
+	}
+
+	return st, nil
+}
@@ -37,7 +37,6 @@ import (
 
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/event"
-	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
@@ -70,8 +69,8 @@ func (s *copyService) SetChannel(c pushers.Channel) {
 
 func (s *copyService) Handle(ctx context.Context, conn net.Conn) error {
 	defer conn.Close()
-	switch conn.(type) {
-	case *listener.DummyUDPConn:
+	switch conn.LocalAddr().(type) {
+	case *net.UDPAddr:
 		defer s.c.Send(event.New(
 			EventOptions,
 			event.Category("copy"),
@@ -91,7 +90,7 @@ func (s *copyService) Handle(ctx context.Context, conn net.Conn) error {
 		_, err = io.Copy(conn, conn2)
 
 		return err
-	case *net.TCPConn:
+	case *net.TCPAddr:
 		defer s.c.Send(event.New(
 			EventOptions,
 			event.Category("copy"),
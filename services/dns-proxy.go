@@ -37,7 +37,6 @@ import (
 
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/event"
-	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/miekg/dns"
 )
@@ -74,7 +73,7 @@ func (s *dnsProxy) Handle(ctx context.Context, conn net.Conn) error {
 
 	buff := [65535]byte{}
 
-	if _, ok := conn.(*listener.DummyUDPConn); ok {
+	if _, ok := conn.LocalAddr().(*net.UDPAddr); ok {
 		n, err := conn.Read(buff[:])
 		if err != nil {
 			return err
@@ -118,7 +117,7 @@ func (s *dnsProxy) Handle(ctx context.Context, conn net.Conn) error {
 		}
 
 		return err
-	} else if _, ok := conn.(*net.TCPConn); ok {
+	} else if _, ok := conn.LocalAddr().(*net.TCPAddr); ok {
 		n, err := conn.Read(buff[:])
 		if err != nil {
 			return err
@@ -39,7 +39,6 @@ import (
 	"github.com/miekg/dns"
 
 	"github.com/honeytrap/honeytrap/event"
-	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
@@ -69,14 +68,14 @@ func (s *dnsService) Handle(ctx context.Context, conn net.Conn) error {
 
 	buff := make([]byte, 65535)
 
-	if _, ok := conn.(*listener.DummyUDPConn); ok {
+	if _, ok := conn.LocalAddr().(*net.UDPAddr); ok {
 		n, err := conn.Read(buff[:])
 		if err != nil {
 			return err
 		}
 
 		buff = buff[:n]
-	} else if _, ok := conn.(*net.TCPConn); ok {
+	} else if _, ok := conn.LocalAddr().(*net.TCPAddr); ok {
 		n, err := conn.Read(buff[:])
 		if err != nil {
 			return err
@@ -35,7 +35,6 @@ import (
 	"net"
 
 	"github.com/honeytrap/honeytrap/event"
-	"github.com/honeytrap/honeytrap/listener"
 	"github.com/honeytrap/honeytrap/pushers"
 	"io"
 )
@@ -62,7 +61,7 @@ func (s *echoService) SetChannel(c pushers.Channel) {
 }
 
 func (s *echoService) Handle(ctx context.Context, conn net.Conn) error {
-	if _, ok := conn.(*listener.DummyUDPConn); !ok {
+	if _, ok := conn.LocalAddr().(*net.UDPAddr); !ok {
 		_, err := io.Copy(conn, conn)
 		return err
 	}
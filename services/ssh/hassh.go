@@ -0,0 +1,168 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ssh
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+)
+
+const msgKexInit = 20
+
+// maxKexInitSize limits the data kept while waiting for the key exchange.
+const maxKexInitSize = 64 * 1024
+
+// hasshConn observes the data read from the client, to calculate the HASSH
+// fingerprint of the algorithms within the key exchange init message of the
+// client. See https://github.com/salesforce/hassh.
+type hasshConn struct {
+	net.Conn
+
+	m      sync.Mutex
+	buf    bytes.Buffer
+	done   bool
+	digest string
+}
+
+func newHASSHConn(conn net.Conn) *hasshConn {
+	return &hasshConn{
+		Conn: conn,
+	}
+}
+
+func (hc *hasshConn) Read(p []byte) (int, error) {
+	n, err := hc.Conn.Read(p)
+
+	hc.m.Lock()
+	defer hc.m.Unlock()
+
+	if hc.done || n == 0 {
+		return n, err
+	}
+
+	hc.buf.Write(p[:n])
+
+	if digest, ok := parseKexInit(hc.buf.Bytes()); ok {
+		hc.digest = digest
+		hc.done = true
+	} else if hc.buf.Len() > maxKexInitSize {
+		hc.done = true
+	}
+
+	if hc.done {
+		hc.buf = bytes.Buffer{}
+	}
+
+	return n, err
+}
+
+// Digest returns the HASSH fingerprint, or an empty string if the key
+// exchange init message of the client hasn't been read.
+func (hc *hasshConn) Digest() string {
+	hc.m.Lock()
+	defer hc.m.Unlock()
+
+	return hc.digest
+}
+
+// parseKexInit parses the version exchange and the first packet of the client,
+// it returns false while the data is incomplete or if the packet isn't a
+// key exchange init message.
+func parseKexInit(data []byte) (string, bool) {
+	// the client may send lines before the version line
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return "", false
+		}
+
+		line := data[:i]
+		data = data[i+1:]
+
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			break
+		}
+	}
+
+	if len(data) < 5 {
+		return "", false
+	}
+
+	length := binary.BigEndian.Uint32(data[0:4])
+	if length > maxKexInitSize {
+		return "", false
+	}
+
+	if uint32(len(data)-4) < length {
+		return "", false
+	}
+
+	padding := uint32(data[4])
+	if padding+1 > length {
+		return "", false
+	}
+
+	payload := data[5 : 5+length-padding-1]
+
+	// message type and cookie
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return "", false
+	}
+
+	payload = payload[17:]
+
+	lists := []string{}
+	for i := 0; i < 7; i++ {
+		if len(payload) < 4 {
+			return "", false
+		}
+
+		n := binary.BigEndian.Uint32(payload[0:4])
+		if uint32(len(payload)-4) < n {
+			return "", false
+		}
+
+		lists = append(lists, string(payload[4:4+n]))
+		payload = payload[4+n:]
+	}
+
+	// kex algorithms, and the client to server encryption, mac and
+	// compression algorithms
+	hassh := strings.Join([]string{lists[0], lists[2], lists[4], lists[6]}, ";")
+
+	sum := md5.Sum([]byte(hassh))
+	return hex.EncodeToString(sum[:]), true
+}
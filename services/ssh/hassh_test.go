@@ -0,0 +1,136 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ssh
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+func kexInitPacket(lists []string) []byte {
+	payload := []byte{msgKexInit}
+	payload = append(payload, make([]byte, 16)...)
+
+	for _, l := range lists {
+		n := make([]byte, 4)
+		binary.BigEndian.PutUint32(n, uint32(len(l)))
+
+		payload = append(payload, n...)
+		payload = append(payload, l...)
+	}
+
+	// first kex packet follows, reserved
+	payload = append(payload, 0, 0, 0, 0, 0)
+
+	padding := 8 - (len(payload)+5)%8
+	if padding < 4 {
+		padding += 8
+	}
+
+	packet := make([]byte, 5)
+	binary.BigEndian.PutUint32(packet, uint32(1+len(payload)+padding))
+	packet[4] = byte(padding)
+
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+func TestHASSH(t *testing.T) {
+	lists := []string{
+		"curve25519-sha256@libssh.org,diffie-hellman-group14-sha1",
+		"ssh-rsa",
+		"aes128-ctr,aes256-ctr",
+		"aes128-ctr",
+		"hmac-sha2-256,hmac-sha1",
+		"hmac-sha2-256",
+		"none,zlib@openssh.com",
+		"none",
+		"",
+		"",
+	}
+
+	sum := md5.Sum([]byte("curve25519-sha256@libssh.org,diffie-hellman-group14-sha1;aes128-ctr,aes256-ctr;hmac-sha2-256,hmac-sha1;none,zlib@openssh.com"))
+	expected := hex.EncodeToString(sum[:])
+
+	data := append([]byte("SSH-2.0-OpenSSH_7.4\r\n"), kexInitPacket(lists)...)
+
+	client, server := net.Pipe()
+
+	hc := newHASSHConn(server)
+
+	go func() {
+		// deliver the data in small parts, like a slow client
+		for i := 0; i < len(data); i += 7 {
+			end := i + 7
+			if end > len(data) {
+				end = len(data)
+			}
+
+			client.Write(data[i:end])
+		}
+
+		client.Close()
+	}()
+
+	buf := make([]byte, 3)
+	read := []byte{}
+
+	for {
+		n, err := hc.Read(buf)
+		read = append(read, buf[:n]...)
+
+		if err != nil {
+			break
+		}
+	}
+
+	if !bytes.Equal(read, data) {
+		t.Fatal("Expected data to be passed unmodified")
+	}
+
+	if digest := hc.Digest(); digest != expected {
+		t.Errorf("Expected digest %s, got %q", expected, digest)
+	}
+}
+
+func TestHASSHIncomplete(t *testing.T) {
+	if _, ok := parseKexInit([]byte("SSH-2.0-OpenSSH_7.4\r\n\x00\x00")); ok {
+		t.Error("Expected incomplete packet not to be parsed")
+	}
+
+	if _, ok := parseKexInit([]byte("SSH-2.0-OpenSSH_7.4")); ok {
+		t.Error("Expected incomplete version not to be parsed")
+	}
+}
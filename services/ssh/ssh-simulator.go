@@ -141,6 +141,8 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 		connOptions = ec.Options()
 	}
 
+	hconn := newHASSHConn(conn)
+
 	config := ssh.ServerConfig{
 		ServerVersion: s.Banner,
 		MaxAuthTries:  s.MaxAuthTries,
@@ -154,6 +156,7 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 				event.DestinationAddr(cm.LocalAddr()),
 				event.Custom("ssh.sessionid", id.String()),
 				event.Custom("ssh.username", cm.User()),
+				event.Custom("ssh.hassh", hconn.Digest()),
 				event.Custom("ssh.publickey-type", key.Type()),
 				event.Custom("ssh.publickey", hex.EncodeToString(key.Marshal())),
 			))
@@ -161,21 +164,12 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 			return nil, errors.New("Unknown key")
 		},
 		PasswordCallback: func(cm ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
-			s.c.Send(event.New(
-				services.EventOptions,
-				event.Category("ssh"),
-				event.Type("password-authentication"),
-				connOptions,
-				event.SourceAddr(cm.RemoteAddr()),
-				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
-				event.Custom("ssh.username", cm.User()),
-				event.Custom("ssh.password", string(password)),
-			))
+			authenticated := false
 
 			for _, credential := range s.Credentials {
 				if credential == "*" {
-					return nil, nil
+					authenticated = true
+					break
 				}
 
 				parts := strings.Split(credential, ":")
@@ -185,10 +179,29 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 
 				if cm.User() == parts[0] && string(password) == parts[1] {
 					log.Debug("User authenticated successfully. user=%s password=%s", cm.User(), string(password))
-					return nil, nil
+					authenticated = true
+					break
 				}
 			}
 
+			s.c.Send(event.New(
+				services.EventOptions,
+				event.Category("ssh"),
+				event.Type("password-authentication"),
+				connOptions,
+				event.SourceAddr(cm.RemoteAddr()),
+				event.DestinationAddr(cm.LocalAddr()),
+				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.username", cm.User()),
+				event.Custom("ssh.password", string(password)),
+				event.Custom("ssh.authenticated", authenticated),
+				event.Custom("ssh.hassh", hconn.Digest()),
+			))
+
+			if authenticated {
+				return nil, nil
+			}
+
 			return nil, fmt.Errorf("Password rejected for %q", cm.User())
 		},
 	}
@@ -197,7 +210,7 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 
 	defer conn.Close()
 
-	sconn, chans, reqs, err := ssh.NewServerConn(conn, &config)
+	sconn, chans, reqs, err := ssh.NewServerConn(hconn, &config)
 	if err == io.EOF {
 		// server closed connection
 		return nil
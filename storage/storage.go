@@ -45,6 +45,9 @@ type storage interface {
 var db *badger.DB
 var dataDir string
 
+// ErrNotFound is returned by Get for keys that don't exist.
+var ErrNotFound = badger.ErrKeyNotFound
+
 // SetDataDir
 func SetDataDir(s string) {
 	if db != nil {
@@ -133,3 +136,26 @@ func (s *badgeStorage) Set(key string, data []byte) error {
 		return err
 	})
 }
+
+// Range calls fn for every key within the namespace, until fn returns false.
+func (s *badgeStorage) Range(fn func(key string, data []byte) bool) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(s.ns); it.ValidForPrefix(s.ns); it.Next() {
+			item := it.Item()
+
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			if !fn(string(item.Key()[len(s.ns):]), v) {
+				return nil
+			}
+		}
+
+		return nil
+	})
+}